@@ -31,6 +31,12 @@ var (
 		Usage: "Server config file `<path>`",
 		Value: config.DEFAULT_CONFIG_FILE_NAME,
 	}
+
+	OutputConfigFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "Config file `<path>` the bootstrap command writes the deployed hashes to",
+		Value: config.DEFAULT_BOOTSTRAP_CONFIG_FILE_NAME,
+	}
 )
 
 //GetFlagName deal with short flag, and return the flag name whether flag name have short name
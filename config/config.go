@@ -9,6 +9,7 @@ import (
 
 const (
 	DEFAULT_CONFIG_FILE_NAME = "./config.json"
+	DEFAULT_BOOTSTRAP_CONFIG_FILE_NAME = "./config_bootstrap.json"
 	DEFAULT_LOG_LEVEL        = 2
 )
 
@@ -20,18 +21,35 @@ type Config struct {
 	OntRpcAddress        string
 	FactoryHash               string
 	OntdHash string
-	Token1Hash               string
-	Token2Hash            string
-	Exchange1Hash            string
-	Exchange2Hash                    string
+	Pairs []*Pair
 	WalletPath              string
 	AcctPwd string
 	GasPrice                  uint64
 	GasLimit                  uint64
 	ContractsPath string
-	TestFlag uint64	// 0 means token1 to exchange1, 1 means token1 to token2
+	Compiler string // "remote" (default), "local" or "artifacts"
+	CompilerUrl string // url of the remote compiler service
+	CompilerCommand string // local compiler executable, run as CompilerCommand CompilerArgs... source
+	CompilerArgs []string
+	ArtifactsPath string // directory of precompiled <contract>.avm files
+	CompileCachePath string // directory caching compiled contracts by source hash, no cache when empty
+	ManifestPath string // manifest of the compiled contracts, the invocations are checked against their abi when set
+	TestFlag uint64	// 0 means ont/token trades only, 1 means token to token trades between every two pairs as well
 	WaitTxTimeOut uint64
 	OtherUsers []string
+	LiquidRounds uint64 // 0 means keep providing liquidity until exit
+	LiquidInterval uint64 // seconds to sleep between two liquidity rounds
+	TradeRounds uint64 // 0 means keep trading until exit
+	TradeInterval uint64 // seconds to sleep between two trade rounds
+	TokenFiles []string // test OEP-4 token sources under ContractsPath the bootstrap command deploys
+	SeedOntd uint64 // ontd the bootstrap command deposits into every empty exchange
+	SeedTokens uint64 // tokens the bootstrap command deposits into every empty exchange
+}
+
+//Pair is an OEP-4 token and its uniswap exchange
+type Pair struct {
+	TokenHash string
+	ExchangeHash string
 }
 
 //NewConfig retuen a TestConfig instance
@@ -48,6 +66,18 @@ func (this *Config) Init(fileName string) error {
 	return nil
 }
 
+//Save writes the config to fileName as indented json
+func (this *Config) Save(fileName string) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.Marshal TestConfig error:%s", err)
+	}
+	if err := ioutil.WriteFile(fileName, data, 0666); err != nil {
+		return fmt.Errorf("WriteFile %s error %s", fileName, err)
+	}
+	return nil
+}
+
 func (this *Config) loadConfig(fileName string) error {
 	data, err := this.readFile(fileName)
 	if err != nil {
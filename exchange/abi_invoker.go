@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/utils"
+)
+
+// AbiInvoker checks invocations against the abi of their contract, so that a misspelled method or a missing
+// param fails before a transaction is paid for. Contracts without abi are not checked.
+type AbiInvoker struct {
+	abis map[common.Address]*utils.Abi
+}
+
+func NewAbiInvoker() *AbiInvoker {
+	return &AbiInvoker{abis: make(map[common.Address]*utils.Abi)}
+}
+
+// NewManifestInvoker registers the abi of every artifact of manifest at its code hash, and the abi of the
+// exchange template at exchanges, which the factory created from it
+func NewManifestInvoker(manifest *utils.Manifest, exchanges []common.Address) (*AbiInvoker, error) {
+	invoker := NewAbiInvoker()
+	for _, name := range manifest.Names() {
+		artifact := manifest.Contracts[name]
+		if artifact.Abi == nil {
+			continue
+		}
+		addr, err := common.AddressFromHexString(artifact.CodeHash)
+		if err != nil {
+			return nil, fmt.Errorf("NewManifestInvoker, %s CodeHash: %s, AddressFromHexString error: %v", name, artifact.CodeHash, err)
+		}
+		invoker.Register(addr, artifact.Abi)
+	}
+	if template, ok := manifest.Contracts[EXCHANGE_CONTRACT_FILE]; ok && template.Abi != nil {
+		for _, exchange := range exchanges {
+			invoker.Register(exchange, template.Abi)
+		}
+	}
+	return invoker, nil
+}
+
+func (this *AbiInvoker) Register(contract common.Address, abi *utils.Abi) {
+	this.abis[contract] = abi
+}
+
+// Params checks args against method of contract and builds the params InvokeNeoVMContract takes
+func (this *AbiInvoker) Params(contract common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	if abi, ok := this.abis[contract]; ok {
+		if err := abi.Check(method, args); err != nil {
+			return nil, fmt.Errorf("Params, contract: %s, %v", contract.ToHexString(), err)
+		}
+	}
+	return []interface{}{method, args}, nil
+}
+
+// Check checks params built by hand as []interface{}{method, []interface{}{args...}}
+func (this *AbiInvoker) Check(contract common.Address, params []interface{}) error {
+	abi, ok := this.abis[contract]
+	if !ok {
+		return nil
+	}
+	if len(params) != 2 {
+		return fmt.Errorf("Check, contract: %s, params are not [method, args]", contract.ToHexString())
+	}
+	method, ok := params[0].(string)
+	if !ok {
+		return fmt.Errorf("Check, contract: %s, method %v is not a string", contract.ToHexString(), params[0])
+	}
+	args, ok := params[1].([]interface{})
+	if !ok {
+		return fmt.Errorf("Check, contract: %s, method: %s, args are not an array", contract.ToHexString(), method)
+	}
+	if err := abi.Check(method, args); err != nil {
+		return fmt.Errorf("Check, contract: %s, %v", contract.ToHexString(), err)
+	}
+	return nil
+}
+
+// abiClient checks every invocation with its invoker before sending it
+type abiClient struct {
+	Client
+	invoker *AbiInvoker
+}
+
+func (this *abiClient) InvokeNeoVMContract(gasPrice, gasLimit uint64, payer, signer *ontology_go_sdk.Account, contractAddr common.Address, params []interface{}) (common.Uint256, error) {
+	if err := this.invoker.Check(contractAddr, params); err != nil {
+		return common.UINT256_EMPTY, err
+	}
+	return this.Client.InvokeNeoVMContract(gasPrice, gasLimit, payer, signer, contractAddr, params)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"math/big"
+)
+
+// Asset is what a pool can hold: native ONT and ONG, or a neovm OEP-4 token such as ONTD.
+// Amounts are *big.Int for all of them, the native contracts are not read through uint64.
+type Asset interface {
+	Address() common.Address
+	IsNative() bool
+	BalanceOf(owner common.Address) (*big.Int, error)
+	Allowance(owner, spender common.Address) (*big.Int, error)
+	Decimals() (uint64, error)
+	TotalSupply() (*big.Int, error)
+}
+
+// IsNativeAsset reports whether addr is the native ONT or ONG contract
+func IsNativeAsset(addr common.Address) bool {
+	return addr == ontology_go_sdk.ONT_CONTRACT_ADDRESS || addr == ontology_go_sdk.ONG_CONTRACT_ADDRESS
+}
+
+// NewAsset returns the Asset at addr, read through client
+func NewAsset(client Client, addr common.Address) Asset {
+	if IsNativeAsset(addr) {
+		return &nativeAsset{client: client, addr: addr}
+	}
+	return &oep4Asset{client: client, addr: addr}
+}
+
+type nativeAsset struct {
+	client Client
+	addr common.Address
+}
+
+func (this *nativeAsset) Address() common.Address {
+	return this.addr
+}
+
+func (this *nativeAsset) IsNative() bool {
+	return true
+}
+
+func (this *nativeAsset) preExec(method string, params []interface{}) (*big.Int, error) {
+	res, err := this.client.PreExecInvokeNativeContract(this.addr, ontology_go_sdk.ONT_CONTRACT_VERSION, method, params)
+	if err != nil {
+		return nil, fmt.Errorf("native: %s, method: %s, pre invoke error: %v", this.addr.ToHexString(), method, err)
+	}
+	value, err := res.Result.ToInteger()
+	if err != nil {
+		return nil, fmt.Errorf("native: %s, method: %s, Result.ToInteger error: %v", this.addr.ToHexString(), method, err)
+	}
+	return value, nil
+}
+
+func (this *nativeAsset) BalanceOf(owner common.Address) (*big.Int, error) {
+	return this.preExec("balanceOf", []interface{}{owner[:]})
+}
+
+func (this *nativeAsset) Allowance(owner, spender common.Address) (*big.Int, error) {
+	type allowanceState struct {
+		From common.Address
+		To common.Address
+	}
+	return this.preExec("allowance", []interface{}{&allowanceState{From: owner, To: spender}})
+}
+
+func (this *nativeAsset) Decimals() (uint64, error) {
+	decimals, err := this.preExec("decimals", []interface{}{})
+	if err != nil {
+		return 0, err
+	}
+	return decimals.Uint64(), nil
+}
+
+func (this *nativeAsset) TotalSupply() (*big.Int, error) {
+	return this.preExec("totalSupply", []interface{}{})
+}
+
+type oep4Asset struct {
+	client Client
+	addr common.Address
+}
+
+func (this *oep4Asset) Address() common.Address {
+	return this.addr
+}
+
+func (this *oep4Asset) IsNative() bool {
+	return false
+}
+
+func (this *oep4Asset) preExec(method string, params []interface{}) (*big.Int, error) {
+	res, err := GetMethod(this.client, this.addr, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return common.BigIntFromNeoBytes(res), nil
+}
+
+func (this *oep4Asset) BalanceOf(owner common.Address) (*big.Int, error) {
+	return this.preExec("balanceOf", []interface{}{owner})
+}
+
+func (this *oep4Asset) Allowance(owner, spender common.Address) (*big.Int, error) {
+	return this.preExec("allowance", []interface{}{owner, spender})
+}
+
+func (this *oep4Asset) Decimals() (uint64, error) {
+	decimals, err := this.preExec("decimals", nil)
+	if err != nil {
+		return 0, err
+	}
+	return decimals.Uint64(), nil
+}
+
+func (this *oep4Asset) TotalSupply() (*big.Int, error) {
+	return this.preExec("totalSupply", nil)
+}
+
+// readAsset answers a balanceOf, allowance or totalSupply readCall through the Asset at its contract,
+// batchRead uses it for the native contracts which cannot be called from a neovm script with APPCALL
+func readAsset(client Client, call *readCall) ([]byte, error) {
+	asset := NewAsset(client, call.contract)
+	address := func(i int) (common.Address, error) {
+		if i >= len(call.params) {
+			return common.ADDRESS_EMPTY, fmt.Errorf("readAsset, method: %s, want at least %d params", call.method, i+1)
+		}
+		addr, ok := call.params[i].(common.Address)
+		if !ok {
+			return common.ADDRESS_EMPTY, fmt.Errorf("readAsset, method: %s, param %d is %T, not an address", call.method, i, call.params[i])
+		}
+		return addr, nil
+	}
+	var value *big.Int
+	var err error
+	switch call.method {
+	case "balanceOf":
+		var owner common.Address
+		if owner, err = address(0); err == nil {
+			value, err = asset.BalanceOf(owner)
+		}
+	case "allowance":
+		var owner, spender common.Address
+		if owner, err = address(0); err == nil {
+			if spender, err = address(1); err == nil {
+				value, err = asset.Allowance(owner, spender)
+			}
+		}
+	case "totalSupply":
+		value, err = asset.TotalSupply()
+	default:
+		err = fmt.Errorf("readAsset, method: %s is not an asset read", call.method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return common.BigIntToNeoBytes(value), nil
+}
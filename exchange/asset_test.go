@@ -0,0 +1,82 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"testing"
+)
+
+func Test_NativeAssets(t *testing.T) {
+	if testNode == nil {
+		t.Skip("minting needs the mock node")
+	}
+	ont, ong := ontology_go_sdk.ONT_CONTRACT_ADDRESS, ontology_go_sdk.ONG_CONTRACT_ADDRESS
+	owner := mockAddr("native asset owner")
+	// more than fits into an uint64
+	ongAmt := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(5))
+	if err := testNode.Mint(ont, owner, big.NewInt(1234)); err != nil {
+		t.Fatalf("Mint ont error: %v", err)
+	}
+	if err := testNode.Mint(ong, owner, ongAmt); err != nil {
+		t.Fatalf("Mint ong error: %v", err)
+	}
+	balances, err := GetBalances(testEnv.Client, owner, []common.Address{ont, ong, testEnv.OntdAddr})
+	if err != nil {
+		t.Fatalf("GetBalances error: %v", err)
+	}
+	if balances[ont].Int64() != 1234 || balances[ong].Cmp(ongAmt) != 0 || balances[testEnv.OntdAddr].Sign() != 0 {
+		t.Fatalf("balances: %v", balances)
+	}
+	allowances, err := GetAllowances(testEnv.Client, ont, owner, []common.Address{testEnv.OnChainEState[0].ExchangeAddr})
+	if err != nil || allowances[testEnv.OnChainEState[0].ExchangeAddr].Sign() != 0 {
+		t.Fatalf("ont allowances: %v, err: %v", allowances, err)
+	}
+
+	for addr, decimals := range map[common.Address]uint64{ont: 0, ong: 9, testEnv.OntdAddr: 9} {
+		asset := NewAsset(testEnv.Client, addr)
+		if asset.IsNative() != IsNativeAsset(addr) || asset.Address() != addr {
+			t.Fatalf("asset of %s: %+v", addr.ToHexString(), asset)
+		}
+		if d, err := asset.Decimals(); err != nil || d != decimals {
+			t.Fatalf("decimals of %s: %d, err: %v", addr.ToHexString(), d, err)
+		}
+		if supply, err := asset.TotalSupply(); err != nil || supply.Sign() <= 0 {
+			t.Fatalf("total supply of %s: %v, err: %v", addr.ToHexString(), supply, err)
+		}
+	}
+
+	// native reads mixed into a batch
+	var ontBalance, ontdBalance *big.Int
+	err = batchRead(testEnv.Client, []*readCall{
+		{contract: ont, method: "balanceOf", params: []interface{}{owner}, set: setBigInt(func(v *big.Int) { ontBalance = v })},
+		{contract: testEnv.OntdAddr, method: "balanceOf", params: []interface{}{testEnv.Users[0].Address}, set: setBigInt(func(v *big.Int) { ontdBalance = v })},
+	})
+	if err != nil {
+		t.Fatalf("batchRead error: %v", err)
+	}
+	expected, err := GetBalances(testEnv.Client, testEnv.Users[0].Address, []common.Address{testEnv.OntdAddr})
+	if err != nil {
+		t.Fatalf("GetBalances error: %v", err)
+	}
+	if ontBalance.Int64() != 1234 || ontdBalance.Cmp(expected[testEnv.OntdAddr]) != 0 {
+		t.Fatalf("batch read ont: %v, ontd: %v", ontBalance, ontdBalance)
+	}
+}
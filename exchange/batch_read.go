@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ontio/ontology/common"
+	httpcom "github.com/ontio/ontology/http/base/common"
+	"github.com/ontio/ontology/vm/neovm"
+	"math/big"
+	"sync"
+)
+
+const (
+	// BATCH_MAX_CALLS is the most calls packed into one pre-executed script
+	BATCH_MAX_CALLS = 128
+	// BATCH_WORKERS is the most scripts pre-executed at the same time
+	BATCH_WORKERS = 4
+)
+
+// readCall is one read only neovm call of a batch, set receives the byte array it returns
+type readCall struct {
+	contract common.Address
+	method string
+	params []interface{}
+	set func(res []byte) error
+}
+
+// buildBatchCode appends the invoke code of every call and packs their results into one array,
+// PACK takes the result of the last call first so the array is in reverse order of calls
+func buildBatchCode(calls []*readCall) ([]byte, error) {
+	code := make([]byte, 0)
+	for _, call := range calls {
+		params := call.params
+		if params == nil {
+			params = []interface{}{}
+		}
+		callCode, err := httpcom.BuildNeoVMInvokeCode(call.contract, []interface{}{call.method, params})
+		if err != nil {
+			return nil, fmt.Errorf("buildBatchCode, contract: %s, method: %s, err: %v", call.contract.ToHexString(), call.method, err)
+		}
+		code = append(code, callCode...)
+	}
+	builder := neovm.NewParamsBuilder(new(bytes.Buffer))
+	builder.EmitPushInteger(big.NewInt(int64(len(calls))))
+	builder.Emit(neovm.PACK)
+	return append(code, builder.ToArray()...), nil
+}
+
+// batchRead pre-executes calls in scripts of at most BATCH_MAX_CALLS calls, BATCH_WORKERS at a time, and hands
+// every result to its call once all scripts succeeded. The reads of native assets are sent one by one.
+func batchRead(client Client, calls []*readCall) error {
+	scripted, native := make([]*readCall, 0, len(calls)), make([]*readCall, 0)
+	for _, call := range calls {
+		if IsNativeAsset(call.contract) {
+			native = append(native, call)
+		} else {
+			scripted = append(scripted, call)
+		}
+	}
+	chunks := make([][]*readCall, 0)
+	for start := 0; start < len(scripted); start += BATCH_MAX_CALLS {
+		end := start + BATCH_MAX_CALLS
+		if end > len(scripted) {
+			end = len(scripted)
+		}
+		chunks = append(chunks, scripted[start:end])
+	}
+	// every native read is a chunk of its own
+	for _, call := range native {
+		chunks = append(chunks, []*readCall{call})
+	}
+	results := make([][][]byte, len(chunks))
+	errs := make([]error, len(chunks))
+	workers := make(chan struct{}, BATCH_WORKERS)
+	wg := sync.WaitGroup{}
+	for i, chunk := range chunks {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(i int, chunk []*readCall) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			results[i], errs[i] = readChunk(client, chunk)
+		}(i, chunk)
+	}
+	wg.Wait()
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			return fmt.Errorf("batchRead, %v", errs[i])
+		}
+		for j, call := range chunk {
+			if err := call.set(results[i][j]); err != nil {
+				return fmt.Errorf("batchRead, contract: %s, method: %s, err: %v", call.contract.ToHexString(), call.method, err)
+			}
+		}
+	}
+	return nil
+}
+
+func readChunk(client Client, calls []*readCall) ([][]byte, error) {
+	if len(calls) == 1 && IsNativeAsset(calls[0].contract) {
+		value, err := readAsset(client, calls[0])
+		if err != nil {
+			return nil, fmt.Errorf("readChunk, %v", err)
+		}
+		return [][]byte{value}, nil
+	}
+	code, err := buildBatchCode(calls)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.PreExecInvokeCode(code)
+	if err != nil {
+		return nil, fmt.Errorf("readChunk, pre invoke %d calls error: %v", len(calls), err)
+	}
+	items, err := res.Result.ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("readChunk, Result.ToArray error: %v", err)
+	}
+	if len(items) != len(calls) {
+		return nil, fmt.Errorf("readChunk, %d results for %d calls", len(items), len(calls))
+	}
+	values := make([][]byte, len(calls))
+	for i, item := range items {
+		bs, err := item.ToByteArray()
+		if err != nil {
+			call := calls[len(calls)-1-i]
+			return nil, fmt.Errorf("readChunk, contract: %s, method: %s, ToByteArray error: %v", call.contract.ToHexString(), call.method, err)
+		}
+		values[len(calls)-1-i] = bs
+	}
+	return values, nil
+}
+
+// setBigInt returns a readCall setter that stores the returned integer with store
+func setBigInt(store func(*big.Int)) func([]byte) error {
+	return func(res []byte) error {
+		store(common.BigIntFromNeoBytes(res))
+		return nil
+	}
+}
+
+// setAddress returns a readCall setter that stores the returned address with store
+func setAddress(store func(common.Address)) func([]byte) error {
+	return func(res []byte) error {
+		addr, err := common.AddressParseFromBytes(res)
+		if err != nil {
+			return fmt.Errorf("AddressParseFromBytes error: %v", err)
+		}
+		store(addr)
+		return nil
+	}
+}
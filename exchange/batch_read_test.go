@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+// countingClient counts the pre-executions sent to the node
+type countingClient struct {
+	Client
+	scripts int32
+	calls int32
+}
+
+func (this *countingClient) PreExecInvokeCode(code []byte) (*sdkcommon.PreExecResult, error) {
+	atomic.AddInt32(&this.scripts, 1)
+	return this.Client.PreExecInvokeCode(code)
+}
+
+func (this *countingClient) PreExecInvokeNeoVMContract(contractAddr common.Address, params []interface{}) (*sdkcommon.PreExecResult, error) {
+	atomic.AddInt32(&this.calls, 1)
+	return this.Client.PreExecInvokeNeoVMContract(contractAddr, params)
+}
+
+func Test_BatchRead(t *testing.T) {
+	client := &countingClient{Client: testEnv.Client}
+	owners := make([]common.Address, 0)
+	calls := make([]*readCall, 0)
+	got := make(map[common.Address]*big.Int)
+	// more calls than fit into one script, every owner asked twice
+	for i := 0; i < BATCH_MAX_CALLS+10; i++ {
+		owner := testEnv.Users[i%len(testEnv.Users)].Address
+		if i >= len(testEnv.Users) {
+			owner = mockAddr(string(rune('a' + i%26)))
+		}
+		owners = append(owners, owner)
+		calls = append(calls, &readCall{contract: testEnv.OntdAddr, method: "balanceOf", params: []interface{}{owner}, set: setBigInt(func(v *big.Int) { got[owner] = v })})
+	}
+	if err := batchRead(client, calls); err != nil {
+		t.Fatalf("batchRead error: %v", err)
+	}
+	if client.scripts != 2 || client.calls != 0 {
+		t.Fatalf("%d scripts and %d single calls for %d calls", client.scripts, client.calls, len(calls))
+	}
+	expected, err := GetBalances(testEnv.Client, testEnv.Users[1].Address, []common.Address{testEnv.OntdAddr})
+	if err != nil {
+		t.Fatalf("GetBalances error: %v", err)
+	}
+	if got[testEnv.Users[1].Address].Cmp(expected[testEnv.OntdAddr]) != 0 {
+		t.Fatalf("batch read balance: %v, single read: %v", got[testEnv.Users[1].Address], expected[testEnv.OntdAddr])
+	}
+	if got[owners[len(owners)-1]].Sign() != 0 {
+		t.Fatalf("balance of an unknown owner: %v", got[owners[len(owners)-1]])
+	}
+}
+
+func Test_RefreshRoundTrips(t *testing.T) {
+	client := &countingClient{Client: testEnv.Client}
+	env := *testEnv
+	env.Client = client
+	if err := env.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+	if client.scripts != 1 || client.calls != 0 {
+		t.Fatalf("full refresh: %d scripts and %d single calls", client.scripts, client.calls)
+	}
+	if err := env.checkStates(); err != nil {
+		t.Fatalf("checkStates after a batch refresh: %v", err)
+	}
+	if err := env.refreshPools(1); err != nil {
+		t.Fatalf("refreshPools error: %v", err)
+	}
+	if client.scripts != 2 || client.calls != 0 {
+		t.Fatalf("pool refresh: %d scripts and %d single calls", client.scripts-1, client.calls)
+	}
+	if err := env.refreshPools(len(env.OnChainEState)); err == nil {
+		t.Fatalf("refreshPools accepts an index out of range")
+	}
+}
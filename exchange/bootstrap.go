@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"github.com/skyinglyh1/uniswap_v1_test/factory"
+	"github.com/skyinglyh1/uniswap_v1_test/log"
+	"github.com/skyinglyh1/uniswap_v1_test/utils"
+	"math/big"
+	"path/filepath"
+	"time"
+)
+
+const (
+	FACTORY_CONTRACT_FILE = "uniswap_factory.py"
+	EXCHANGE_CONTRACT_FILE = "uniswap_exchange.py"
+	// DEPLOY_GAS_LIMIT covers the deployment of the largest contract, the exchange template
+	DEPLOY_GAS_LIMIT = 20000000
+)
+
+// Bootstrapper deploys a fresh uniswap deployment from the contract sources, every step it finds done on chain is skipped
+type Bootstrapper struct {
+	Client Client
+	Waiter *TxWaiter
+	// Signer deploys the contracts, owns the test tokens and provides the initial liquidity
+	Signer *ontology_go_sdk.Account
+	GasPrice uint64
+	GasLimit uint64
+	DeployGasLimit uint64
+	Compiler utils.Compiler
+	// Manifest collects the artifacts of the contracts Bootstrap compiled
+	Manifest *utils.Manifest
+}
+
+func NewBootstrapper(client Client, signer *ontology_go_sdk.Account, compiler utils.Compiler, cfg *config.Config) *Bootstrapper {
+	return &Bootstrapper{
+		Client: client,
+		Waiter: NewTxWaiter(client, time.Duration(cfg.WaitTxTimeOut) * time.Second),
+		Signer: signer,
+		GasPrice: cfg.GasPrice,
+		GasLimit: cfg.GasLimit,
+		DeployGasLimit: DEPLOY_GAS_LIMIT,
+		Compiler: compiler,
+		Manifest: utils.NewManifest(),
+	}
+}
+
+// Bootstrap deploys the exchange template, the factory and the tokens of cfg.TokenFiles found in cfg.ContractsPath,
+// initializes the factory when it has no template yet, creates the missing exchanges and seeds the empty ones with
+// cfg.SeedOntd and cfg.SeedTokens. It returns cfg with the factory and the pairs of the deployment. The manifest of
+// the contracts is written to cfg.ManifestPath when it is set, so the seeding is checked against their abi.
+func (this *Bootstrapper) Bootstrap(cfg *config.Config) (*config.Config, error) {
+	if len(cfg.TokenFiles) == 0 {
+		return nil, fmt.Errorf("Bootstrap, no token to deploy in TokenFiles")
+	}
+	if cfg.SeedOntd > 0 && cfg.SeedOntd < MIN_INITIAL_ONTD {
+		return nil, fmt.Errorf("Bootstrap, SeedOntd: %d is below the initial deposit minimum %d", cfg.SeedOntd, MIN_INITIAL_ONTD)
+	}
+	template, _, err := this.deploy(cfg.ContractsPath, EXCHANGE_CONTRACT_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("Bootstrap, %v", err)
+	}
+	factoryAddr, _, err := this.deploy(cfg.ContractsPath, FACTORY_CONTRACT_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("Bootstrap, %v", err)
+	}
+	uniswapFactory := factory.NewUniswapFactory(this.Client, factoryAddr, this.GasPrice, this.GasLimit)
+	if err := this.initializeFactory(uniswapFactory, template); err != nil {
+		return nil, fmt.Errorf("Bootstrap, %v", err)
+	}
+
+	out := *cfg
+	out.FactoryHash = factoryAddr.ToHexString()
+	out.Pairs = make([]*config.Pair, 0, len(cfg.TokenFiles))
+	for _, file := range cfg.TokenFiles {
+		token, _, err := this.deploy(cfg.ContractsPath, file)
+		if err != nil {
+			return nil, fmt.Errorf("Bootstrap, %v", err)
+		}
+		if err := this.initToken(token); err != nil {
+			return nil, fmt.Errorf("Bootstrap, %v", err)
+		}
+		exchange, err := this.createExchange(uniswapFactory, token)
+		if err != nil {
+			return nil, fmt.Errorf("Bootstrap, %v", err)
+		}
+		out.Pairs = append(out.Pairs, &config.Pair{TokenHash: token.ToHexString(), ExchangeHash: exchange.ToHexString()})
+	}
+
+	if cfg.ManifestPath != "" {
+		if err := this.Manifest.Save(cfg.ManifestPath); err != nil {
+			return nil, fmt.Errorf("Bootstrap, %v", err)
+		}
+	}
+	env, err := NewTestEnv(&out, WithClient(this.Client), WithAccounts([]*ontology_go_sdk.Account{this.Signer}))
+	if err != nil {
+		return nil, fmt.Errorf("Bootstrap, %v", err)
+	}
+	seedOntd, seedTokens := new(big.Int).SetUint64(cfg.SeedOntd), new(big.Int).SetUint64(cfg.SeedTokens)
+	for i, exState := range env.OnChainEState {
+		if exState.ShareSupply.Sign() > 0 || seedOntd.Sign() == 0 {
+			continue
+		}
+		if err := env.addLiquid(i, big.NewInt(1), seedTokens, seedOntd); err != nil {
+			return nil, fmt.Errorf("Bootstrap, seed exchange: %s, %v", exState.ExchangeAddr.ToHexString(), err)
+		}
+		log.Infof("Bootstrap, exchange: %s seeded with %v ontd and %v tokens", exState.ExchangeAddr.ToHexString(), seedOntd, seedTokens)
+	}
+	return &out, nil
+}
+
+// deploy compiles file and deploys it unless a contract of the same code exists, deployed tells which happened
+func (this *Bootstrapper) deploy(contractsPath, file string) (addr common.Address, deployed bool, err error) {
+	path := filepath.Join(contractsPath, file)
+	artifact, err := utils.CompileArtifact(this.Compiler, path)
+	if err != nil {
+		return common.ADDRESS_EMPTY, false, fmt.Errorf("deploy, %v", err)
+	}
+	this.Manifest.Add(artifact)
+	avmCode, err := artifact.Code()
+	if err != nil {
+		return common.ADDRESS_EMPTY, false, fmt.Errorf("deploy, %v", err)
+	}
+	addr = common.AddressFromVmCode(avmCode)
+	exist, err := utils.CheckContractExist(this.Client, addr)
+	if err != nil {
+		return common.ADDRESS_EMPTY, false, fmt.Errorf("deploy, %v", err)
+	}
+	if exist {
+		log.Infof("deploy, %s is already deployed at %s", file, addr.ToHexString())
+		return addr, false, nil
+	}
+	txHash, err := utils.DeployContract(this.Client, this.GasPrice, this.DeployGasLimit, avmCode, this.Signer, file)
+	if err != nil {
+		return common.ADDRESS_EMPTY, false, fmt.Errorf("deploy, %v", err)
+	}
+	if err := this.wait(txHash, addr, "deploy"); err != nil {
+		return common.ADDRESS_EMPTY, false, fmt.Errorf("deploy, %s: %v", file, err)
+	}
+	log.Infof("deploy, %s deployed at %s", file, addr.ToHexString())
+	return addr, true, nil
+}
+
+// initializeFactory sets template as the exchange template of a factory that has none yet, whoever deployed it
+func (this *Bootstrapper) initializeFactory(uniswapFactory *factory.UniswapFactory, template common.Address) error {
+	current, err := uniswapFactory.ExchangeTemplate()
+	if err == nil {
+		if current != template {
+			log.Warnf("initializeFactory, factory: %s uses template: %s, not %s", uniswapFactory.FactoryAddr.ToHexString(), current.ToHexString(), template.ToHexString())
+		}
+		return nil
+	}
+	if _, ok := err.(*factory.NotFoundError); !ok {
+		return fmt.Errorf("initializeFactory, %v", err)
+	}
+	txHash, err := uniswapFactory.InitializeFactory(this.Signer, template)
+	if err != nil {
+		return fmt.Errorf("initializeFactory, %v", err)
+	}
+	if err := this.wait(txHash, uniswapFactory.FactoryAddr, "initializeFactory"); err != nil {
+		return fmt.Errorf("initializeFactory, %v", err)
+	}
+	log.Infof("initializeFactory, factory: %s initialized with template: %s", uniswapFactory.FactoryAddr.ToHexString(), template.ToHexString())
+	return nil
+}
+
+// initToken mints the supply of a token that has none yet to its owner
+func (this *Bootstrapper) initToken(token common.Address) error {
+	supply, err := NewAsset(this.Client, token).TotalSupply()
+	if err != nil {
+		return fmt.Errorf("initToken, %v", err)
+	}
+	if supply.Sign() > 0 {
+		return nil
+	}
+	txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, this.Signer, this.Signer, token, []interface{}{"init", []interface{}{}})
+	if err != nil {
+		return fmt.Errorf("initToken, token: %s, init error: %v", token.ToHexString(), err)
+	}
+	if err := this.wait(txHash, token, "init"); err != nil {
+		return fmt.Errorf("initToken, %v", err)
+	}
+	return nil
+}
+
+// createExchange returns the exchange of token, created first when the factory has none
+func (this *Bootstrapper) createExchange(uniswapFactory *factory.UniswapFactory, token common.Address) (common.Address, error) {
+	exchange, err := uniswapFactory.GetExchange(token)
+	if _, ok := err.(*factory.NotFoundError); !ok {
+		return exchange, err
+	}
+	txHash, err := uniswapFactory.CreateExchange(this.Signer, token)
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	if err := this.wait(txHash, uniswapFactory.FactoryAddr, "createExchange"); err != nil {
+		return common.ADDRESS_EMPTY, fmt.Errorf("createExchange, %v", err)
+	}
+	exchange, err = uniswapFactory.GetExchange(token)
+	if err != nil {
+		return common.ADDRESS_EMPTY, fmt.Errorf("createExchange, %v", err)
+	}
+	log.Infof("createExchange, exchange of token: %s created at %s", token.ToHexString(), exchange.ToHexString())
+	return exchange, nil
+}
+
+// wait returns an *ExecutionFailedError when the transaction txHash failed
+func (this *Bootstrapper) wait(txHash common.Uint256, contract common.Address, method string) error {
+	result, err := this.Waiter.Wait(txHash)
+	if err != nil {
+		return err
+	}
+	return executionError(result, contract, method)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"github.com/skyinglyh1/uniswap_v1_test/utils"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deployCountingClient counts the deploy transactions sent through it
+type deployCountingClient struct {
+	Client
+	deploys int
+}
+
+func (this *deployCountingClient) DeployNeoVMSmartContract(gasPrice, gasLimit uint64, signer *ontology_go_sdk.Account, needStorage bool, code, name, version, author, email, desc string) (common.Uint256, error) {
+	this.deploys++
+	return this.Client.DeployNeoVMSmartContract(gasPrice, gasLimit, signer, needStorage, code, name, version, author, email, desc)
+}
+
+// sourceCompiler compiles a source to its own bytes, with the abi registered for its file name
+type sourceCompiler struct {
+	abis map[string]*utils.Abi
+}
+
+func (this *sourceCompiler) Compile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func (this *sourceCompiler) CompileWithAbi(path string) ([]byte, *utils.Abi, error) {
+	code, err := ioutil.ReadFile(path)
+	return code, this.abis[filepath.Base(path)], err
+}
+
+func Test_Bootstrap(t *testing.T) {
+	sources := map[string][]byte{
+		EXCHANGE_CONTRACT_FILE: []byte("exchange template avm"),
+		FACTORY_CONTRACT_FILE:  []byte("factory avm"),
+		"token_a.py":           []byte("token a avm"),
+		"token_b.py":           []byte("token b avm"),
+	}
+	ontd, signer := mockAddr("bootstrap ontd"), ontology_go_sdk.NewAccount()
+	// the factory is already deployed but not initialized, the template and the tokens are not deployed
+	node := NewMockNode(common.AddressFromVmCode(sources[FACTORY_CONTRACT_FILE]), ontd)
+	node.BlockInterval = 50 * time.Millisecond
+	node.ModelToken(sources["token_a.py"], "TKA", 9, big.NewInt(1000000000000))
+	node.ModelToken(sources["token_b.py"], "TKB", 9, big.NewInt(1000000000000))
+	for _, asset := range []common.Address{ontology_go_sdk.ONG_CONTRACT_ADDRESS, ontd} {
+		if err := node.Mint(asset, signer.Address, big.NewInt(1000000000000000)); err != nil {
+			t.Fatalf("Mint error: %v", err)
+		}
+	}
+	url, err := node.Start()
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	defer node.Close()
+
+	dir, err := ioutil.TempDir("", "bootstrap")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for file, code := range sources {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), code, 0644); err != nil {
+			t.Fatalf("WriteFile error: %v", err)
+		}
+	}
+	params := func(names ...string) []*utils.AbiParameter {
+		ps := make([]*utils.AbiParameter, 0)
+		for _, name := range names {
+			ps = append(ps, &utils.AbiParameter{Name: name})
+		}
+		return ps
+	}
+	compiler := &sourceCompiler{abis: map[string]*utils.Abi{EXCHANGE_CONTRACT_FILE: {EntryPoint: "Main", Functions: []*utils.AbiFunction{
+		{Name: "Main", Parameters: params("operation", "args")},
+		{Name: "addLiquidity", Parameters: params("minLiquidity", "maxTokens", "deadline", "depositer", "ontdAmount")},
+	}}}}
+
+	cfg := &config.Config{
+		OntdHash:      ontd.ToHexString(),
+		GasPrice:      500,
+		GasLimit:      20000,
+		WaitTxTimeOut: 10,
+		ContractsPath: dir,
+		ManifestPath:  filepath.Join(dir, "manifest.json"),
+		TokenFiles:    []string{"token_a.py", "token_b.py"},
+		SeedOntd:      5000000000,
+		SeedTokens:    8000000000,
+	}
+	client := &deployCountingClient{Client: NewRpcClient(url)}
+	bootstrapper := NewBootstrapper(client, signer, compiler, cfg)
+	out, err := bootstrapper.Bootstrap(cfg)
+	if err != nil {
+		t.Fatalf("Bootstrap error: %v", err)
+	}
+	factoryAddr := common.AddressFromVmCode(sources[FACTORY_CONTRACT_FILE])
+	if client.deploys != 3 || len(out.Pairs) != 2 || out.FactoryHash != factoryAddr.ToHexString() {
+		t.Fatalf("%d deploys, config: %+v", client.deploys, out)
+	}
+	env, err := NewTestEnv(out, WithClient(client), WithAccounts([]*ontology_go_sdk.Account{signer}))
+	if err != nil {
+		t.Fatalf("NewTestEnv of the bootstrapped config error: %v", err)
+	}
+	template, err := env.Factory.ExchangeTemplate()
+	if expect := common.AddressFromVmCode(sources[EXCHANGE_CONTRACT_FILE]); err != nil || template != expect {
+		t.Fatalf("ExchangeTemplate: %s, err: %v", template.ToHexString(), err)
+	}
+	for i, exState := range env.OnChainEState {
+		if exState.OntdLiquid.Uint64() != cfg.SeedOntd || exState.TokenLiquid.Uint64() != cfg.SeedTokens || exState.ShareBalance[signer.Address].Uint64() != cfg.SeedOntd {
+			t.Fatalf("pool %d: ontd %v, tokens %v, shares %v", i, exState.OntdLiquid, exState.TokenLiquid, exState.ShareBalance[signer.Address])
+		}
+		if env.OnChainTState[i].TokenAddr != common.AddressFromVmCode(sources[cfg.TokenFiles[i]]) {
+			t.Fatalf("pool %d token: %s", i, env.OnChainTState[i].TokenAddr.ToHexString())
+		}
+	}
+
+	// a second run finds everything on chain
+	again, err := bootstrapper.Bootstrap(cfg)
+	if err != nil {
+		t.Fatalf("second Bootstrap error: %v", err)
+	}
+	if client.deploys != 3 || again.Pairs[1].ExchangeHash != out.Pairs[1].ExchangeHash {
+		t.Fatalf("second Bootstrap: %d deploys, config: %+v", client.deploys, again)
+	}
+	if err := env.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+	if env.OnChainEState[0].ShareSupply.Uint64() != cfg.SeedOntd {
+		t.Fatalf("second Bootstrap seeded again: %v shares", env.OnChainEState[0].ShareSupply)
+	}
+
+	// the seeding went through the abi of the template, a misspelled method is rejected before it is sent
+	manifest, err := utils.LoadManifest(cfg.ManifestPath)
+	if err != nil || len(manifest.Contracts) != 4 || manifest.Contracts[FACTORY_CONTRACT_FILE].CodeHash != out.FactoryHash {
+		t.Fatalf("manifest: %+v, err: %v", manifest, err)
+	}
+	exchange := env.OnChainEState[0].ExchangeAddr
+	deadline := time.Now().Unix() + 60
+	if _, err := env.Client.InvokeNeoVMContract(env.GasPrice, env.GasLimit, signer, signer, exchange, []interface{}{"addliquidity", []interface{}{1, 1, deadline, signer.Address, 1}}); err == nil || !strings.Contains(err.Error(), "did you mean addLiquidity") {
+		t.Fatalf("misspelled method: %v", err)
+	}
+	if _, err := env.Invoker.Params(exchange, "addLiquidity", 1, 1, deadline, signer.Address); err == nil {
+		t.Fatalf("addLiquidity without ontd amount")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"time"
+)
+
+// Client is the part of the ontology node api the tests use, *ontology_go_sdk.OntologySdk is adapted by NewSdkClient
+type Client interface {
+	InvokeNeoVMContract(gasPrice, gasLimit uint64, payer, signer *ontology_go_sdk.Account, contractAddr common.Address, params []interface{}) (common.Uint256, error)
+	DeployNeoVMSmartContract(gasPrice, gasLimit uint64, signer *ontology_go_sdk.Account, needStorage bool, code, name, version, author, email, desc string) (common.Uint256, error)
+	PreExecInvokeNeoVMContract(contractAddr common.Address, params []interface{}) (*sdkcommon.PreExecResult, error)
+	PreExecInvokeNativeContract(contractAddr common.Address, version byte, method string, params []interface{}) (*sdkcommon.PreExecResult, error)
+	// PreExecInvokeCode pre-executes a hand built invoke script, see batchRead
+	PreExecInvokeCode(code []byte) (*sdkcommon.PreExecResult, error)
+	WaitForGenerateBlock(timeout time.Duration, blockCount ...uint32) (bool, error)
+	GetSmartContractEvent(txHash string) (*sdkcommon.SmartContactEvent, error)
+	GetBlockHeightByTxHash(txHash string) (uint32, error)
+	GetSmartContract(contractAddr string) (*payload.DeployCode, error)
+}
+
+type sdkClient struct {
+	sdk *ontology_go_sdk.OntologySdk
+}
+
+func NewSdkClient(sdk *ontology_go_sdk.OntologySdk) Client {
+	return &sdkClient{sdk: sdk}
+}
+
+// NewRpcClient returns a Client of the node at the json rpc address url
+func NewRpcClient(url string) Client {
+	sdk := ontology_go_sdk.NewOntologySdk()
+	sdk.NewRpcClient().SetAddress(url)
+	return NewSdkClient(sdk)
+}
+
+func (this *sdkClient) InvokeNeoVMContract(gasPrice, gasLimit uint64, payer, signer *ontology_go_sdk.Account, contractAddr common.Address, params []interface{}) (common.Uint256, error) {
+	return this.sdk.NeoVM.InvokeNeoVMContract(gasPrice, gasLimit, payer, signer, contractAddr, params)
+}
+
+func (this *sdkClient) DeployNeoVMSmartContract(gasPrice, gasLimit uint64, signer *ontology_go_sdk.Account, needStorage bool, code, name, version, author, email, desc string) (common.Uint256, error) {
+	return this.sdk.NeoVM.DeployNeoVMSmartContract(gasPrice, gasLimit, signer, needStorage, code, name, version, author, email, desc)
+}
+
+func (this *sdkClient) PreExecInvokeNeoVMContract(contractAddr common.Address, params []interface{}) (*sdkcommon.PreExecResult, error) {
+	return this.sdk.NeoVM.PreExecInvokeNeoVMContract(contractAddr, params)
+}
+
+func (this *sdkClient) PreExecInvokeNativeContract(contractAddr common.Address, version byte, method string, params []interface{}) (*sdkcommon.PreExecResult, error) {
+	return this.sdk.Native.PreExecInvokeNativeContract(contractAddr, version, method, params)
+}
+
+func (this *sdkClient) PreExecInvokeCode(code []byte) (*sdkcommon.PreExecResult, error) {
+	return this.sdk.PreExecTransaction(this.sdk.NewInvokeTransaction(0, 0, code))
+}
+
+func (this *sdkClient) WaitForGenerateBlock(timeout time.Duration, blockCount ...uint32) (bool, error) {
+	return this.sdk.WaitForGenerateBlock(timeout, blockCount...)
+}
+
+func (this *sdkClient) GetSmartContractEvent(txHash string) (*sdkcommon.SmartContactEvent, error) {
+	return this.sdk.GetSmartContractEvent(txHash)
+}
+
+func (this *sdkClient) GetBlockHeightByTxHash(txHash string) (uint32, error) {
+	return this.sdk.GetBlockHeightByTxHash(txHash)
+}
+
+func (this *sdkClient) GetSmartContract(contractAddr string) (*payload.DeployCode, error) {
+	return this.sdk.GetSmartContract(contractAddr)
+}
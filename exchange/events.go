@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	"fmt"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+)
+
+// Event is a decoded notify of an exchange or OEP-4 token contract
+type Event interface {
+	Name() string
+}
+
+type AddLiquidityEvent struct {
+	Contract common.Address
+	Provider common.Address
+	OntdAmount *big.Int
+	TokenAmount *big.Int
+}
+
+type RemoveLiquidityEvent struct {
+	Contract common.Address
+	Provider common.Address
+	OntdAmount *big.Int
+	TokenAmount *big.Int
+}
+
+// TokenPurchaseEvent is emitted by the exchange whose token is bought, for token to token swaps Buyer is the sold exchange
+type TokenPurchaseEvent struct {
+	Contract common.Address
+	Buyer common.Address
+	OntdSold *big.Int
+	TokensBought *big.Int
+}
+
+type OntPurchaseEvent struct {
+	Contract common.Address
+	Buyer common.Address
+	TokensSold *big.Int
+	OntdBought *big.Int
+}
+
+// TransferEvent is a transfer of an OEP-4 token, ontd or the shares of an exchange
+type TransferEvent struct {
+	Contract common.Address
+	From common.Address
+	To common.Address
+	Amount *big.Int
+}
+
+type ApprovalEvent struct {
+	Contract common.Address
+	Owner common.Address
+	Spender common.Address
+	Amount *big.Int
+}
+
+func (this *AddLiquidityEvent) Name() string    { return "AddLiquidity" }
+func (this *RemoveLiquidityEvent) Name() string { return "RemoveLiquidity" }
+func (this *TokenPurchaseEvent) Name() string   { return "TokenPurchase" }
+func (this *OntPurchaseEvent) Name() string     { return "OntPurchase" }
+func (this *TransferEvent) Name() string        { return "Transfer" }
+func (this *ApprovalEvent) Name() string        { return "Approval" }
+
+func (this *AddLiquidityEvent) String() string {
+	return fmt.Sprintf("AddLiquidity{Contract: %s, Provider: %s, OntdAmount: %v, TokenAmount: %v}", this.Contract.ToHexString(), this.Provider.ToBase58(), this.OntdAmount, this.TokenAmount)
+}
+
+func (this *RemoveLiquidityEvent) String() string {
+	return fmt.Sprintf("RemoveLiquidity{Contract: %s, Provider: %s, OntdAmount: %v, TokenAmount: %v}", this.Contract.ToHexString(), this.Provider.ToBase58(), this.OntdAmount, this.TokenAmount)
+}
+
+func (this *TokenPurchaseEvent) String() string {
+	return fmt.Sprintf("TokenPurchase{Contract: %s, Buyer: %s, OntdSold: %v, TokensBought: %v}", this.Contract.ToHexString(), this.Buyer.ToBase58(), this.OntdSold, this.TokensBought)
+}
+
+func (this *OntPurchaseEvent) String() string {
+	return fmt.Sprintf("OntPurchase{Contract: %s, Buyer: %s, TokensSold: %v, OntdBought: %v}", this.Contract.ToHexString(), this.Buyer.ToBase58(), this.TokensSold, this.OntdBought)
+}
+
+func (this *TransferEvent) String() string {
+	return fmt.Sprintf("Transfer{Contract: %s, From: %s, To: %s, Amount: %v}", this.Contract.ToHexString(), this.From.ToBase58(), this.To.ToBase58(), this.Amount)
+}
+
+func (this *ApprovalEvent) String() string {
+	return fmt.Sprintf("Approval{Contract: %s, Owner: %s, Spender: %s, Amount: %v}", this.Contract.ToHexString(), this.Owner.ToBase58(), this.Spender.ToBase58(), this.Amount)
+}
+
+// DecodeEvent decodes a NeoVM notify whose states are the hex encoded event name followed by its params.
+// A notify of the native contracts or with an unknown name is not an error, nil is returned for it.
+func DecodeEvent(notify *sdkcommon.NotifyEventInfo) (Event, error) {
+	states, ok := notify.States.([]interface{})
+	if !ok || len(states) == 0 {
+		return nil, nil
+	}
+	nameHex, ok := states[0].(string)
+	if !ok {
+		return nil, nil
+	}
+	name, err := hex.DecodeString(nameHex)
+	if err != nil {
+		// the native contracts notify plain strings
+		return nil, nil
+	}
+	contract, err := common.AddressFromHexString(notify.ContractAddress)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeEvent, contract: %s, AddressFromHexString error: %v", notify.ContractAddress, err)
+	}
+	params := &eventParams{name: string(name), states: states[1:]}
+	var event Event
+	// OEP-4 tokens name their events in lower case
+	switch strings.ToLower(string(name)) {
+	case "addliquidity":
+		event = &AddLiquidityEvent{Contract: contract, Provider: params.address(0), OntdAmount: params.int(1), TokenAmount: params.int(2)}
+	case "removeliquidity":
+		event = &RemoveLiquidityEvent{Contract: contract, Provider: params.address(0), OntdAmount: params.int(1), TokenAmount: params.int(2)}
+	case "tokenpurchase":
+		event = &TokenPurchaseEvent{Contract: contract, Buyer: params.address(0), OntdSold: params.int(1), TokensBought: params.int(2)}
+	case "ontpurchase":
+		event = &OntPurchaseEvent{Contract: contract, Buyer: params.address(0), TokensSold: params.int(1), OntdBought: params.int(2)}
+	case "transfer":
+		event = &TransferEvent{Contract: contract, From: params.address(0), To: params.address(1), Amount: params.int(2)}
+	case "approval":
+		event = &ApprovalEvent{Contract: contract, Owner: params.address(0), Spender: params.address(1), Amount: params.int(2)}
+	default:
+		return nil, nil
+	}
+	if params.err != nil {
+		return nil, fmt.Errorf("DecodeEvent, contract: %s, %v", notify.ContractAddress, params.err)
+	}
+	return event, nil
+}
+
+// DecodeEvents decodes every known event in notify, in the order they were emitted
+func DecodeEvents(notify []*sdkcommon.NotifyEventInfo) ([]Event, error) {
+	events := make([]Event, 0, len(notify))
+	for _, n := range notify {
+		event, err := DecodeEvent(n)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// eventParams reads typed event params, the first bad one is kept in err
+type eventParams struct {
+	name string
+	states []interface{}
+	err error
+}
+
+func (this *eventParams) bytes(i int) []byte {
+	if this.err != nil {
+		return nil
+	}
+	if i >= len(this.states) {
+		this.err = fmt.Errorf("event: %s, want at least %d params, got %d", this.name, i+1, len(this.states))
+		return nil
+	}
+	s, ok := this.states[i].(string)
+	if !ok {
+		this.err = fmt.Errorf("event: %s, param %d is %T, not a byte array", this.name, i, this.states[i])
+		return nil
+	}
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		this.err = fmt.Errorf("event: %s, param %d hex.DecodeString error: %v", this.name, i, err)
+		return nil
+	}
+	return bs
+}
+
+func (this *eventParams) address(i int) common.Address {
+	bs := this.bytes(i)
+	if this.err != nil {
+		return common.ADDRESS_EMPTY
+	}
+	addr, err := common.AddressParseFromBytes(bs)
+	if err != nil {
+		this.err = fmt.Errorf("event: %s, param %d AddressParseFromBytes error: %v", this.name, i, err)
+	}
+	return addr
+}
+
+// int decodes a NeoVM integer, zero is notified as an empty byte array
+func (this *eventParams) int(i int) *big.Int {
+	bs := this.bytes(i)
+	if this.err != nil {
+		return nil
+	}
+	return common.BigIntFromNeoBytes(bs)
+}
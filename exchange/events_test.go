@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_DecodeEvent(t *testing.T) {
+	contract, from, to := mockAddr("token"), mockAddr("from"), mockAddr("to")
+	notify := &sdkcommon.NotifyEventInfo{ContractAddress: contract.ToHexString(), States: []interface{}{
+		hex.EncodeToString([]byte("transfer")), hex.EncodeToString(from[:]), hex.EncodeToString(to[:]), hex.EncodeToString(common.BigIntToNeoBytes(big.NewInt(300))),
+	}}
+	event, err := DecodeEvent(notify)
+	if err != nil {
+		t.Fatalf("DecodeEvent error: %v", err)
+	}
+	transfer, ok := event.(*TransferEvent)
+	if !ok || transfer.Contract != contract || transfer.From != from || transfer.To != to || transfer.Amount.Int64() != 300 {
+		t.Fatalf("transfer event: %v", event)
+	}
+
+	// zero is an empty byte array
+	notify.States = []interface{}{hex.EncodeToString([]byte("approval")), hex.EncodeToString(from[:]), hex.EncodeToString(to[:]), ""}
+	if event, err := DecodeEvent(notify); err != nil || event.(*ApprovalEvent).Amount.Sign() != 0 {
+		t.Fatalf("approval event: %v, err: %v", event, err)
+	}
+	notify.States = []interface{}{hex.EncodeToString([]byte("approval")), hex.EncodeToString(from[:])}
+	if _, err := DecodeEvent(notify); err == nil {
+		t.Fatalf("decodes an approval without spender")
+	}
+	native := &sdkcommon.NotifyEventInfo{ContractAddress: contract.ToHexString(), States: []interface{}{"transfer", from.ToBase58(), to.ToBase58(), 10}}
+	if event, err := DecodeEvent(native); event != nil || err != nil {
+		t.Fatalf("native notify: %v, err: %v", event, err)
+	}
+}
+
+func Test_SwapEvents(t *testing.T) {
+	pool, trader := 0, testEnv.Users[1]
+	exchangeAddr := testEnv.OnChainEState[pool].ExchangeAddr
+	ontdSold := big.NewInt(2000)
+	if err := testEnv.ensureOntdAllowance(pool, trader, ontdSold); err != nil {
+		t.Fatalf("ensureOntdAllowance error: %v", err)
+	}
+	tokensBought, err := getInputPrice(ontdSold, testEnv.OnChainEState[pool].OntdLiquid, testEnv.OnChainEState[pool].TokenLiquid)
+	if err != nil {
+		t.Fatalf("getInputPrice error: %v", err)
+	}
+	deadline := time.Now().Add(testEnv.WaitTxTimeOut).Unix()
+	txHash, err := testEnv.Client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, trader, trader, exchangeAddr, []interface{}{"ontToTokenSwapInput", []interface{}{big.NewInt(1), deadline, trader.Address, ontdSold}})
+	if err != nil {
+		t.Fatalf("ontToTokenSwapInput error: %v", err)
+	}
+	result, err := testEnv.Waiter.Wait(txHash)
+	if err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	// keep the simulator in step for the tests after this one
+	_, simErr := testEnv.Simulator.OntToTokenInput(exchangeAddr, ontdSold, big.NewInt(1), deadline, trader.Address, trader.Address)
+	mirrorResult("ontToTokenInput", simErr)
+	if err := testEnv.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+
+	events, err := result.Events()
+	if err != nil {
+		t.Fatalf("Events error: %v", err)
+	}
+	var purchase *TokenPurchaseEvent
+	for _, event := range events {
+		if e, ok := event.(*TokenPurchaseEvent); ok {
+			purchase = e
+		}
+	}
+	if purchase == nil || purchase.Contract != exchangeAddr || purchase.Buyer != trader.Address || purchase.OntdSold.Cmp(ontdSold) != 0 || purchase.TokensBought.Cmp(tokensBought) != 0 {
+		t.Fatalf("token purchase: %v, expect %v ontd for %v tokens", purchase, ontdSold, tokensBought)
+	}
+}
+
+func Test_ApprovalEvent(t *testing.T) {
+	owner, spender := testEnv.Users[2], testEnv.Users[0].Address
+	token := testEnv.OnChainTState[1].TokenAddr
+	txHash, err := testEnv.Client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, owner, owner, token, []interface{}{"approve", []interface{}{owner.Address, spender, big.NewInt(777)}})
+	if err != nil {
+		t.Fatalf("approve error: %v", err)
+	}
+	result, err := testEnv.Waiter.Wait(txHash)
+	if err != nil {
+		t.Fatalf("Wait error: %v", err)
+	}
+	testEnv.mirrorApprove(token, owner.Address, spender, big.NewInt(777))
+	events, err := result.Events()
+	if err != nil {
+		t.Fatalf("Events error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("events: %v", events)
+	}
+	approval, ok := events[0].(*ApprovalEvent)
+	if !ok || approval.Contract != token || approval.Owner != owner.Address || approval.Spender != spender || approval.Amount.Int64() != 777 {
+		t.Fatalf("approval event: %v", events[0])
+	}
+}
@@ -1,23 +1,60 @@
 package exchange
 
 import (
+	"fmt"
 	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
 	"github.com/ontio/ontology/common"
 	"github.com/skyinglyh1/uniswap_v1_test/config"
 	"github.com/skyinglyh1/uniswap_v1_test/log"
 	"github.com/skyinglyh1/uniswap_v1_test/utils"
+	"math/big"
+	"math/rand"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ExchangeTest struct {
-	Sdk *ontology_go_sdk.OntologySdk
+	Client Client
+	Waiter *TxWaiter
 	Accts []*ontology_go_sdk.Account
 	FactoryHash common.Address
-	ExchangeHash1 common.Address
-	TokenHash1 common.Address
-	ExchangeHash2 common.Address
-	TokenHash2 common.Address
+	OntdHash common.Address
+	// Exchanges[i] is the exchange of Tokens[i]
+	Exchanges []common.Address
+	Tokens []common.Address
 	TestMode uint64
+
+	GasPrice uint64
+	GasLimit uint64
+	WaitTxTimeOut time.Duration
+	LiquidRounds uint64
+	LiquidInterval time.Duration
+	TradeRounds uint64
+	TradeInterval time.Duration
+
+	randLock sync.Mutex
+	rand *rand.Rand
+}
+
+// loopStats counts the transactions sent by one of the test loops
+type loopStats struct {
+	name string
+	success uint64
+	failure uint64
+}
+
+func (this *loopStats) succeed() {
+	atomic.AddUint64(&this.success, 1)
+}
+
+func (this *loopStats) fail() {
+	atomic.AddUint64(&this.failure, 1)
+}
+
+func (this *loopStats) report() {
+	log.Infof("%s, success: %d, failure: %d", this.name, atomic.LoadUint64(&this.success), atomic.LoadUint64(&this.failure))
 }
 
 func NewExchangeTest(config *config.Config) *ExchangeTest {
@@ -27,64 +64,469 @@ func NewExchangeTest(config *config.Config) *ExchangeTest {
 		os.Exit(1)
 	}
 	factoryHash, err1 := common.AddressFromHexString(config.FactoryHash)
-	ex1, err2 := common.AddressFromHexString(config.Exchange1Hash)
-	t1, err3 := common.AddressFromHexString(config.Token1Hash)
+	ontd, err2 := common.AddressFromHexString(config.OntdHash)
+	tokens, exchanges, err3 := ParsePairs(config.Pairs)
 	if err1 != nil || err2 != nil || err3 != nil {
-		log.Errorf("FactoryHash err: %v, Exchange1Hash1err: %v, Token1Hash1 err: %v", err1, err2, err3)
+		log.Errorf("FactoryHash err: %v, OntdHash err: %v, Pairs err: %v", err1, err2, err3)
 		os.Exit(1)
 	}
-	et := &ExchangeTest{
-		Sdk: sdk,
+	client := NewSdkClient(sdk)
+	return &ExchangeTest{
+		Client: client,
+		Waiter: NewTxWaiter(client, time.Duration(config.WaitTxTimeOut) * time.Second),
 		Accts: accts,
 		FactoryHash: factoryHash,
-		ExchangeHash1: ex1,
-		TokenHash1: t1,
+		OntdHash: ontd,
+		Exchanges: exchanges,
+		Tokens: tokens,
 		TestMode: config.TestFlag,
+		GasPrice: config.GasPrice,
+		GasLimit: config.GasLimit,
+		WaitTxTimeOut: time.Duration(config.WaitTxTimeOut) * time.Second,
+		LiquidRounds: config.LiquidRounds,
+		LiquidInterval: time.Duration(config.LiquidInterval) * time.Second,
+		TradeRounds: config.TradeRounds,
+		TradeInterval: time.Duration(config.TradeInterval) * time.Second,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
-	if config.TestFlag == 0 {
+}
 
-	} else {
-		ex2, err1 := common.AddressFromHexString(config.Exchange2Hash)
-		t2, err2 := common.AddressFromHexString(config.Token2Hash)
-		if err1 != nil || err2 != nil{
-			log.Errorf("Exchange1Hash2 err: %v, Token1Hash2 err: %v", err1, err2)
-			os.Exit(1)
+// routes returns the [sold, bought] pool indexes of every token to token trade, none unless TestMode is 1
+func (this *ExchangeTest) routes() [][2]int {
+	routes := make([][2]int, 0)
+	if this.TestMode != 1 {
+		return routes
+	}
+	for i := range this.Exchanges {
+		for j := range this.Exchanges {
+			if i != j {
+				routes = append(routes, [2]int{i, j})
+			}
 		}
-		et.ExchangeHash2 = ex2
-		et.TokenHash2 = t2
 	}
-	return et
+	return routes
+}
+
+// randAmount returns a random amount within [1, max], or nil if max is less than 1
+func (this *ExchangeTest) randAmount(max *big.Int) *big.Int {
+	if max == nil || max.Sign() <= 0 {
+		return nil
+	}
+	this.randLock.Lock()
+	defer this.randLock.Unlock()
+	return new(big.Int).Add(new(big.Int).Rand(this.rand, max), big.NewInt(1))
 }
 
+func (this *ExchangeTest) randIntn(n int) int {
+	this.randLock.Lock()
+	defer this.randLock.Unlock()
+	return this.rand.Intn(n)
+}
+
+// invokeAndWait sends the invocation signed and paid by signer, a failed execution is returned as *ExecutionFailedError
+func (this *ExchangeTest) invokeAndWait(signer *ontology_go_sdk.Account, contract common.Address, params []interface{}) error {
+	txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, signer, signer, contract, params)
+	if err != nil {
+		return fmt.Errorf("invokeAndWait, contract: %s, invoke err: %v", contract.ToHexString(), err)
+	}
+	result, err := this.Waiter.Wait(txHash)
+	if err != nil {
+		return fmt.Errorf("invokeAndWait, contract: %s, %w", contract.ToHexString(), err)
+	}
+	return executionError(result, contract, params[0].(string))
+}
 
+// ensureAllowance approves amount of token from owner to spender when the current allowance is not enough
+func (this *ExchangeTest) ensureAllowance(owner *ontology_go_sdk.Account, token, spender common.Address, amount *big.Int) error {
+	allowances, err := GetAllowances(this.Client, token, owner.Address, []common.Address{spender})
+	if err != nil {
+		return fmt.Errorf("ensureAllowance, err: %v", err)
+	}
+	if allowances[spender].Cmp(amount) >= 0 {
+		return nil
+	}
+	if err := this.invokeAndWait(owner, token, []interface{}{"approve", []interface{}{owner.Address, spender, amount}}); err != nil {
+		return fmt.Errorf("ensureAllowance, owner: %s, approve token: %s, %w", owner.Address.ToBase58(), token.ToHexString(), err)
+	}
+	return nil
+}
+
+// exchangeReserves returns ontd reserve, token reserve and share supply of the exchange
+func (this *ExchangeTest) exchangeReserves(exchange, token common.Address) (*big.Int, *big.Int, *big.Int, error) {
+	balances, err := GetBalances(this.Client, exchange, []common.Address{this.OntdHash, token})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("exchangeReserves, err: %v", err)
+	}
+	supplyBs, err := GetMethod(this.Client, exchange, "totalSupply", nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("exchangeReserves, err: %v", err)
+	}
+	return balances[this.OntdHash], balances[token], common.BigIntFromNeoBytes(supplyBs), nil
+}
 
 func (this *ExchangeTest) Liquid() {
+	stats := &loopStats{name: "Liquid"}
+	exchanges, tokens := this.Exchanges, this.Tokens
+	for round := uint64(0); this.LiquidRounds == 0 || round < this.LiquidRounds; round++ {
+		for _, acct := range this.Accts {
+			i := this.randIntn(len(exchanges))
+			var err error
+			// remove liquidity every third time on average so that the pools keep growing
+			if this.randIntn(3) == 0 {
+				err = this.removeLiquidity(acct, exchanges[i], tokens[i], stats)
+			} else {
+				err = this.addLiquidity(acct, exchanges[i], tokens[i], stats)
+			}
+			if err != nil {
+				log.Errorf("Liquid, round: %d, account: %s, exchange: %s, err: %v", round, acct.Address.ToBase58(), exchanges[i].ToHexString(), err)
+			}
+		}
+		stats.report()
+		time.Sleep(this.LiquidInterval)
+	}
+}
+
+func (this *ExchangeTest) addLiquidity(acct *ontology_go_sdk.Account, exchange, token common.Address, stats *loopStats) error {
+	balances, err := GetBalances(this.Client, acct.Address, []common.Address{this.OntdHash, token})
+	if err != nil {
+		return fmt.Errorf("addLiquidity, err: %v", err)
+	}
+	ontdReserve, tokenReserve, supply, err := this.exchangeReserves(exchange, token)
+	if err != nil {
+		return fmt.Errorf("addLiquidity, err: %v", err)
+	}
+	// never put more than a tenth of the balance into the pool in one go
+	maxOntd := new(big.Int).Div(balances[this.OntdHash], big.NewInt(10))
+	maxTokens := new(big.Int).Div(balances[token], big.NewInt(10))
+	minLiquidity := big.NewInt(1)
+	if supply.Sign() > 0 && ontdReserve.Sign() > 0 {
+		// the exchange pulls ontd * tokenReserve / ontdReserve + 1 tokens
+		if maxTokens.Cmp(big.NewInt(1)) <= 0 {
+			log.Debugf("addLiquidity, account: %s, not enough token balance", acct.Address.ToBase58())
+			return nil
+		}
+		limit := new(big.Int).Div(new(big.Int).Mul(new(big.Int).Sub(maxTokens, big.NewInt(1)), ontdReserve), tokenReserve)
+		if limit.Cmp(maxOntd) < 0 {
+			maxOntd = limit
+		}
+	}
+	ontdAmt := this.randAmount(maxOntd)
+	if ontdAmt == nil || maxTokens.Sign() <= 0 {
+		log.Debugf("addLiquidity, account: %s, not enough ontd or token balance", acct.Address.ToBase58())
+		return nil
+	}
+	var tokenAmt *big.Int
+	if supply.Sign() > 0 && ontdReserve.Sign() > 0 {
+		tokenAmt = new(big.Int).Add(new(big.Int).Div(new(big.Int).Mul(ontdAmt, tokenReserve), ontdReserve), big.NewInt(1))
+	} else {
+		tokenAmt = this.randAmount(maxTokens)
+	}
 
+	if err := this.ensureAllowance(acct, token, exchange, tokenAmt); err != nil {
+		return fmt.Errorf("addLiquidity, exchange: %s, %w", exchange.ToHexString(), err)
+	}
+	if err := this.ensureAllowance(acct, this.OntdHash, exchange, ontdAmt); err != nil {
+		return fmt.Errorf("addLiquidity, exchange: %s, %w", exchange.ToHexString(), err)
+	}
+	err = this.invokeAndWait(acct, exchange, []interface{}{"addLiquidity", []interface{}{
+		minLiquidity, tokenAmt, time.Now().Add(this.WaitTxTimeOut).Unix(), acct.Address, ontdAmt,
+	}})
+	if err != nil {
+		stats.fail()
+		return fmt.Errorf("addLiquidity, exchange: %s, ontd: %s, max tokens: %s, %w", exchange.ToHexString(), ontdAmt.String(), tokenAmt.String(), err)
+	}
+	stats.succeed()
+	log.Debugf("addLiquidity, account: %s, ontd: %s, max tokens: %s", acct.Address.ToBase58(), ontdAmt.String(), tokenAmt.String())
+	return nil
+}
+
+func (this *ExchangeTest) removeLiquidity(acct *ontology_go_sdk.Account, exchange, token common.Address, stats *loopStats) error {
+	shares, err := GetBalances(this.Client, acct.Address, []common.Address{exchange})
+	if err != nil {
+		return fmt.Errorf("removeLiquidity, err: %v", err)
+	}
+	amount := this.randAmount(new(big.Int).Div(shares[exchange], big.NewInt(2)))
+	if amount == nil {
+		log.Debugf("removeLiquidity, account: %s, not enough share balance", acct.Address.ToBase58())
+		return nil
+	}
+	ontdReserve, tokenReserve, supply, err := this.exchangeReserves(exchange, token)
+	if err != nil {
+		return fmt.Errorf("removeLiquidity, err: %v", err)
+	}
+	// accept half of the current value since the trade loops move the price meanwhile
+	minOntd := new(big.Int).Div(new(big.Int).Mul(amount, ontdReserve), new(big.Int).Mul(supply, big.NewInt(2)))
+	minTokens := new(big.Int).Div(new(big.Int).Mul(amount, tokenReserve), new(big.Int).Mul(supply, big.NewInt(2)))
+	if minOntd.Sign() <= 0 || minTokens.Sign() <= 0 {
+		log.Debugf("removeLiquidity, account: %s, share amount %s too small", acct.Address.ToBase58(), amount.String())
+		return nil
+	}
+	err = this.invokeAndWait(acct, exchange, []interface{}{"removeLiquidity", []interface{}{
+		amount, minOntd, minTokens, time.Now().Add(this.WaitTxTimeOut).Unix(), acct.Address,
+	}})
+	if err != nil {
+		stats.fail()
+		return fmt.Errorf("removeLiquidity, exchange: %s, amount: %s, %w", exchange.ToHexString(), amount.String(), err)
+	}
+	stats.succeed()
+	log.Debugf("removeLiquidity, account: %s, amount: %s", acct.Address.ToBase58(), amount.String())
+	return nil
 }
 
 func (this *ExchangeTest) Trade() {
-	
-	go this.Token1ToOng()
-	go this.OngToToken1()
+	for i := range this.Exchanges {
+		go this.OntToToken(i)
+		go this.TokenToOnt(i)
+	}
+	for _, route := range this.routes() {
+		go this.TokenToToken(route[0], route[1])
+	}
+}
+
+// tradeLoop runs trade for every account in each round until TradeRounds is reached
+func (this *ExchangeTest) tradeLoop(name string, trade func(acct *ontology_go_sdk.Account) (bool, error)) {
+	stats := &loopStats{name: name}
+	for round := uint64(0); this.TradeRounds == 0 || round < this.TradeRounds; round++ {
+		for _, acct := range this.Accts {
+			sent, err := trade(acct)
+			if err != nil {
+				log.Errorf("%s, round: %d, account: %s, err: %v", name, round, acct.Address.ToBase58(), err)
+			}
+			if !sent {
+				continue
+			}
+			if err != nil {
+				stats.fail()
+			} else {
+				stats.succeed()
+			}
+		}
+		stats.report()
+		time.Sleep(this.TradeInterval)
+	}
+}
 
-	if (this.TestMode == 1) {
-		go this.Token1ToToken2()
-		go this.Token2ToToken1()
+// recipientFor returns the invoker itself for swaps, or another random account for transfers
+func (this *ExchangeTest) recipientFor(invoker *ontology_go_sdk.Account) (common.Address, bool) {
+	if len(this.Accts) < 2 || this.randIntn(2) == 0 {
+		return invoker.Address, false
+	}
+	for {
+		acct := this.Accts[this.randIntn(len(this.Accts))]
+		if acct.Address != invoker.Address {
+			return acct.Address, true
+		}
 	}
 }
 
-func (this *ExchangeTest) OngToToken1() {
+// tradeAmount picks a random amount no larger than a tenth of balance nor a hundredth of reserve
+func (this *ExchangeTest) tradeAmount(balance, reserve *big.Int) *big.Int {
+	max := new(big.Int).Div(balance, big.NewInt(10))
+	limit := new(big.Int).Div(reserve, big.NewInt(100))
+	if limit.Cmp(max) < 0 {
+		max = limit
+	}
+	return this.randAmount(max)
+}
 
+// withSlippage returns the minimum accepted output and the maximum accepted input around amount
+func withSlippage(amount *big.Int) (*big.Int, *big.Int) {
+	min := new(big.Int).Div(new(big.Int).Mul(amount, big.NewInt(99)), big.NewInt(100))
+	if min.Sign() <= 0 {
+		min = big.NewInt(1)
+	}
+	max := new(big.Int).Add(new(big.Int).Div(new(big.Int).Mul(amount, big.NewInt(101)), big.NewInt(100)), big.NewInt(1))
+	return min, max
 }
 
-func (this *ExchangeTest) Token1ToOng() {
+// sendTrade invokes the exchange, a failed execution is returned as *ExecutionFailedError wrapped with the exchange and params
+func (this *ExchangeTest) sendTrade(invoker *ontology_go_sdk.Account, exchange common.Address, params []interface{}) (bool, error) {
+	if err := this.invokeAndWait(invoker, exchange, params); err != nil {
+		return true, fmt.Errorf("%s, exchange: %s, params: %v, %w", params[0], exchange.ToHexString(), params[1], err)
+	}
+	log.Debugf("%s, invoker: %s, params: %v", params[0], invoker.Address.ToBase58(), params[1])
+	return true, nil
+}
 
+// OntToToken keeps buying the token of pool i with ontd
+func (this *ExchangeTest) OntToToken(i int) {
+	this.tradeLoop(fmt.Sprintf("OntToToken%d", i+1), func(acct *ontology_go_sdk.Account) (bool, error) {
+		return this.ontToToken(acct, this.Exchanges[i], this.Tokens[i])
+	})
 }
 
-func (this *ExchangeTest) Token1ToToken2() {
+// TokenToOnt keeps selling the token of pool i for ontd
+func (this *ExchangeTest) TokenToOnt(i int) {
+	this.tradeLoop(fmt.Sprintf("Token%dToOnt", i+1), func(acct *ontology_go_sdk.Account) (bool, error) {
+		return this.tokenToOnt(acct, this.Exchanges[i], this.Tokens[i])
+	})
+}
 
+// TokenToToken keeps selling the token of pool sold for the token of pool bought
+func (this *ExchangeTest) TokenToToken(sold, bought int) {
+	this.tradeLoop(fmt.Sprintf("Token%dToToken%d", sold+1, bought+1), func(acct *ontology_go_sdk.Account) (bool, error) {
+		return this.tokenToToken(acct, this.Exchanges[sold], this.Tokens[sold], this.Exchanges[bought], this.Tokens[bought])
+	})
 }
 
-func (this *ExchangeTest) Token2ToToken1() {
+// ontToToken sends one of ontToTokenSwapInput, ontToTokenTransferInput, ontToTokenSwapOutput and ontToTokenTransferOutput
+func (this *ExchangeTest) ontToToken(invoker *ontology_go_sdk.Account, exchange, token common.Address) (bool, error) {
+	balances, err := GetBalances(this.Client, invoker.Address, []common.Address{this.OntdHash})
+	if err != nil {
+		return false, fmt.Errorf("ontToToken, err: %v", err)
+	}
+	ontdReserve, tokenReserve, _, err := this.exchangeReserves(exchange, token)
+	if err != nil {
+		return false, fmt.Errorf("ontToToken, err: %v", err)
+	}
+	if ontdReserve.Sign() <= 0 || tokenReserve.Sign() <= 0 {
+		return false, nil
+	}
+	ontdSold := this.tradeAmount(balances[this.OntdHash], ontdReserve)
+	if ontdSold == nil {
+		return false, nil
+	}
+	recipient, transfer := this.recipientFor(invoker)
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
+
+	var params []interface{}
+	if this.randIntn(2) == 0 {
+		minTokens, _ := withSlippage(inputPrice(ontdSold, ontdReserve, tokenReserve))
+		if err := this.ensureAllowance(invoker, this.OntdHash, exchange, ontdSold); err != nil {
+			return false, fmt.Errorf("ontToToken, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{"ontToTokenTransferInput", []interface{}{minTokens, deadline, recipient, invoker.Address, ontdSold}}
+		} else {
+			params = []interface{}{"ontToTokenSwapInput", []interface{}{minTokens, deadline, invoker.Address, ontdSold}}
+		}
+	} else {
+		// buy what ontdSold is worth now and allow paying a little more
+		tokensBought := inputPrice(ontdSold, ontdReserve, tokenReserve)
+		if tokensBought.Sign() <= 0 {
+			return false, nil
+		}
+		_, maxOntd := withSlippage(outputPrice(tokensBought, ontdReserve, tokenReserve))
+		if err := this.ensureAllowance(invoker, this.OntdHash, exchange, maxOntd); err != nil {
+			return false, fmt.Errorf("ontToToken, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{"ontToTokenTransferOutput", []interface{}{tokensBought, deadline, recipient, invoker.Address, maxOntd}}
+		} else {
+			params = []interface{}{"ontToTokenSwapOutput", []interface{}{tokensBought, deadline, invoker.Address, maxOntd}}
+		}
+	}
+	return this.sendTrade(invoker, exchange, params)
+}
 
-}
\ No newline at end of file
+// tokenToOnt sends one of tokenToOntSwapInput, tokenToOntTransferInput, tokenToOntSwapOutput and tokenToOntTransferOutput
+func (this *ExchangeTest) tokenToOnt(invoker *ontology_go_sdk.Account, exchange, token common.Address) (bool, error) {
+	balances, err := GetBalances(this.Client, invoker.Address, []common.Address{token})
+	if err != nil {
+		return false, fmt.Errorf("tokenToOnt, err: %v", err)
+	}
+	ontdReserve, tokenReserve, _, err := this.exchangeReserves(exchange, token)
+	if err != nil {
+		return false, fmt.Errorf("tokenToOnt, err: %v", err)
+	}
+	if ontdReserve.Sign() <= 0 || tokenReserve.Sign() <= 0 {
+		return false, nil
+	}
+	tokensSold := this.tradeAmount(balances[token], tokenReserve)
+	if tokensSold == nil {
+		return false, nil
+	}
+	recipient, transfer := this.recipientFor(invoker)
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
+
+	var params []interface{}
+	if this.randIntn(2) == 0 {
+		minOntd, _ := withSlippage(inputPrice(tokensSold, tokenReserve, ontdReserve))
+		if err := this.ensureAllowance(invoker, token, exchange, tokensSold); err != nil {
+			return false, fmt.Errorf("tokenToOnt, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{"tokenToOntTransferInput", []interface{}{tokensSold, minOntd, deadline, invoker.Address, recipient}}
+		} else {
+			params = []interface{}{"tokenToOntSwapInput", []interface{}{tokensSold, minOntd, deadline, invoker.Address}}
+		}
+	} else {
+		ontdBought := inputPrice(tokensSold, tokenReserve, ontdReserve)
+		if ontdBought.Sign() <= 0 {
+			return false, nil
+		}
+		_, maxTokens := withSlippage(outputPrice(ontdBought, tokenReserve, ontdReserve))
+		if err := this.ensureAllowance(invoker, token, exchange, maxTokens); err != nil {
+			return false, fmt.Errorf("tokenToOnt, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{"tokenToOntTransferOutput", []interface{}{ontdBought, maxTokens, deadline, recipient, invoker.Address}}
+		} else {
+			params = []interface{}{"tokenToOntSwapOutput", []interface{}{ontdBought, maxTokens, deadline, invoker.Address}}
+		}
+	}
+	return this.sendTrade(invoker, exchange, params)
+}
+
+// tokenToToken sells tokenSold on exchangeSold for tokenBought, through either the tokenToToken or the tokenToExchange
+// methods, as a swap or a transfer, specifying either the input or the output amount
+func (this *ExchangeTest) tokenToToken(invoker *ontology_go_sdk.Account, exchangeSold, tokenSold, exchangeBought, tokenBought common.Address) (bool, error) {
+	balances, err := GetBalances(this.Client, invoker.Address, []common.Address{tokenSold})
+	if err != nil {
+		return false, fmt.Errorf("tokenToToken, err: %v", err)
+	}
+	ontdReserve1, tokenReserve1, _, err := this.exchangeReserves(exchangeSold, tokenSold)
+	if err != nil {
+		return false, fmt.Errorf("tokenToToken, err: %v", err)
+	}
+	ontdReserve2, tokenReserve2, _, err := this.exchangeReserves(exchangeBought, tokenBought)
+	if err != nil {
+		return false, fmt.Errorf("tokenToToken, err: %v", err)
+	}
+	if ontdReserve1.Sign() <= 0 || tokenReserve1.Sign() <= 0 || ontdReserve2.Sign() <= 0 || tokenReserve2.Sign() <= 0 {
+		return false, nil
+	}
+	tokensSold := this.tradeAmount(balances[tokenSold], tokenReserve1)
+	if tokensSold == nil {
+		return false, nil
+	}
+	recipient, transfer := this.recipientFor(invoker)
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
+	// tokenToToken* takes the address of the bought token, tokenToExchange* the address of its exchange
+	method, target := "tokenToToken", tokenBought
+	if this.randIntn(2) == 0 {
+		method, target = "tokenToExchange", exchangeBought
+	}
+
+	ontdBought := inputPrice(tokensSold, tokenReserve1, ontdReserve1)
+	var params []interface{}
+	if this.randIntn(2) == 0 {
+		minOntd, _ := withSlippage(ontdBought)
+		minTokens, _ := withSlippage(inputPrice(ontdBought, ontdReserve2, tokenReserve2))
+		if err := this.ensureAllowance(invoker, tokenSold, exchangeSold, tokensSold); err != nil {
+			return false, fmt.Errorf("tokenToToken, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{method + "TransferInput", []interface{}{tokensSold, minTokens, minOntd, deadline, recipient, target, invoker.Address}}
+		} else {
+			params = []interface{}{method + "SwapInput", []interface{}{tokensSold, minTokens, minOntd, deadline, target, invoker.Address}}
+		}
+	} else {
+		tokensBought := inputPrice(ontdBought, ontdReserve2, tokenReserve2)
+		if tokensBought.Sign() <= 0 {
+			return false, nil
+		}
+		ontdSold := outputPrice(tokensBought, ontdReserve2, tokenReserve2)
+		_, maxOntd := withSlippage(ontdSold)
+		_, maxTokens := withSlippage(outputPrice(ontdSold, tokenReserve1, ontdReserve1))
+		if err := this.ensureAllowance(invoker, tokenSold, exchangeSold, maxTokens); err != nil {
+			return false, fmt.Errorf("tokenToToken, err: %v", err)
+		}
+		if transfer {
+			params = []interface{}{method + "TransferOutput", []interface{}{tokensBought, maxTokens, maxOntd, deadline, recipient, target, invoker.Address}}
+		} else {
+			params = []interface{}{method + "SwapOutput", []interface{}{tokensBought, maxTokens, maxOntd, deadline, target, invoker.Address}}
+		}
+	}
+	return this.sendTrade(invoker, exchangeSold, params)
+}
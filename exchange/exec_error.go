@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExecutionFailedError is a transaction the chain included but executed with State 0
+type ExecutionFailedError struct {
+	TxHash common.Uint256
+	Contract common.Address
+	Method string
+	GasConsumed uint64
+	// Reason is what the failing contract notified, decoded to text where possible
+	Reason string
+}
+
+func (this *ExecutionFailedError) Error() string {
+	reason := this.Reason
+	if reason == "" {
+		reason = "no reason notified"
+	}
+	return fmt.Sprintf("%s of contract: %s failed in tx: %s, gas consumed: %d, reason: %s",
+		this.Method, this.Contract.ToHexString(), this.TxHash.ToHexString(), this.GasConsumed, reason)
+}
+
+// executionError returns an *ExecutionFailedError for a failed result and nil otherwise
+func executionError(result *TxResult, contract common.Address, method string) error {
+	if result.Status != TX_FAILED {
+		return nil
+	}
+	return &ExecutionFailedError{
+		TxHash: result.TxHash,
+		Contract: contract,
+		Method: method,
+		GasConsumed: result.GasConsumed,
+		Reason: notifyReason(result.Notify),
+	}
+}
+
+// notifyReason joins the notify states of a failed transaction, the gas fee transfers of the native contracts are left out
+func notifyReason(notify []*sdkcommon.NotifyEventInfo) string {
+	reasons := make([]string, 0)
+	for _, n := range notify {
+		if n.ContractAddress == ontology_go_sdk.ONG_CONTRACT_ADDRESS.ToHexString() || n.ContractAddress == ontology_go_sdk.ONT_CONTRACT_ADDRESS.ToHexString() {
+			continue
+		}
+		if reason := decodeNotifyState(n.States); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// decodeNotifyState renders a neovm notify state, byte arrays come hex encoded and are shown as text when they are readable
+func decodeNotifyState(state interface{}) string {
+	switch v := state.(type) {
+	case string:
+		if bs, err := hex.DecodeString(v); err == nil && len(bs) > 0 && isReadable(bs) {
+			return string(bs)
+		}
+		return v
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := decodeNotifyState(item); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, ", ")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(state)
+}
+
+func isReadable(bs []byte) bool {
+	if !utf8.Valid(bs) {
+		return false
+	}
+	for _, r := range string(bs) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	"errors"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_NotifyReason(t *testing.T) {
+	notify := []*sdkcommon.NotifyEventInfo{
+		{ContractAddress: "0102", States: []interface{}{hex.EncodeToString([]byte("deadline passed")), "ff00"}},
+		{ContractAddress: ontology_go_sdk.ONG_CONTRACT_ADDRESS.ToHexString(), States: []interface{}{"transfer", "from", "to", 100}},
+		{ContractAddress: "0304", States: hex.EncodeToString([]byte("second"))},
+	}
+	if reason := notifyReason(notify); reason != "deadline passed, ff00; second" {
+		t.Fatalf("reason: %q", reason)
+	}
+}
+
+func Test_ExecutionFailedError(t *testing.T) {
+	if err := executionError(&TxResult{Status: TX_SUCCEEDED}, testEnv.OntdAddr, "approve"); err != nil {
+		t.Fatalf("error for a succeeded tx: %v", err)
+	}
+	// swap more tokens than the pool holds for the least ontd
+	pool, trader := 0, testEnv.Users[1]
+	tokensBought := testEnv.OnChainEState[pool].TokenLiquid
+	err := testEnv.ontToTokenOutput(pool, tokensBought, testEnv.OntdBalance[trader.Address], trader, trader.Address)
+	failed, ok := err.(*ExecutionFailedError)
+	if !ok {
+		t.Fatalf("ontToTokenOutput error: %v, expect an ExecutionFailedError", err)
+	}
+	if failed.Contract != testEnv.OnChainEState[pool].ExchangeAddr || failed.Method != "ontToTokenSwapOutput" || failed.GasConsumed == 0 || failed.Reason == "" {
+		t.Fatalf("failed execution: %+v", failed)
+	}
+	if !strings.Contains(failed.Error(), failed.TxHash.ToHexString()) {
+		t.Fatalf("error does not name the tx: %v", failed)
+	}
+}
+
+func Test_SendTradeExecutionFailed(t *testing.T) {
+	et := &ExchangeTest{Client: testEnv.Client, Waiter: testEnv.Waiter, GasPrice: testEnv.GasPrice, GasLimit: testEnv.GasLimit}
+	pool, trader := 0, testEnv.Users[1]
+	exchange := testEnv.OnChainEState[pool].ExchangeAddr
+	// asks for more tokens than the pool holds
+	minTokens := new(big.Int).Add(testEnv.OnChainEState[pool].TokenLiquid, big.NewInt(1))
+	sent, err := et.sendTrade(trader, exchange, []interface{}{"ontToTokenSwapInput", []interface{}{
+		minTokens, time.Now().Add(time.Minute).Unix(), trader.Address, big.NewInt(1000),
+	}})
+	var failed *ExecutionFailedError
+	if !sent || !errors.As(err, &failed) {
+		t.Fatalf("sendTrade sent: %v, error: %v, expect an ExecutionFailedError", sent, err)
+	}
+	if failed.Contract != exchange || failed.Method != "ontToTokenSwapInput" || !strings.Contains(err.Error(), exchange.ToHexString()) {
+		t.Fatalf("failed trade: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/factory"
+	"strings"
+)
+
+// FactoryEntry is what the factory and the exchange of token id Id say about each other
+type FactoryEntry struct {
+	Id uint64
+	Token common.Address
+	// Exchange is empty when the factory has no exchange for Token
+	Exchange common.Address
+	// FactoryToken is getToken(Exchange) of the factory
+	FactoryToken common.Address
+	// ExchangeToken and ExchangeFactory are tokenAddress() and factoryAddress() of Exchange
+	ExchangeToken common.Address
+	ExchangeFactory common.Address
+}
+
+// Problems lists how the entry does not point back consistently to the factory at factoryAddr
+func (this *FactoryEntry) Problems(factoryAddr common.Address) []string {
+	if this.Exchange == common.ADDRESS_EMPTY {
+		return []string{fmt.Sprintf("token %s has no exchange", this.Token.ToHexString())}
+	}
+	problems := make([]string, 0)
+	if this.FactoryToken != this.Token {
+		problems = append(problems, fmt.Sprintf("getToken(exchange) is %s", this.FactoryToken.ToHexString()))
+	}
+	if this.ExchangeToken != this.Token {
+		problems = append(problems, fmt.Sprintf("tokenAddress() is %s", this.ExchangeToken.ToHexString()))
+	}
+	if this.ExchangeFactory != factoryAddr {
+		problems = append(problems, fmt.Sprintf("factoryAddress() is %s", this.ExchangeFactory.ToHexString()))
+	}
+	return problems
+}
+
+// InconsistentFactoryError lists the factory entries whose exchange does not point back to their token and factory
+type InconsistentFactoryError struct {
+	Factory common.Address
+	Entries []*FactoryEntry
+}
+
+func (this *InconsistentFactoryError) Error() string {
+	items := make([]string, 0, len(this.Entries))
+	for _, entry := range this.Entries {
+		items = append(items, fmt.Sprintf("id %d, token: %s, exchange: %s, %s", entry.Id, entry.Token.ToHexString(),
+			entry.Exchange.ToHexString(), strings.Join(entry.Problems(this.Factory), ", ")))
+	}
+	return fmt.Sprintf("factory: %s has %d inconsistent exchanges: %s", this.Factory.ToHexString(), len(this.Entries), strings.Join(items, "; "))
+}
+
+// refreshFactory walks the factory by token id and fills OnChainFState with every exchange it has ever created.
+// The maps are filled even when some exchanges are inconsistent, those are returned in an *InconsistentFactoryError.
+func (this *TestEnv) refreshFactory() error {
+	entries, err := this.factoryEntries()
+	if err != nil {
+		return fmt.Errorf("refreshFactory, %v", err)
+	}
+	fstate := this.OnChainFState
+	inconsistent := make([]*FactoryEntry, 0)
+	for _, entry := range entries {
+		fstate.IdToTokenAddr[entry.Id] = entry.Token
+		if entry.Exchange != common.ADDRESS_EMPTY {
+			fstate.TokenHahsToExchangeAddr[entry.Token.ToHexString()] = entry.Exchange
+			fstate.ExchangeHashToTokenAddr[entry.Exchange.ToHexString()] = entry.FactoryToken
+		}
+		if len(entry.Problems(fstate.FactoryAddr)) > 0 {
+			inconsistent = append(inconsistent, entry)
+		}
+	}
+	if len(inconsistent) > 0 {
+		return &InconsistentFactoryError{Factory: fstate.FactoryAddr, Entries: inconsistent}
+	}
+	return nil
+}
+
+// factoryEntries reads the entries of all the token ids, the exchanges are read in one batch
+func (this *TestEnv) factoryEntries() ([]*FactoryEntry, error) {
+	count, err := this.Factory.TokenCount()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*FactoryEntry, 0, count)
+	calls := make([]*readCall, 0)
+	for id := uint64(1); id <= count; id++ {
+		entry := &FactoryEntry{Id: id}
+		entries = append(entries, entry)
+		if entry.Token, err = this.Factory.GetTokenWithId(id); err != nil {
+			return nil, err
+		}
+		entry.Exchange, err = this.Factory.GetExchange(entry.Token)
+		if _, ok := err.(*factory.NotFoundError); ok {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// an unknown exchange keeps FactoryToken empty, which Problems reports
+		if entry.FactoryToken, err = this.Factory.GetToken(entry.Exchange); err != nil {
+			if _, ok := err.(*factory.NotFoundError); !ok {
+				return nil, err
+			}
+		}
+		calls = append(calls,
+			&readCall{contract: entry.Exchange, method: "tokenAddress", set: setAddress(func(v common.Address) { entry.ExchangeToken = v })},
+			&readCall{contract: entry.Exchange, method: "factoryAddress", set: setAddress(func(v common.Address) { entry.ExchangeFactory = v })},
+		)
+	}
+	if err := batchRead(this.Client, calls); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/factory"
+	"strings"
+	"testing"
+)
+
+func Test_UniswapFactory(t *testing.T) {
+	f := testEnv.Factory
+	for i := range testEnv.OnChainEState {
+		tokenAddr, exchangeAddr := testEnv.OnChainTState[i].TokenAddr, testEnv.OnChainEState[i].ExchangeAddr
+		if exchange, err := f.GetExchange(tokenAddr); err != nil || exchange != exchangeAddr {
+			t.Fatalf("GetExchange(%s): %s, err: %v", tokenAddr.ToHexString(), exchange.ToHexString(), err)
+		}
+		if token, err := f.GetToken(exchangeAddr); err != nil || token != tokenAddr {
+			t.Fatalf("GetToken(%s): %s, err: %v", exchangeAddr.ToHexString(), token.ToHexString(), err)
+		}
+	}
+	unknown := mockAddr("unknown token")
+	if _, err := f.GetExchange(unknown); err == nil {
+		t.Fatalf("GetExchange of a token without exchange")
+	} else if _, ok := err.(*factory.NotFoundError); !ok {
+		t.Fatalf("GetExchange of a token without exchange: %v", err)
+	}
+	count, err := f.TokenCount()
+	if err != nil || count < uint64(len(testEnv.OnChainEState)) {
+		t.Fatalf("TokenCount: %d, err: %v", count, err)
+	}
+	if _, err := f.GetTokenWithId(count + 1); err == nil {
+		t.Fatalf("GetTokenWithId beyond TokenCount")
+	}
+	template, err := f.ExchangeTemplate()
+	if err != nil {
+		t.Fatalf("ExchangeTemplate of an initialized factory error: %v", err)
+	}
+
+	if testNode == nil {
+		return
+	}
+	// the template is set once
+	txHash, err := f.InitializeFactory(testEnv.Users[0], unknown)
+	if err != nil {
+		t.Fatalf("InitializeFactory error: %v", err)
+	}
+	if result, err := testEnv.Waiter.Wait(txHash); err != nil || result.Status != TX_FAILED {
+		t.Fatalf("second InitializeFactory: %v, err: %v", result, err)
+	}
+	if current, err := f.ExchangeTemplate(); err != nil || current != template {
+		t.Fatalf("ExchangeTemplate after a second InitializeFactory: %s, err: %v", current.ToHexString(), err)
+	}
+	txHash, err = f.CreateExchange(testEnv.Users[0], unknown)
+	if err != nil {
+		t.Fatalf("CreateExchange error: %v", err)
+	}
+	if result, err := testEnv.Waiter.Wait(txHash); err != nil || result.Status != TX_SUCCEEDED {
+		t.Fatalf("CreateExchange: %v, err: %v", result, err)
+	}
+	exchange, err := f.GetExchange(unknown)
+	if err != nil {
+		t.Fatalf("GetExchange of the created exchange error: %v", err)
+	}
+	if token, err := f.GetToken(exchange); err != nil || token != unknown {
+		t.Fatalf("GetToken(%s): %s, err: %v", exchange.ToHexString(), token.ToHexString(), err)
+	}
+	if token, err := f.GetTokenWithId(count + 1); err != nil || token != unknown {
+		t.Fatalf("GetTokenWithId(%d): %s, err: %v", count+1, token.ToHexString(), err)
+	}
+	// the factory creates one exchange per token
+	txHash, err = f.CreateExchange(testEnv.Users[0], unknown)
+	if err != nil {
+		t.Fatalf("CreateExchange error: %v", err)
+	}
+	if result, err := testEnv.Waiter.Wait(txHash); err != nil || result.Status != TX_FAILED {
+		t.Fatalf("second CreateExchange: %v, err: %v", result, err)
+	}
+}
+
+func Test_RefreshFactory(t *testing.T) {
+	env := *testEnv
+	env.OnChainFState = &OnChainFactoryState{
+		FactoryAddr:             testEnv.OnChainFState.FactoryAddr,
+		ExchangeHashToTokenAddr: make(map[string]common.Address),
+		TokenHahsToExchangeAddr: make(map[string]common.Address),
+		IdToTokenAddr:           make(map[uint64]common.Address),
+	}
+	if err := env.refreshFactory(); err != nil {
+		t.Fatalf("refreshFactory error: %v", err)
+	}
+	count, err := env.Factory.TokenCount()
+	if err != nil {
+		t.Fatalf("TokenCount error: %v", err)
+	}
+	fstate := env.OnChainFState
+	if uint64(len(fstate.IdToTokenAddr)) != count || len(fstate.TokenHahsToExchangeAddr) != int(count) {
+		t.Fatalf("%d token ids, %d exchanges of %d", len(fstate.IdToTokenAddr), len(fstate.TokenHahsToExchangeAddr), count)
+	}
+	for i := range env.OnChainEState {
+		tokenAddr, exchangeAddr := env.OnChainTState[i].TokenAddr, env.OnChainEState[i].ExchangeAddr
+		if fstate.TokenHahsToExchangeAddr[tokenAddr.ToHexString()] != exchangeAddr || fstate.ExchangeHashToTokenAddr[exchangeAddr.ToHexString()] != tokenAddr {
+			t.Fatalf("pair %d missing in the enumeration", i)
+		}
+	}
+}
+
+func Test_FactoryEntryProblems(t *testing.T) {
+	factoryAddr, token, exchange := mockAddr("factory"), mockAddr("token"), mockAddr("exchange")
+	entry := &FactoryEntry{Id: 1, Token: token, Exchange: exchange, FactoryToken: token, ExchangeToken: token, ExchangeFactory: factoryAddr}
+	if problems := entry.Problems(factoryAddr); len(problems) != 0 {
+		t.Fatalf("problems of a consistent entry: %v", problems)
+	}
+	entry.ExchangeToken, entry.ExchangeFactory = mockAddr("other token"), mockAddr("other factory")
+	if problems := entry.Problems(factoryAddr); len(problems) != 2 {
+		t.Fatalf("problems of an exchange pointing elsewhere: %v", problems)
+	}
+	missing := &FactoryEntry{Id: 2, Token: token}
+	if problems := missing.Problems(factoryAddr); len(problems) != 1 || !strings.Contains(problems[0], "no exchange") {
+		t.Fatalf("problems of a token without exchange: %v", problems)
+	}
+	err := &InconsistentFactoryError{Factory: factoryAddr, Entries: []*FactoryEntry{entry, missing}}
+	if !strings.Contains(err.Error(), "factoryAddress() is") || !strings.Contains(err.Error(), "2 inconsistent") {
+		t.Fatalf("error: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	nutils "github.com/ontio/ontology/smartcontract/service/native/utils"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GasUsage is the gas paid by the transactions of one operation type
+type GasUsage struct {
+	Txs uint64
+	Gas uint64
+}
+
+// GasLedger sums up the gas consumed by every confirmed transaction, per payer and per operation type
+type GasLedger struct {
+	lock sync.Mutex
+	byPayer map[common.Address]uint64
+	byOperation map[string]*GasUsage
+}
+
+func NewGasLedger() *GasLedger {
+	return &GasLedger{
+		byPayer: make(map[common.Address]uint64),
+		byOperation: make(map[string]*GasUsage),
+	}
+}
+
+func (this *GasLedger) Record(operation string, payer common.Address, gas uint64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.byPayer[payer] += gas
+	usage, ok := this.byOperation[operation]
+	if !ok {
+		usage = &GasUsage{}
+		this.byOperation[operation] = usage
+	}
+	usage.Txs++
+	usage.Gas += gas
+}
+
+// PaidBy returns the gas payer paid so far
+func (this *GasLedger) PaidBy(payer common.Address) uint64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.byPayer[payer]
+}
+
+// Operation returns the gas paid for operation so far
+func (this *GasLedger) Operation(operation string) GasUsage {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if usage, ok := this.byOperation[operation]; ok {
+		return *usage
+	}
+	return GasUsage{}
+}
+
+// Report lists the gas spent per operation type and the total
+func (this *GasLedger) Report() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	operations := make([]string, 0, len(this.byOperation))
+	for operation := range this.byOperation {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+	lines := make([]string, 0, len(operations)+1)
+	total := GasUsage{}
+	for _, operation := range operations {
+		usage := this.byOperation[operation]
+		lines = append(lines, fmt.Sprintf("%s: %d txs, gas: %d", operation, usage.Txs, usage.Gas))
+		total.Txs += usage.Txs
+		total.Gas += usage.Gas
+	}
+	lines = append(lines, fmt.Sprintf("total: %d txs, gas: %d", total.Txs, total.Gas))
+	return strings.Join(lines, "\n")
+}
+
+// chargeGas records the gas of result against payer. When ONG is the quote asset the fee also leaves the ontd balance
+// of payer, so it is taken off the simulator and, with check not nil, expected by check whether the operation
+// executed or not. It has to be called before the state is refreshed after the transaction.
+func (this *TestEnv) chargeGas(check *swapCheck, operation string, payer common.Address, result *TxResult) {
+	this.Gas.Record(operation, payer, result.GasConsumed)
+	if this.OntdAddr != ontology_go_sdk.ONG_CONTRACT_ADDRESS || result.GasConsumed == 0 {
+		return
+	}
+	fee := new(big.Int).SetUint64(result.GasConsumed)
+	if err := this.Simulator.Ontd.Transfer(payer, nutils.GovernanceContractAddress, fee); err != nil {
+		mirrorResult(operation+" gas", err)
+	}
+	if check != nil {
+		check.charge(fmt.Sprintf("ontd balance of %s", payer.ToBase58()), func() *big.Int {
+			return this.OntdBalance[payer]
+		}, fee)
+	}
+}
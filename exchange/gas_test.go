@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_GasLedger(t *testing.T) {
+	ledger := NewGasLedger()
+	a, b := mockAddr("payer a"), mockAddr("payer b")
+	ledger.Record("approve", a, 10)
+	ledger.Record("approve", b, 20)
+	ledger.Record("addLiquid", a, 5)
+	if ledger.PaidBy(a) != 15 || ledger.PaidBy(b) != 20 {
+		t.Fatalf("paid by a: %d, b: %d", ledger.PaidBy(a), ledger.PaidBy(b))
+	}
+	if usage := ledger.Operation("approve"); usage.Txs != 2 || usage.Gas != 30 {
+		t.Fatalf("approve usage: %+v", usage)
+	}
+	if report := ledger.Report(); !strings.Contains(report, "approve: 2 txs, gas: 30") || !strings.Contains(report, "total: 3 txs, gas: 35") {
+		t.Fatalf("report:\n%s", report)
+	}
+}
+
+func Test_SwapCheckCharge(t *testing.T) {
+	balance := big.NewInt(1000)
+	check := newSwapCheck("swap")
+	check.expect("balance", func() *big.Int { return balance }, big.NewInt(-100))
+	check.charge("balance", func() *big.Int { return balance }, big.NewInt(7))
+	// the fee is paid by a swap that is not executed as well
+	balance = big.NewInt(993)
+	if err := check.verify(false); err != nil {
+		t.Fatalf("fee of a failed swap: %v", err)
+	}
+	balance = big.NewInt(893)
+	if err := check.verify(true); err != nil {
+		t.Fatalf("fee of an executed swap: %v", err)
+	}
+}
+
+func Test_GasCharged(t *testing.T) {
+	pool, trader := 2, testEnv.Users[1]
+	if err := testEnv.ensureOntdAllowance(pool, trader, big.NewInt(100)); err != nil {
+		t.Fatalf("ensureOntdAllowance error: %v", err)
+	}
+	ong := NewAsset(testEnv.Client, ontology_go_sdk.ONG_CONTRACT_ADDRESS)
+	ongBefore, err := ong.BalanceOf(trader.Address)
+	if err != nil {
+		t.Fatalf("BalanceOf error: %v", err)
+	}
+	paid, usage := testEnv.Gas.PaidBy(trader.Address), testEnv.Gas.Operation("ontToTokenInput")
+	if err := testEnv.ontToTokenInput(pool, big.NewInt(100), big.NewInt(1), trader, trader.Address); err != nil {
+		t.Fatalf("ontToTokenInput error: %v", err)
+	}
+	ongAfter, err := ong.BalanceOf(trader.Address)
+	if err != nil {
+		t.Fatalf("BalanceOf error: %v", err)
+	}
+	ongPaid := new(big.Int).Sub(ongBefore, ongAfter)
+	if fee := testEnv.Gas.PaidBy(trader.Address) - paid; fee == 0 || ongPaid.Cmp(new(big.Int).SetUint64(fee)) != 0 {
+		t.Fatalf("gas recorded: %d, ong paid: %v", fee, ongPaid)
+	}
+	if after := testEnv.Gas.Operation("ontToTokenInput"); after.Txs != usage.Txs+1 {
+		t.Fatalf("ontToTokenInput usage: %+v -> %+v", usage, after)
+	}
+}
+
+func Test_GasChargedOngQuote(t *testing.T) {
+	node, env, err := setupMockEnvWithQuote(ontology_go_sdk.ONG_CONTRACT_ADDRESS)
+	if err != nil {
+		t.Fatalf("setupMockEnvWithQuote error: %v", err)
+	}
+	defer node.Close()
+	ong := NewAsset(env.Client, ontology_go_sdk.ONG_CONTRACT_ADDRESS)
+	// spent checks that run took exactly amount and the gas recorded for payer out of its ONG
+	spent := func(payer common.Address, amount *big.Int, run func() error) {
+		before, err := ong.BalanceOf(payer)
+		if err != nil {
+			t.Fatalf("BalanceOf error: %v", err)
+		}
+		paid := env.Gas.PaidBy(payer)
+		if err := run(); err != nil {
+			t.Fatalf("ong quoted operation error: %v", err)
+		}
+		after, err := ong.BalanceOf(payer)
+		if err != nil {
+			t.Fatalf("BalanceOf error: %v", err)
+		}
+		fee := env.Gas.PaidBy(payer) - paid
+		expect := new(big.Int).Add(amount, new(big.Int).SetUint64(fee))
+		if fee == 0 || new(big.Int).Sub(before, after).Cmp(expect) != 0 {
+			t.Fatalf("ong paid: %v, expect %v of which %d gas", new(big.Int).Sub(before, after), expect, fee)
+		}
+	}
+
+	pool, trader := 0, env.Users[1]
+	ontdSold := big.NewInt(100000)
+	spent(trader.Address, ontdSold, func() error {
+		return env.ontToTokenInput(pool, ontdSold, big.NewInt(1), trader, trader.Address)
+	})
+	provider, ontdAmt := env.OnChainEState[pool].Providers[0], big.NewInt(1000000)
+	exState := env.OnChainEState[pool]
+	maxTokens := new(big.Int).Div(new(big.Int).Mul(ontdAmt, exState.TokenLiquid), exState.OntdLiquid)
+	spent(provider.Address, ontdAmt, func() error {
+		return env.addLiquid(pool, big.NewInt(1), maxTokens.Add(maxTokens, big.NewInt(1)), ontdAmt)
+	})
+}
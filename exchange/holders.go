@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+)
+
+// shareHolders returns the addresses whose shares of pool are read: the users, the providers and the discovered holders
+func (this *TestEnv) shareHolders(pool int) []common.Address {
+	exState := this.OnChainEState[pool]
+	holders := make([]common.Address, 0)
+	seen := make(map[common.Address]bool)
+	add := func(addr common.Address) {
+		if !seen[addr] {
+			seen[addr] = true
+			holders = append(holders, addr)
+		}
+	}
+	for _, user := range this.Users {
+		add(user.Address)
+	}
+	for _, otherUser := range this.OtherUsers {
+		add(otherUser)
+	}
+	for _, provider := range exState.Providers {
+		add(provider.Address)
+	}
+	for holder := range exState.Holders {
+		add(holder)
+	}
+	return holders
+}
+
+// SetProviders makes addLiquid deposit for providers on pool, their shares are tracked from the next refresh
+func (this *TestEnv) SetProviders(pool int, providers ...*ontology_go_sdk.Account) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("SetProviders, %v", err)
+	}
+	if len(providers) == 0 {
+		return fmt.Errorf("SetProviders, pool %d needs at least one provider", pool)
+	}
+	this.OnChainEState[pool].Providers = providers
+	return nil
+}
+
+// TrackShareHolders adds holders to the addresses whose shares of pool are refreshed
+func (this *TestEnv) TrackShareHolders(pool int, holders ...common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("TrackShareHolders, %v", err)
+	}
+	for _, holder := range holders {
+		this.OnChainEState[pool].Holders[holder] = true
+	}
+	return nil
+}
+
+// discoverShareHolders tracks the providers of AddLiquidity and the receivers of share transfers in the events of result
+func (this *TestEnv) discoverShareHolders(result *TxResult) error {
+	events, err := result.Events()
+	if err != nil {
+		return fmt.Errorf("discoverShareHolders, %v", err)
+	}
+	for _, event := range events {
+		var exchange, holder common.Address
+		switch e := event.(type) {
+		case *AddLiquidityEvent:
+			exchange, holder = e.Contract, e.Provider
+		case *TransferEvent:
+			exchange, holder = e.Contract, e.To
+		default:
+			continue
+		}
+		// the shares burnt go to the empty address
+		if holder == common.ADDRESS_EMPTY {
+			continue
+		}
+		for i := range this.OnChainEState {
+			if this.OnChainEState[i].ExchangeAddr == exchange {
+				this.OnChainEState[i].Holders[holder] = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"testing"
+)
+
+func Test_OtherProvider(t *testing.T) {
+	pool, provider := 2, testEnv.Users[1]
+	providers := testEnv.OnChainEState[pool].Providers
+	defer func() { testEnv.OnChainEState[pool].Providers = providers }()
+	if err := testEnv.SetProviders(pool, provider); err != nil {
+		t.Fatalf("SetProviders error: %v", err)
+	}
+	if err := testEnv.addLiquid(pool, big.NewInt(1), big.NewInt(100000), big.NewInt(40000)); err != nil {
+		t.Fatalf("addLiquid error: %v", err)
+	}
+	share := bigOrZero(testEnv.OnChainEState[pool].ShareBalance[provider.Address])
+	if share.Sign() <= 0 {
+		t.Fatalf("share balance of %s: %v", provider.Address.ToBase58(), share)
+	}
+	if err := testEnv.removeLiquid(pool, share, big.NewInt(1), big.NewInt(1), provider); err != nil {
+		t.Fatalf("removeLiquid error: %v", err)
+	}
+	if share := testEnv.OnChainEState[pool].ShareBalance[provider.Address]; share.Sign() != 0 {
+		t.Fatalf("share balance after removing all: %v", share)
+	}
+}
+
+func Test_DiscoverShareHolders(t *testing.T) {
+	pool, holder := 0, mockAddr("holder")
+	exchange := testEnv.OnChainEState[pool].ExchangeAddr
+	transfer := func(to common.Address) *sdkcommon.NotifyEventInfo {
+		from := testEnv.Users[0].Address
+		return &sdkcommon.NotifyEventInfo{ContractAddress: exchange.ToHexString(), States: []interface{}{
+			hex.EncodeToString([]byte("transfer")), hex.EncodeToString(from[:]), hex.EncodeToString(to[:]), hex.EncodeToString(common.BigIntToNeoBytes(big.NewInt(1))),
+		}}
+	}
+	result := &TxResult{Notify: []*sdkcommon.NotifyEventInfo{transfer(holder), transfer(common.ADDRESS_EMPTY)}}
+	if err := testEnv.discoverShareHolders(result); err != nil {
+		t.Fatalf("discoverShareHolders error: %v", err)
+	}
+	defer delete(testEnv.OnChainEState[pool].Holders, holder)
+	if !testEnv.OnChainEState[pool].Holders[holder] || testEnv.OnChainEState[pool].Holders[common.ADDRESS_EMPTY] {
+		t.Fatalf("holders: %v", testEnv.OnChainEState[pool].Holders)
+	}
+	if err := testEnv.refreshPools(pool); err != nil {
+		t.Fatalf("refreshPools error: %v", err)
+	}
+	if share, ok := testEnv.OnChainEState[pool].ShareBalance[holder]; !ok || share.Sign() != 0 {
+		t.Fatalf("share of a discovered holder: %v", share)
+	}
+	if err := testEnv.TrackShareHolders(len(testEnv.OnChainEState), holder); err == nil {
+		t.Fatalf("TrackShareHolders accepts an index out of range")
+	}
+}
+
+func Test_ConfirmedDiscoversShareHolders(t *testing.T) {
+	pool, holder := 0, mockAddr("confirmed holder")
+	exchange, from := testEnv.OnChainEState[pool].ExchangeAddr, testEnv.Users[0].Address
+	result := &TxResult{Status: TX_SUCCEEDED, Notify: []*sdkcommon.NotifyEventInfo{{ContractAddress: exchange.ToHexString(), States: []interface{}{
+		hex.EncodeToString([]byte("transfer")), hex.EncodeToString(from[:]), hex.EncodeToString(holder[:]), hex.EncodeToString(common.BigIntToNeoBytes(big.NewInt(1))),
+	}}}}
+	if err := testEnv.confirmed(nil, "transfer", from, result); err != nil {
+		t.Fatalf("confirmed error: %v", err)
+	}
+	defer delete(testEnv.OnChainEState[pool].Holders, holder)
+	if !testEnv.OnChainEState[pool].Holders[holder] {
+		t.Fatalf("holder of a confirmed share transfer not tracked: %v", testEnv.OnChainEState[pool].Holders)
+	}
+}
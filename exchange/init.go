@@ -18,17 +18,18 @@
 package exchange
 
 import (
-	"encoding/hex"
 	"fmt"
 	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
 	"github.com/ontio/ontology/common"
 	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"github.com/skyinglyh1/uniswap_v1_test/factory"
 	"github.com/skyinglyh1/uniswap_v1_test/log"
 	"github.com/skyinglyh1/uniswap_v1_test/utils"
 	"math/big"
 	"time"
 )
 
+// testEnv is built by TestMain, against a MockNode unless ONT_TEST_CONFIG names a config file
 var testEnv *TestEnv
 
 type OnChainFactoryState struct {
@@ -38,15 +39,28 @@ type OnChainFactoryState struct {
 	IdToTokenAddr map[uint64]common.Address
 }
 
+func newFactoryState(factoryAddr common.Address) *OnChainFactoryState {
+	return &OnChainFactoryState{
+		FactoryAddr:             factoryAddr,
+		ExchangeHashToTokenAddr: make(map[string]common.Address),
+		TokenHahsToExchangeAddr: make(map[string]common.Address),
+		IdToTokenAddr:           make(map[uint64]common.Address),
+	}
+}
+
 type OnChainExchangeState struct {
 	ExchangeAddr common.Address
 	TokenAddr common.Address
 	FactoryAddr common.Address
+	// Providers are the accounts addLiquid deposits for
 	Providers []*ontology_go_sdk.Account
 	OntdLiquid *big.Int
 	TokenLiquid *big.Int
+	// ShareBalance holds the shares of every user, provider and discovered holder
 	ShareBalance map[common.Address]*big.Int
 	ShareSupply *big.Int
+	// Holders are the share holders found in the events besides the users and providers
+	Holders map[common.Address]bool
 }
 
 type OnChainTokenState struct {
@@ -59,11 +73,16 @@ type OnChainTokenState struct {
 
 
 type TestEnv struct {
-	Sdk *ontology_go_sdk.OntologySdk
+	Client Client
+	// Invoker checks the invocations of the contracts in the manifest of the config, Client sends none it rejects
+	Invoker *AbiInvoker
+	Waiter *TxWaiter
 	OntdAddr common.Address
 	Users []*ontology_go_sdk.Account
 	OtherUsers []common.Address
 
+	// Factory reads and creates the exchanges of the factory at OnChainFState.FactoryAddr
+	Factory *factory.UniswapFactory
 	OnChainFState *OnChainFactoryState
 	OnChainTState []*OnChainTokenState
 	OnChainEState []*OnChainExchangeState
@@ -71,7 +90,8 @@ type TestEnv struct {
 	OffChainFState *OnChainFactoryState
 	OffChainTState []*OnChainTokenState
 	OffChainEState []*OnChainExchangeState
-
+	// Simulator mirrors every operation sent on chain, OffChain*State are refreshed from it
+	Simulator *OffChainSimulator
 
 	OntdBalance map[common.Address]*big.Int
 	OntdAllowance map[common.Address]map[common.Address]*big.Int
@@ -79,164 +99,200 @@ type TestEnv struct {
 	GasPrice uint64
 	GasLimit uint64
 	WaitTxTimeOut time.Duration
+	// Gas sums up the gas paid by the transactions of the helpers
+	Gas *GasLedger
+}
 
+// TestEnvOption customizes how NewTestEnv reaches the node and which accounts sign
+type TestEnvOption func(*testEnvOptions)
+
+type testEnvOptions struct {
+	client Client
+	accts []*ontology_go_sdk.Account
+	enumerateFactory bool
 }
 
-func init(){
-	log.InitLog(1, log.Stdout)
-	if err := config.DefConfig.Init("../config.json"); err != nil {
-		log.Errorf("DefConfig.Init error:", err)
-		return
+// WithClient makes the TestEnv talk to client instead of the rpc node at cfg.OntRpcAddress
+func WithClient(client Client) TestEnvOption {
+	return func(opts *testEnvOptions) {
+		opts.client = client
 	}
-	sdk, accts, err := utils.GetSdkAndAccount(config.DefConfig.OntRpcAddress, config.DefConfig.WalletPath, config.DefConfig.AcctPwd)
-	if err != nil {
-		fmt.Printf("GetSdkAndAccount error: %v", err)
-		return
+}
+
+// WithAccounts makes the TestEnv sign with accts instead of the accounts in cfg.WalletPath
+func WithAccounts(accts []*ontology_go_sdk.Account) TestEnvOption {
+	return func(opts *testEnvOptions) {
+		opts.accts = accts
 	}
-	factoryHash, err := common.AddressFromHexString(config.DefConfig.FactoryHash)
-	if err != nil {
-		log.Errorf("Exchange1Hash: %s, AddressFromHexString error: %v", config.DefConfig.FactoryHash, err)
-		return
+}
+
+// WithFactoryEnumeration makes NewTestEnv load every exchange the factory has created into OnChainFState,
+// the exchanges that do not point back to their token and factory are logged
+func WithFactoryEnumeration() TestEnvOption {
+	return func(opts *testEnvOptions) {
+		opts.enumerateFactory = true
+	}
+}
+
+// NewTestEnv builds the test environment of every token/exchange pair in cfg and loads their state from the node
+func NewTestEnv(cfg *config.Config, opts ...TestEnvOption) (*TestEnv, error) {
+	options := &testEnvOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.client == nil {
+		options.client = NewRpcClient(cfg.OntRpcAddress)
+	}
+	if options.accts == nil {
+		accts, err := utils.GetAccounts(cfg.WalletPath, cfg.AcctPwd)
+		if err != nil {
+			return nil, fmt.Errorf("NewTestEnv, %v", err)
+		}
+		options.accts = accts
 	}
-	ontdHash, err := common.AddressFromHexString(config.DefConfig.OntdHash)
+	if len(options.accts) == 0 {
+		return nil, fmt.Errorf("NewTestEnv, no account to sign")
+	}
+	client, accts := options.client, options.accts
+
+	factoryHash, err := common.AddressFromHexString(cfg.FactoryHash)
 	if err != nil {
-		log.Errorf("OntdHash: %s, AddressFromHexString error: %v", config.DefConfig.OntdHash, err)
-		return
+		return nil, fmt.Errorf("NewTestEnv, FactoryHash: %s, AddressFromHexString error: %v", cfg.FactoryHash, err)
 	}
-	token1Hash, err := common.AddressFromHexString(config.DefConfig.Token1Hash)
+	ontdHash, err := common.AddressFromHexString(cfg.OntdHash)
 	if err != nil {
-		log.Errorf("Exchange1Hash: %s, AddressFromHexString error: %v", config.DefConfig.Token1Hash, err)
-		return
+		return nil, fmt.Errorf("NewTestEnv, OntdHash: %s, AddressFromHexString error: %v", cfg.OntdHash, err)
 	}
-	exchange1Hash, err := common.AddressFromHexString(config.DefConfig.Exchange1Hash)
+	tokenHashes, exchangeHashes, err := ParsePairs(cfg.Pairs)
 	if err != nil {
-		log.Errorf("Exchange1Hash: %s, AddressFromHexString error: %v", config.DefConfig.Exchange1Hash, err)
-		return
+		return nil, fmt.Errorf("NewTestEnv, %v", err)
+	}
+	invoker := NewAbiInvoker()
+	if cfg.ManifestPath != "" {
+		manifest, err := utils.LoadManifest(cfg.ManifestPath)
+		if err != nil {
+			return nil, fmt.Errorf("NewTestEnv, %v", err)
+		}
+		if invoker, err = NewManifestInvoker(manifest, exchangeHashes); err != nil {
+			return nil, fmt.Errorf("NewTestEnv, %v", err)
+		}
+		client = &abiClient{Client: client, invoker: invoker}
 	}
 
-	ofs := &OnChainFactoryState{
-		FactoryAddr:             factoryHash,
-		ExchangeHashToTokenAddr: make(map[string]common.Address),
-		TokenHahsToExchangeAddr: make(map[string]common.Address),
-		IdToTokenAddr:           make(map[uint64]common.Address),
+	env := &TestEnv{
+		Client: client,
+		Invoker: invoker,
+		Waiter: NewTxWaiter(client, time.Duration(cfg.WaitTxTimeOut) * time.Second),
+		OntdAddr: ontdHash,
+		Users: accts,
+		Factory: factory.NewUniswapFactory(client, factoryHash, cfg.GasPrice, cfg.GasLimit),
+		OnChainFState: newFactoryState(factoryHash),
+		OffChainFState: newFactoryState(factoryHash),
+		GasPrice: cfg.GasPrice,
+		GasLimit: cfg.GasLimit,
+		WaitTxTimeOut: time.Duration(cfg.WaitTxTimeOut) * time.Second,
+		Gas: NewGasLedger(),
+		OntdBalance: make(map[common.Address]*big.Int),
+		OntdAllowance: make(map[common.Address]map[common.Address]*big.Int),
 	}
-	ots1 := &OnChainTokenState{
-		TokenAddr: token1Hash,
-		Balances: make(map[common.Address]*big.Int),
-		Allowances: make(map[common.Address]*big.Int),
+	for i := range tokenHashes {
+		env.OnChainTState = append(env.OnChainTState, newTokenState(tokenHashes[i]))
+		env.OnChainEState = append(env.OnChainEState, newExchangeState(exchangeHashes[i]))
+		env.OffChainTState = append(env.OffChainTState, newTokenState(tokenHashes[i]))
+		env.OffChainEState = append(env.OffChainEState, newExchangeState(exchangeHashes[i]))
+		env.OnChainEState[i].Providers = []*ontology_go_sdk.Account{accts[0]}
 	}
 
-	oes1 := &OnChainExchangeState{
-		ExchangeAddr: exchange1Hash,
-		ShareBalance: make(map[common.Address]*big.Int),
-	}
-	if config.DefConfig.Token2Hash != "" {
-		token2Hash, err := common.AddressFromHexString(config.DefConfig.Token2Hash)
-		if err != nil {
-			log.Errorf("Exchange1Hash: %s, AddressFromHexString error: %v", config.DefConfig.Token2Hash, err)
-			return
-		}
-		exchange2Hash, err := common.AddressFromHexString(config.DefConfig.Exchange2Hash)
+	for _, otherUser := range cfg.OtherUsers {
+		userAddr, err := common.AddressFromBase58(otherUser)
 		if err != nil {
-			log.Errorf("Exchange1Hash: %s, AddressFromHexString error: %v", config.DefConfig.Exchange2Hash, err)
-			return
+			return nil, fmt.Errorf("NewTestEnv, OtherUser: %s, AddressFromBase58 error: %v", otherUser, err)
 		}
+		env.OtherUsers = append(env.OtherUsers, userAddr)
+	}
 
-		ots2 := &OnChainTokenState{
-			TokenAddr: token2Hash,
-			Balances: make(map[common.Address]*big.Int),
-			Allowances: make(map[common.Address]*big.Int),
+	if err := env.refreshFstate(); err != nil {
+		return nil, fmt.Errorf("NewTestEnv, %v", err)
+	}
+	if options.enumerateFactory {
+		if err := env.refreshFactory(); err != nil {
+			if _, ok := err.(*InconsistentFactoryError); !ok {
+				return nil, fmt.Errorf("NewTestEnv, %v", err)
+			}
+			log.Warnf("NewTestEnv, %v", err)
 		}
+	}
+	if err := env.refreshAcctBalance(); err != nil {
+		return nil, fmt.Errorf("NewTestEnv, %v", err)
+	}
+	env.Simulator = env.newSimulator()
+	env.refreshOffChainState()
+	return env, nil
+}
 
-		oes2 := &OnChainExchangeState{
-			ExchangeAddr: exchange2Hash,
-			ShareBalance: make(map[common.Address]*big.Int),
+// ParsePairs returns the token and exchange addresses of pairs, at least one pair is required
+func ParsePairs(pairs []*config.Pair) ([]common.Address, []common.Address, error) {
+	if len(pairs) == 0 {
+		return nil, nil, fmt.Errorf("ParsePairs, no token/exchange pair configured")
+	}
+	tokens, exchanges := make([]common.Address, 0, len(pairs)), make([]common.Address, 0, len(pairs))
+	seen := make(map[common.Address]bool)
+	for i, pair := range pairs {
+		tokenAddr, err := common.AddressFromHexString(pair.TokenHash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ParsePairs, pair %d, TokenHash: %s, AddressFromHexString error: %v", i, pair.TokenHash, err)
 		}
-		testEnv = &TestEnv{
-			Sdk: sdk,
-			Users: accts,
-			OnChainFState: ofs,
-			OnChainTState: []*OnChainTokenState{ots1, ots2},
-			OnChainEState: []*OnChainExchangeState{oes1, oes2},
-			OffChainFState: ofs,
-			OffChainTState: []*OnChainTokenState{ots1, ots2},
-			OffChainEState: []*OnChainExchangeState{oes1, oes2},
-			GasPrice: config.DefConfig.GasPrice,
-			GasLimit: config.DefConfig.GasLimit,
-			WaitTxTimeOut: time.Duration(config.DefConfig.WaitTxTimeOut) * time.Second,
-			OntdBalance: make(map[common.Address]*big.Int),
+		exchangeAddr, err := common.AddressFromHexString(pair.ExchangeHash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ParsePairs, pair %d, ExchangeHash: %s, AddressFromHexString error: %v", i, pair.ExchangeHash, err)
 		}
-	} else {
-
-		testEnv = &TestEnv{
-			Sdk: sdk,
-			Users: accts,
-			OnChainFState: ofs,
-			OnChainTState: []*OnChainTokenState{ots1},
-			OnChainEState: []*OnChainExchangeState{oes1},
-			OffChainFState: ofs,
-			OffChainTState: []*OnChainTokenState{ots1},
-			OffChainEState: []*OnChainExchangeState{oes1},
-			GasPrice: config.DefConfig.GasPrice,
-			GasLimit: config.DefConfig.GasLimit,
-			WaitTxTimeOut: time.Duration(config.DefConfig.WaitTxTimeOut) * time.Second,
-			OntdBalance: make(map[common.Address]*big.Int),
+		if seen[tokenAddr] || seen[exchangeAddr] {
+			return nil, nil, fmt.Errorf("ParsePairs, pair %d, token: %s or exchange: %s is listed twice", i, pair.TokenHash, pair.ExchangeHash)
 		}
+		seen[tokenAddr], seen[exchangeAddr] = true, true
+		tokens, exchanges = append(tokens, tokenAddr), append(exchanges, exchangeAddr)
 	}
+	return tokens, exchanges, nil
+}
 
-	testEnv.OntdAddr = ontdHash
-	testEnv.OntdAllowance = make(map[common.Address]map[common.Address]*big.Int)
-
-
-	for _, otherUser := range config.DefConfig.OtherUsers {
-		userAddr, _ := common.AddressFromBase58(otherUser)
-		testEnv.OtherUsers = append(testEnv.OtherUsers, userAddr)
+func newTokenState(tokenAddr common.Address) *OnChainTokenState {
+	return &OnChainTokenState{
+		TokenAddr: tokenAddr,
+		Balances: make(map[common.Address]*big.Int),
+		Allowances: make(map[common.Address]*big.Int),
 	}
+}
 
-	if err := testEnv.refreshFstate(); err != nil {
-		log.Errorf("refreshFstate error: %v", err)
-		return
-	}
-	if err := testEnv.refreshAcctBalance(); err != nil {
-		log.Errorf("refreshAcctBalance error: %v", err)
-		return
+func newExchangeState(exchangeAddr common.Address) *OnChainExchangeState {
+	return &OnChainExchangeState{
+		ExchangeAddr: exchangeAddr,
+		ShareBalance: make(map[common.Address]*big.Int),
+		Holders: make(map[common.Address]bool),
 	}
 }
 
 
 func (this *TestEnv) refreshFstate() error {
 	for i := 0; i < len(this.OnChainTState); i++ {
-		tokenHash := common.ToArrayReverse(this.OnChainTState[i].TokenAddr[:])
-		res, err := GetMethod(this.Sdk, this.OnChainFState.FactoryAddr, "getExchange", []interface{}{tokenHash})
+		tokenAddr, exchangeAddr := this.OnChainTState[i].TokenAddr, this.OnChainEState[i].ExchangeAddr
+		exchange, err := this.Factory.GetExchange(tokenAddr)
 		if err != nil {
-			return fmt.Errorf("refreshFstate, getExchange err: %v", err)
+			return fmt.Errorf("refreshFstate, %v", err)
 		}
-		exchange, err := common.AddressParseFromBytes(res)
-		if err != nil{
-			return fmt.Errorf("refreshFstate, getExchange err: %v", err)
+		if exchange != exchangeAddr {
+			return fmt.Errorf("refreshFstate, getExchange(%s): %s != config.ExchangeAddr: %s", tokenAddr.ToHexString(), exchange.ToHexString(), exchangeAddr.ToHexString())
 		}
-		if exchange != this.OnChainEState[i].ExchangeAddr {
-			return fmt.Errorf("refreshFstate, getExchange(%x): %x != config.ExchangeAddr: %x", tokenHash, exchange[:], this.OnChainEState[i].ExchangeAddr[:])
-		}
-		this.OnChainFState.TokenHahsToExchangeAddr[hex.EncodeToString(tokenHash)] = exchange
-
+		this.OnChainFState.TokenHahsToExchangeAddr[tokenAddr.ToHexString()] = exchange
 
-		exchangeHash := common.ToArrayReverse(this.OnChainEState[i].ExchangeAddr[:])
-		res1, err := GetMethod(this.Sdk, this.OnChainFState.FactoryAddr, "getToken", []interface{}{exchangeHash})
+		token, err := this.Factory.GetToken(exchangeAddr)
 		if err != nil {
-			return fmt.Errorf("refreshFstate, getToken err: %v", err)
+			return fmt.Errorf("refreshFstate, %v", err)
 		}
-		tokenAddr, err := common.AddressParseFromBytes(res1)
-		if err != nil{
-			return fmt.Errorf("refreshFstate, getToken err: %v", err)
+		if token != tokenAddr {
+			return fmt.Errorf("refreshFstate, getToken(%s): %s != config.TokenAddr: %s", exchangeAddr.ToHexString(), token.ToHexString(), tokenAddr.ToHexString())
 		}
-		if tokenAddr != this.OnChainTState[i].TokenAddr {
-			return fmt.Errorf("refreshFstate, getToken(%x): %x != config.TokenAddr: %x", exchangeHash, tokenAddr[:], this.OnChainTState[i].TokenAddr[:])
-		}
-		this.OnChainFState.ExchangeHashToTokenAddr[hex.EncodeToString(exchangeHash)] = exchange
-
+		this.OnChainFState.ExchangeHashToTokenAddr[exchangeAddr.ToHexString()] = token
 	}
-
 	return nil
 }
 
@@ -331,7 +387,34 @@ func (this *TestEnv) refreshFstate() error {
 
 
 
+// refreshAcctBalance reloads the state of every pool and user in one batch of pre-executed reads
 func (this *TestEnv) refreshAcctBalance() error {
+	pools := make([]int, 0, len(this.OnChainEState))
+	for i := range this.OnChainEState {
+		pools = append(pools, i)
+	}
+	if err := this.refreshState(pools, true); err != nil {
+		return fmt.Errorf("refreshAcctBal, %v", err)
+	}
+	return nil
+}
+
+// refreshPools reloads only what an operation on pools can change: their reserves, token and share supplies,
+// and the ontd, token and share balances and allowances of the users for them
+func (this *TestEnv) refreshPools(pools ...int) error {
+	for _, pool := range pools {
+		if err := this.checkPool(pool); err != nil {
+			return fmt.Errorf("refreshPools, %v", err)
+		}
+	}
+	if err := this.refreshState(pools, false); err != nil {
+		return fmt.Errorf("refreshPools, %v", err)
+	}
+	return nil
+}
+
+// refreshState reads the state of pools, with the token and factory of the exchanges when meta is set
+func (this *TestEnv) refreshState(pools []int, meta bool) error {
 	userAddrs := make([]common.Address, 0)
 	for _, user := range this.Users {
 		userAddrs = append(userAddrs, user.Address)
@@ -340,201 +423,72 @@ func (this *TestEnv) refreshAcctBalance() error {
 		userAddrs = append(userAddrs, otherUser)
 	}
 
-	providers := []*ontology_go_sdk.Account{this.Users[0]}
-
-	exAddrs := make([]common.Address, 0)
-	for _, exchange := range this.OnChainEState{
-		exAddrs = append(exAddrs, exchange.ExchangeAddr)
-	}
-
-	tokenAddrs := make([]common.Address, 0)
-	for _, v := range this.OnChainTState {
-		tokenAddrs = append(tokenAddrs, v.TokenAddr)
+	calls := make([]*readCall, 0)
+	read := func(contract common.Address, method string, params []interface{}, set func([]byte) error) {
+		calls = append(calls, &readCall{contract: contract, method: method, params: params, set: set})
 	}
-
-	// update TState at user balance, and user ong balance
 	for _, userAddr := range userAddrs {
-		balances, err := GetBalances(this.Sdk, userAddr, append(tokenAddrs, this.OntdAddr))
-		if err != nil {
-			return fmt.Errorf("refreshAcctBal, err: %v", err)
-		}
-		this.OntdBalance[userAddr] = balances[this.OntdAddr]
-		for i, tokenAddr := range tokenAddrs {
-			this.OnChainTState[i].Balances[userAddr] = balances[tokenAddr]
-		}
-		this.OntdAllowance[userAddr] = make(map[common.Address]*big.Int)
-
-		allowances, err := GetAllowances(this.Sdk, this.OntdAddr, userAddr, exAddrs)
-		if err != nil {
-			return fmt.Errorf("refreshAcctBal, err: %v", err)
-		}
-		for spender, allowance := range allowances {
-			this.OntdAllowance[userAddr][spender] = allowance
+		userAddr := userAddr
+		read(this.OntdAddr, "balanceOf", []interface{}{userAddr}, setBigInt(func(v *big.Int) { this.OntdBalance[userAddr] = v }))
+		if this.OntdAllowance[userAddr] == nil {
+			this.OntdAllowance[userAddr] = make(map[common.Address]*big.Int)
 		}
 	}
-
-	//update TState at user allowance
-	for _, exAddr := range exAddrs {
-		for j, tokenAddr := range tokenAddrs {
-			alls, supply, err := GetAllowancesAndSupply(this.Sdk, tokenAddr, exAddr, userAddrs)
-			if err != nil {
-				return fmt.Errorf("refreshAcctBal, err: %v", err)
-			}
-			for k, v := range alls {
-				this.OnChainTState[j].Allowances[k] = v
-			}
-			this.OnChainTState[j].Supply = supply
-		}
-	}
-
-	// update Estate at token liquid and ong liquid, tokenAddr and FactoryAddr
-	for i, exAddr := range exAddrs {
-		balances, err := GetBalances(this.Sdk, exAddr, append(tokenAddrs, this.OntdAddr))
-		if err != nil {
-			return fmt.Errorf("refreshAcctBal, err: %v", err)
-		}
-		// udpate ong liquid and token liquid
-		this.OnChainEState[i].TokenLiquid = balances[tokenAddrs[i]]
-		this.OnChainEState[i].OntdLiquid = balances[this.OntdAddr]
-
-		// udpate token addr, factory addr
-		ta , err  := GetMethod(this.Sdk, this.OnChainEState[i].ExchangeAddr, "tokenAddress", nil)
-		if err != nil {
-			return fmt.Errorf("refershAcctBal, GetMethod, err: %v", err)
-		}
-		this.OnChainEState[i].TokenAddr, err = common.AddressParseFromBytes(ta)
-		if err != nil {
-			return fmt.Errorf("refershAcctBal, AddressParseFromBytes, err: %v", err)
-		}
-
-		fa , err  := GetMethod(this.Sdk, this.OnChainEState[i].ExchangeAddr, "factoryAddress", nil)
-		if err != nil {
-			return fmt.Errorf("refershAcctBal, GetMethod, err: %v", err)
-		}
-		this.OnChainEState[i].FactoryAddr, err = common.AddressParseFromBytes(fa)
-		if err != nil {
-			return fmt.Errorf("refershAcctBal, AddressParseFromBytes, err: %v", err)
-		}
-		//	update providers, providers's shares and share supply
-		this.OnChainEState[i].Providers = providers
-		for _, provider := range this.OnChainEState[i].Providers {
-			balances, err := GetBalances(this.Sdk, provider.Address, []common.Address{this.OnChainEState[i].ExchangeAddr})
-			if err != nil {
-				return fmt.Errorf("refreshAcctBal, err: %v", err)
-			}
-			this.OnChainEState[i].ShareBalance[provider.Address] = balances[this.OnChainEState[i].ExchangeAddr]
+	for _, i := range pools {
+		exState, tState := this.OnChainEState[i], this.OnChainTState[i]
+		exAddr, tokenAddr := exState.ExchangeAddr, tState.TokenAddr
+		// token i is only approved to its own exchange i
+		for _, userAddr := range userAddrs {
+			userAddr := userAddr
+			read(tokenAddr, "balanceOf", []interface{}{userAddr}, setBigInt(func(v *big.Int) { tState.Balances[userAddr] = v }))
+			read(tokenAddr, "allowance", []interface{}{userAddr, exAddr}, setBigInt(func(v *big.Int) { tState.Allowances[userAddr] = v }))
+			read(this.OntdAddr, "allowance", []interface{}{userAddr, exAddr}, setBigInt(func(v *big.Int) { this.OntdAllowance[userAddr][exAddr] = v }))
 		}
-		supplyRes, err := this.Sdk.NeoVM.PreExecInvokeNeoVMContract(this.OnChainEState[i].ExchangeAddr, []interface{}{"totalSupply", []interface{}{}})
-		if err != nil {
-			return fmt.Errorf("PreExec supply  error: %v", err)
+		read(tokenAddr, "totalSupply", nil, setBigInt(func(v *big.Int) { tState.Supply = v }))
+		read(tokenAddr, "balanceOf", []interface{}{exAddr}, setBigInt(func(v *big.Int) { exState.TokenLiquid = v }))
+		read(this.OntdAddr, "balanceOf", []interface{}{exAddr}, setBigInt(func(v *big.Int) { exState.OntdLiquid = v }))
+		read(exAddr, "totalSupply", nil, setBigInt(func(v *big.Int) { exState.ShareSupply = v }))
+		if meta {
+			read(exAddr, "tokenAddress", nil, setAddress(func(v common.Address) { exState.TokenAddr = v }))
+			read(exAddr, "factoryAddress", nil, setAddress(func(v common.Address) { exState.FactoryAddr = v }))
 		}
-		supplyBs, err := supplyRes.Result.ToByteArray()
-		if err != nil {
-			return fmt.Errorf("Supply.ToByteArray()  error: %v", err)
+		for _, holder := range this.shareHolders(i) {
+			holder := holder
+			read(exAddr, "balanceOf", []interface{}{holder}, setBigInt(func(v *big.Int) { exState.ShareBalance[holder] = v }))
 		}
-		this.OnChainEState[i].ShareSupply = common.BigIntFromNeoBytes(supplyBs)
-
 	}
-
-
-	return nil
+	return batchRead(this.Client, calls)
 }
-func GetAllowances(sdk *ontology_go_sdk.OntologySdk, tokenAddr, owner common.Address, spenders []common.Address) (map[common.Address]*big.Int, error) {
+
+func GetAllowances(client Client, tokenAddr, owner common.Address, spenders []common.Address) (map[common.Address]*big.Int, error) {
+	asset := NewAsset(client, tokenAddr)
 	allowances := make(map[common.Address]*big.Int, 0)
 	for _, spender := range spenders {
-		allowance := new(big.Int)
-		if tokenAddr == ontology_go_sdk.ONG_CONTRACT_ADDRESS {
-			ongBalance, err := sdk.Native.Ong.Allowance(owner, spender)
-			if err != nil {
-				return nil, fmt.Errorf("Get ong allowance of %s error: %v", owner.ToBase58(), err)
-			}
-			allowance = big.NewInt(0).SetUint64(ongBalance)
-		} else if tokenAddr == ontology_go_sdk.ONT_CONTRACT_ADDRESS {
-			if tokenAddr == ontology_go_sdk.ONG_CONTRACT_ADDRESS {
-				ongBalance, err := sdk.Native.Ont.Allowance(owner, spender)
-				if err != nil {
-					return nil, fmt.Errorf("Get ong allowance of %s error: %v", owner.ToBase58(), err)
-				}
-				allowance = big.NewInt(0).SetUint64(ongBalance)
-			}
-		} else {
-			tokenBalanceRes, err := sdk.NeoVM.PreExecInvokeNeoVMContract(tokenAddr, []interface{}{"allowance", []interface{}{owner, spender}})
-			if err != nil {
-				return nil, fmt.Errorf("Get token:%s GetAllowances %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
-			}
-			tokenBalanceBs, err := tokenBalanceRes.Result.ToByteArray()
-			if err != nil {
-				return nil, fmt.Errorf("Result.ToInteger() Get token:%s GetAllowances of %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
-			}
-			allowance = common.BigIntFromNeoBytes(tokenBalanceBs)
+		allowance, err := asset.Allowance(owner, spender)
+		if err != nil {
+			return nil, fmt.Errorf("Get token:%s allowance(%s, %s) error: %v", tokenAddr.ToHexString(), owner.ToBase58(), spender.ToBase58(), err)
 		}
 		allowances[spender] = allowance
 	}
 	return allowances, nil
 }
-func GetBalances(sdk *ontology_go_sdk.OntologySdk, owner common.Address, tokens []common.Address) (map[common.Address]*big.Int, error) {
+func GetBalances(client Client, owner common.Address, tokens []common.Address) (map[common.Address]*big.Int, error) {
 	balances := make(map[common.Address]*big.Int, 0)
 	for _, tokenAddr := range tokens {
-		balance := new(big.Int)
-		if tokenAddr == ontology_go_sdk.ONG_CONTRACT_ADDRESS {
-			ongBalance, err := sdk.Native.Ong.BalanceOf(owner)
-			if err != nil {
-				return nil, fmt.Errorf("Get ong balance of %s error: %v", owner.ToBase58(), err)
-			}
-			balance = big.NewInt(0).SetUint64(ongBalance)
-		} else if tokenAddr == ontology_go_sdk.ONT_CONTRACT_ADDRESS {
-			if tokenAddr == ontology_go_sdk.ONG_CONTRACT_ADDRESS {
-				ongBalance, err := sdk.Native.Ont.BalanceOf(owner)
-				if err != nil {
-					return nil, fmt.Errorf("Get ong balance of %s error: %v", owner.ToBase58(), err)
-				}
-				balance = big.NewInt(0).SetUint64(ongBalance)
-			}
-		} else {
-			tokenBalanceRes, err := sdk.NeoVM.PreExecInvokeNeoVMContract(tokenAddr, []interface{}{"balanceOf", []interface{}{owner}})
-			if err != nil {
-				return nil, fmt.Errorf("Get token:%s balanceOf %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
-			}
-			tokenBalanceBs, err := tokenBalanceRes.Result.ToByteArray()
-			if err != nil {
-				return nil, fmt.Errorf("Result.ToInteger() Get token:%s balance of %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
-			}
-			balance = common.BigIntFromNeoBytes(tokenBalanceBs)
+		balance, err := NewAsset(client, tokenAddr).BalanceOf(owner)
+		if err != nil {
+			return nil, fmt.Errorf("Get token:%s balanceOf %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
 		}
 		balances[tokenAddr] = balance
 	}
 	return balances, nil
 }
 
-func GetAllowancesAndSupply(sdk *ontology_go_sdk.OntologySdk, tokenAddr, spender common.Address, owners []common.Address) (map[common.Address]*big.Int, *big.Int, error) {
-	allowances := make(map[common.Address]*big.Int, 0)
-	for _, owner := range owners {
-		allowRes, err := sdk.NeoVM.PreExecInvokeNeoVMContract(tokenAddr, []interface{}{"allowance", []interface{}{owner, spender}})
-		if err != nil {
-			return nil, nil, fmt.Errorf("Get token:%s balanceOf %s error: %v", tokenAddr.ToHexString(), owner.ToBase58(), err)
-		}
-		tokenBalanceBs, err := allowRes.Result.ToByteArray()
-		if err != nil {
-			return nil, nil, fmt.Errorf("Result.ToInteger() Get token:%s allowance(%s, %s) error: %v", tokenAddr.ToHexString(), owner.ToBase58(), spender.ToBase58(), err)
-		}
-		allowances[owner] = common.BigIntFromNeoBytes(tokenBalanceBs)
-	}
-	supplyRes, err := sdk.NeoVM.PreExecInvokeNeoVMContract(tokenAddr, []interface{}{"totalSupply", []interface{}{}})
-	if err != nil {
-		return nil, nil, fmt.Errorf("PreExec supply  error: %v", err)
-	}
-	supplyBs, err := supplyRes.Result.ToByteArray()
-	if err != nil {
-		return nil, nil, fmt.Errorf("Supply.ToByteArray()  error: %v", err)
-	}
-	return allowances, common.BigIntFromNeoBytes(supplyBs), nil
-}
-
-func GetMethod(sdk *ontology_go_sdk.OntologySdk, contractAddr common.Address, methodName string, params []interface{}) ([]byte, error) {
+func GetMethod(client Client, contractAddr common.Address, methodName string, params []interface{}) ([]byte, error) {
 	if params == nil {
 		params = []interface{}{}
 	}
-	preExeRes, err := sdk.NeoVM.PreExecInvokeNeoVMContract(contractAddr, []interface{}{methodName, params})
+	preExeRes, err := client.PreExecInvokeNeoVMContract(contractAddr, []interface{}{methodName, params})
 	if err != nil {
 		return nil, fmt.Errorf("GetMethod, contractHash: %s, method: %s, pre invoke error %v", contractAddr.ToHexString(), methodName, err)
 	}
@@ -620,8 +574,8 @@ func GetMethod(sdk *ontology_go_sdk.OntologySdk, contractAddr common.Address, me
 //	}
 //	return nil
 //}
-func CheckContractExist(sdk *ontology_go_sdk.OntologySdk, contractAddr string) (bool, error) {
-	dc, err := sdk.GetSmartContract(contractAddr)
+func CheckContractExist(client Client, contractAddr string) (bool, error) {
+	dc, err := client.GetSmartContract(contractAddr)
 	if err != nil {
 		return false, fmt.Errorf("CheckContractExist, error: %v", err)
 	}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"testing"
+)
+
+func Test_NewTestEnv(t *testing.T) {
+	if testNode == nil {
+		t.Skip("running against a real node")
+	}
+	exchanges := []string{testEnv.OnChainEState[0].ExchangeAddr.ToHexString(), testEnv.OnChainEState[1].ExchangeAddr.ToHexString()}
+	tokens := []string{testEnv.OnChainTState[0].TokenAddr.ToHexString(), testEnv.OnChainTState[1].TokenAddr.ToHexString()}
+	cfg := &config.Config{
+		FactoryHash:   testEnv.OnChainFState.FactoryAddr.ToHexString(),
+		OntdHash:      testEnv.OntdAddr.ToHexString(),
+		Pairs:         []*config.Pair{{TokenHash: tokens[1], ExchangeHash: exchanges[1]}},
+		GasPrice:      testEnv.GasPrice,
+		GasLimit:      testEnv.GasLimit,
+	}
+	env, err := NewTestEnv(cfg, WithClient(testEnv.Client), WithAccounts(testEnv.Users[1:]))
+	if err != nil {
+		t.Fatalf("NewTestEnv error: %v", err)
+	}
+	if len(env.OnChainEState) != 1 || env.OnChainEState[0].TokenAddr != testEnv.OnChainTState[1].TokenAddr || env.Users[0] != testEnv.Users[1] {
+		t.Fatalf("NewTestEnv built pools: %+v, users: %v", env.OnChainEState, env.Users)
+	}
+	if env == testEnv || env.Simulator == testEnv.Simulator {
+		t.Fatalf("NewTestEnv shares state with testEnv")
+	}
+
+	// the factory does not map token2 to exchange1
+	cfg.Pairs[0].ExchangeHash = exchanges[0]
+	if _, err := NewTestEnv(cfg, WithClient(testEnv.Client), WithAccounts(testEnv.Users)); err == nil {
+		t.Fatalf("NewTestEnv accepts a pair unknown to the factory")
+	}
+	cfg.Pairs[0].ExchangeHash, cfg.FactoryHash = exchanges[1], "factory"
+	if _, err := NewTestEnv(cfg, WithClient(testEnv.Client), WithAccounts(testEnv.Users)); err == nil {
+		t.Fatalf("NewTestEnv accepts an invalid factory hash")
+	}
+}
+
+func Test_ParsePairs(t *testing.T) {
+	pairs := make([]*config.Pair, 0)
+	for i := 1; i <= 3; i++ {
+		token, exchange := mockAddr(fmt.Sprintf("token%d", i)), mockAddr(fmt.Sprintf("exchange%d", i))
+		pairs = append(pairs, &config.Pair{TokenHash: token.ToHexString(), ExchangeHash: exchange.ToHexString()})
+	}
+	tokens, exchanges, err := ParsePairs(pairs)
+	if err != nil {
+		t.Fatalf("ParsePairs error: %v", err)
+	}
+	if len(tokens) != 3 || tokens[2] != mockAddr("token3") || exchanges[1] != mockAddr("exchange2") {
+		t.Fatalf("ParsePairs tokens: %v, exchanges: %v", tokens, exchanges)
+	}
+	et := &ExchangeTest{Exchanges: exchanges, Tokens: tokens, TestMode: 1}
+	if routes := et.routes(); len(routes) != 6 || routes[0] != [2]int{0, 1} || routes[5] != [2]int{2, 1} {
+		t.Fatalf("routes: %v", routes)
+	}
+	et.TestMode = 0
+	if routes := et.routes(); len(routes) != 0 {
+		t.Fatalf("routes without token to token trades: %v", routes)
+	}
+
+	if _, _, err := ParsePairs(nil); err == nil {
+		t.Fatalf("ParsePairs accepts no pair")
+	}
+	if _, _, err := ParsePairs(append(pairs, pairs[0])); err == nil {
+		t.Fatalf("ParsePairs accepts a pair listed twice")
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+)
+
+// InvariantViolation is one pool invariant that does not hold after an operation
+type InvariantViolation struct {
+	Pool int
+	Invariant string
+	Detail string
+}
+
+func (this *InvariantViolation) String() string {
+	return fmt.Sprintf("pool %d, %s: %s", this.Pool, this.Invariant, this.Detail)
+}
+
+// InvariantError lists the invariants broken by the transaction TxHash of Operation
+type InvariantError struct {
+	TxHash common.Uint256
+	Operation string
+	Violations []*InvariantViolation
+}
+
+func (this *InvariantError) Error() string {
+	items := make([]string, 0, len(this.Violations))
+	for _, violation := range this.Violations {
+		items = append(items, violation.String())
+	}
+	return fmt.Sprintf("%s, tx: %s breaks %d invariants: %s", this.Operation, this.TxHash.ToHexString(), len(this.Violations), strings.Join(items, "; "))
+}
+
+// checkInvariants compares the refreshed state of pools with before, the snapshot taken ahead of the transaction txHash:
+//  - a swap never decreases ontdReserve * tokenReserve
+//  - the shares of all known holders add up to the share supply
+//  - the supply of the token is conserved
+//  - the reserves are the balances of the exchange, read again apart from the batch refresh
+func (this *TestEnv) checkInvariants(before *Snapshot, txHash common.Uint256, operation string, swap bool, pools ...int) error {
+	violations := make([]*InvariantViolation, 0)
+	violate := func(pool int, invariant, format string, args ...interface{}) {
+		violations = append(violations, &InvariantViolation{Pool: pool, Invariant: invariant, Detail: fmt.Sprintf(format, args...)})
+	}
+	checked := make(map[int]bool)
+	for _, pool := range pools {
+		if checked[pool] {
+			continue
+		}
+		checked[pool] = true
+		exBefore, exState, tState := before.Exchanges[pool], this.OnChainEState[pool], this.OnChainTState[pool]
+
+		if swap {
+			kBefore := new(big.Int).Mul(bigOrZero(exBefore.OntdReserve), bigOrZero(exBefore.TokenReserve))
+			kAfter := new(big.Int).Mul(bigOrZero(exState.OntdLiquid), bigOrZero(exState.TokenLiquid))
+			if kAfter.Cmp(kBefore) < 0 {
+				violate(pool, "constant product", "decreased from %v to %v", kBefore, kAfter)
+			}
+		}
+
+		shares := new(big.Int)
+		for _, share := range exState.ShareBalance {
+			shares.Add(shares, bigOrZero(share))
+		}
+		if shares.Cmp(bigOrZero(exState.ShareSupply)) != 0 {
+			violate(pool, "share supply", "holders have %v of %v shares", shares, bigString(exState.ShareSupply))
+		}
+
+		if bigOrZero(before.Tokens[pool].Supply).Cmp(bigOrZero(tState.Supply)) != 0 {
+			violate(pool, "token supply", "changed from %s to %s", bigString(before.Tokens[pool].Supply), bigString(tState.Supply))
+		}
+
+		ontdBalance, err := NewAsset(this.Client, this.OntdAddr).BalanceOf(exState.ExchangeAddr)
+		if err != nil {
+			return fmt.Errorf("checkInvariants, %v", err)
+		}
+		tokenBalance, err := NewAsset(this.Client, tState.TokenAddr).BalanceOf(exState.ExchangeAddr)
+		if err != nil {
+			return fmt.Errorf("checkInvariants, %v", err)
+		}
+		if ontdBalance.Cmp(bigOrZero(exState.OntdLiquid)) != 0 {
+			violate(pool, "ontd reserve", "reserve %s, balanceOf(exchange) %v", bigString(exState.OntdLiquid), ontdBalance)
+		}
+		if tokenBalance.Cmp(bigOrZero(exState.TokenLiquid)) != 0 {
+			violate(pool, "token reserve", "reserve %s, balanceOf(exchange) %v", bigString(exState.TokenLiquid), tokenBalance)
+		}
+	}
+	if len(violations) > 0 {
+		return &InvariantError{TxHash: txHash, Operation: operation, Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_Invariants(t *testing.T) {
+	pool := 0
+	if err := testEnv.refreshPools(pool); err != nil {
+		t.Fatalf("refreshPools error: %v", err)
+	}
+	before := testEnv.Snapshot()
+	if err := testEnv.checkInvariants(before, common.UINT256_EMPTY, "none", true, pool, pool); err != nil {
+		t.Fatalf("invariants without any operation: %v", err)
+	}
+
+	// a pool with a larger product before and another token supply breaks two invariants
+	forged := testEnv.Snapshot()
+	forged.Exchanges[pool].OntdReserve = new(big.Int).Add(bigOrZero(forged.Exchanges[pool].OntdReserve), big.NewInt(1))
+	forged.Tokens[pool].Supply = new(big.Int).Add(bigOrZero(forged.Tokens[pool].Supply), big.NewInt(1))
+	err := testEnv.checkInvariants(forged, common.UINT256_EMPTY, "forged", true, pool)
+	invErr, ok := err.(*InvariantError)
+	if !ok || len(invErr.Violations) != 2 {
+		t.Fatalf("forged snapshot error: %v", err)
+	}
+	if invErr.Violations[0].Invariant != "constant product" || invErr.Violations[1].Invariant != "token supply" {
+		t.Fatalf("violations: %v", err)
+	}
+	if !strings.Contains(err.Error(), common.UINT256_EMPTY.ToHexString()) {
+		t.Fatalf("error without the tx hash: %v", err)
+	}
+	// the product may move freely when liquidity is added or removed
+	if err := testEnv.checkInvariants(forged, common.UINT256_EMPTY, "forged", false, pool); err == nil || len(err.(*InvariantError).Violations) != 1 {
+		t.Fatalf("forged snapshot of a liquidity operation: %v", err)
+	}
+
+	// the shares of all known holders no longer add up once one is unknown
+	shares := testEnv.OnChainEState[pool].ShareSupply
+	testEnv.OnChainEState[pool].ShareSupply = new(big.Int).Add(bigOrZero(shares), big.NewInt(1))
+	err = testEnv.checkInvariants(before, common.UINT256_EMPTY, "unknown holder", false, pool)
+	testEnv.OnChainEState[pool].ShareSupply = shares
+	if invErr, ok := err.(*InvariantError); !ok || invErr.Violations[0].Invariant != "share supply" {
+		t.Fatalf("share supply violation: %v", err)
+	}
+
+	if err := testEnv.ontToTokenInput(pool, big.NewInt(3000), big.NewInt(1), testEnv.Users[1], testEnv.Users[1].Address); err != nil {
+		t.Fatalf("ontToTokenInput error: %v", err)
+	}
+}
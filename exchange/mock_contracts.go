@@ -0,0 +1,821 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"math/big"
+	"strings"
+)
+
+const nativeInvokeName = "Ontology.Native.Invoke"
+
+var errWitness = errors.New("checkWitness failed")
+
+// vmArray is a NeoVM array or struct, it is shared by reference like in the vm
+type vmArray struct {
+	items []interface{}
+}
+
+// mockNotify is the json of one NotifyEventInfo
+type mockNotify struct {
+	ContractAddress string
+	States interface{}
+}
+
+// mockContext is the execution of one transaction against a ledger
+type mockContext struct {
+	ledger *mockLedger
+	witnesses map[common.Address]bool
+	now int64
+	notify []*mockNotify
+}
+
+func (this *mockContext) checkWitness(addr common.Address) error {
+	if !this.witnesses[addr] {
+		return fmt.Errorf("%v: %s", errWitness, addr.ToBase58())
+	}
+	return nil
+}
+
+// notifyNeo records a NeoVM notify, all the states are hex encoded like the node does
+func (this *mockContext) notifyNeo(contract common.Address, name string, states ...interface{}) {
+	encoded := []interface{}{hex.EncodeToString([]byte(name))}
+	for _, state := range states {
+		encoded = append(encoded, encodeResult(state))
+	}
+	this.notify = append(this.notify, &mockNotify{ContractAddress: contract.ToHexString(), States: encoded})
+}
+
+// run interprets the invoke code the sdk builds: pushes, PACK, the struct opcodes, APPCALL and the native SYSCALL.
+// Every call leaves its result on the stack, the top of the stack is the result of the script.
+func (this *mockContext) run(code []byte) (interface{}, error) {
+	stack, alt := make([]interface{}, 0), make([]interface{}, 0)
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("run, stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	read := func(pc, n int) ([]byte, error) {
+		if n < 0 || pc+n > len(code) {
+			return nil, fmt.Errorf("run, code ends at %d, want %d bytes", len(code), pc+n)
+		}
+		return code[pc : pc+n], nil
+	}
+	for pc := 0; pc < len(code); {
+		op := code[pc]
+		pc++
+		switch {
+		case op <= 0x4E:
+			n := int(op)
+			switch op {
+			case 0x4C:
+				l, err := read(pc, 1)
+				if err != nil {
+					return nil, err
+				}
+				n, pc = int(l[0]), pc+1
+			case 0x4D:
+				l, err := read(pc, 2)
+				if err != nil {
+					return nil, err
+				}
+				n, pc = int(binary.LittleEndian.Uint16(l)), pc+2
+			case 0x4E:
+				l, err := read(pc, 4)
+				if err != nil {
+					return nil, err
+				}
+				n, pc = int(binary.LittleEndian.Uint32(l)), pc+4
+			}
+			data, err := read(pc, n)
+			if err != nil {
+				return nil, err
+			}
+			stack, pc = append(stack, append([]byte{}, data...)), pc+n
+		case op == 0x4F:
+			stack = append(stack, big.NewInt(-1))
+		case op >= 0x51 && op <= 0x60:
+			stack = append(stack, big.NewInt(int64(op-0x50)))
+		case op == 0xC1 || op == 0xC6:
+			// PACK and NEWSTRUCT
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			n := int(toBigInt(v).Int64())
+			if n < 0 || (op == 0xC1 && n > len(stack)) {
+				return nil, fmt.Errorf("run, invalid count: %d", n)
+			}
+			array := &vmArray{}
+			for i := 0; op == 0xC1 && i < n; i++ {
+				item, _ := pop()
+				array.items = append(array.items, item)
+			}
+			stack = append(stack, array)
+		case op == 0x6B:
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			alt = append(alt, v)
+		case op == 0x6A || op == 0x6C:
+			if len(alt) == 0 {
+				return nil, fmt.Errorf("run, alt stack underflow")
+			}
+			stack = append(stack, alt[len(alt)-1])
+			if op == 0x6C {
+				alt = alt[:len(alt)-1]
+			}
+		case op == 0x7C:
+			if len(stack) < 2 {
+				return nil, fmt.Errorf("run, stack underflow")
+			}
+			stack[len(stack)-1], stack[len(stack)-2] = stack[len(stack)-2], stack[len(stack)-1]
+		case op == 0xC8:
+			item, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			array, ok := v.(*vmArray)
+			if !ok {
+				return nil, fmt.Errorf("run, APPEND to a non array")
+			}
+			array.items = append(array.items, item)
+		case op == 0x67:
+			addrBs, err := read(pc, common.ADDR_LEN)
+			if err != nil {
+				return nil, err
+			}
+			pc += common.ADDR_LEN
+			contract, _ := common.AddressParseFromBytes(addrBs)
+			method, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			args, ok := v.(*vmArray)
+			if !ok {
+				return nil, fmt.Errorf("run, contract: %s, method: %s, params is not an array", contract.ToHexString(), toBytes(method))
+			}
+			result, err := this.ledger.invoke(this, contract, string(toBytes(method)), args.items)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, result)
+		case op == 0x68:
+			l, err := read(pc, 1)
+			if err != nil {
+				return nil, err
+			}
+			name, err := read(pc+1, int(l[0]))
+			if err != nil {
+				return nil, err
+			}
+			pc += 1 + int(l[0])
+			if string(name) != nativeInvokeName {
+				return nil, fmt.Errorf("run, unsupported syscall: %s", name)
+			}
+			// version, contract and method are on the top, the params are the rest of the stack
+			if len(stack) < 3 {
+				return nil, fmt.Errorf("run, stack underflow")
+			}
+			contract, err := common.AddressParseFromBytes(toBytes(stack[len(stack)-2]))
+			if err != nil {
+				return nil, fmt.Errorf("run, native contract address: %v", err)
+			}
+			method := string(toBytes(stack[len(stack)-3]))
+			args := make([]interface{}, 0)
+			for i := len(stack) - 4; i >= 0; i-- {
+				args = append(args, stack[i])
+			}
+			stack = stack[:0]
+			result, err := this.ledger.invokeNative(this, contract, method, args)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, result)
+		default:
+			return nil, fmt.Errorf("run, unsupported opcode: %x", op)
+		}
+	}
+	if len(stack) == 0 {
+		return nil, nil
+	}
+	return stack[len(stack)-1], nil
+}
+
+func toBigInt(v interface{}) *big.Int {
+	switch value := v.(type) {
+	case *big.Int:
+		return value
+	case []byte:
+		return common.BigIntFromNeoBytes(value)
+	case bool:
+		if value {
+			return big.NewInt(1)
+		}
+	}
+	return big.NewInt(0)
+}
+
+func toBytes(v interface{}) []byte {
+	switch value := v.(type) {
+	case []byte:
+		return value
+	case *big.Int:
+		return common.BigIntToNeoBytes(value)
+	case bool:
+		if value {
+			return []byte{1}
+		}
+		return []byte{0}
+	}
+	return nil
+}
+
+// encodeResult encodes a vm value the way the node returns it in Result and notify States
+func encodeResult(v interface{}) interface{} {
+	switch value := v.(type) {
+	case *vmArray:
+		items := make([]interface{}, 0, len(value.items))
+		for _, item := range value.items {
+			items = append(items, encodeResult(item))
+		}
+		return items
+	case common.Address:
+		return hex.EncodeToString(value[:])
+	case string:
+		return hex.EncodeToString([]byte(value))
+	case nil:
+		return ""
+	}
+	return hex.EncodeToString(toBytes(v))
+}
+
+// mockArgs reads typed params, the first bad one is kept in err
+type mockArgs struct {
+	method string
+	items []interface{}
+	err error
+}
+
+func (this *mockArgs) get(i int) interface{} {
+	if i >= len(this.items) {
+		if this.err == nil {
+			this.err = fmt.Errorf("method: %s, want at least %d params, got %d", this.method, i+1, len(this.items))
+		}
+		return nil
+	}
+	return this.items[i]
+}
+
+func (this *mockArgs) int(i int) *big.Int {
+	return toBigInt(this.get(i))
+}
+
+func (this *mockArgs) address(i int) common.Address {
+	addr, err := common.AddressParseFromBytes(toBytes(this.get(i)))
+	if err != nil && this.err == nil {
+		this.err = fmt.Errorf("method: %s, param %d is not an address: %v", this.method, i, err)
+	}
+	return addr
+}
+
+// reversedAddress reads an address given in hex order, the way refreshFstate queries the factory
+func (this *mockArgs) reversedAddress(i int) common.Address {
+	bs := toBytes(this.get(i))
+	addr, err := common.AddressParseFromBytes(common.ToArrayReverse(bs))
+	if err != nil && this.err == nil {
+		this.err = fmt.Errorf("method: %s, param %d is not an address: %v", this.method, i, err)
+	}
+	return addr
+}
+
+func (this *mockArgs) array(i int) []interface{} {
+	array, ok := this.get(i).(*vmArray)
+	if !ok {
+		if this.err == nil {
+			this.err = fmt.Errorf("method: %s, param %d is not an array", this.method, i)
+		}
+		return nil
+	}
+	return array.items
+}
+
+// mockTokenMeta describes an OEP-4 token or an exchange share
+type mockTokenMeta struct {
+	Name string
+	Symbol string
+	Decimals int64
+}
+
+// mockLedger is the whole state of the mock chain
+type mockLedger struct {
+	sim *OffChainSimulator
+	native map[common.Address]*OffChainTokenState
+	meta map[common.Address]mockTokenMeta
+	// factoryTokens lists the tokens in createExchange order, getTokenWithId is 1 based
+	factoryTokens []common.Address
+	contracts map[common.Address]*payload.DeployCode
+	// inits are the tokens whose init has not minted the supply to their owner yet
+	inits map[common.Address]*mockTokenInit
+	// template is the exchange template of the factory, empty until initializeFactory
+	template common.Address
+}
+
+// mockTokenInit is what the init of a token deployed by a transaction mints
+type mockTokenInit struct {
+	Owner common.Address
+	Supply *big.Int
+}
+
+func newMockLedger(factoryAddr, ontdAddr common.Address) *mockLedger {
+	this := &mockLedger{
+		sim:       NewOffChainSimulator(factoryAddr, ontdAddr),
+		native:    make(map[common.Address]*OffChainTokenState),
+		meta:      make(map[common.Address]mockTokenMeta),
+		contracts: make(map[common.Address]*payload.DeployCode),
+		inits:     make(map[common.Address]*mockTokenInit),
+	}
+	for _, asset := range []common.Address{ontology_go_sdk.ONT_CONTRACT_ADDRESS, ontology_go_sdk.ONG_CONTRACT_ADDRESS} {
+		this.native[asset] = NewOffChainTokenState(asset)
+	}
+	this.meta[ontology_go_sdk.ONT_CONTRACT_ADDRESS] = mockTokenMeta{"ONT Token", "ONT", 0}
+	this.meta[ontology_go_sdk.ONG_CONTRACT_ADDRESS] = mockTokenMeta{"ONG Token", "ONG", 9}
+	return this
+}
+
+func (this *mockLedger) clone() *mockLedger {
+	c := &mockLedger{
+		sim:           this.sim.Clone(),
+		native:        make(map[common.Address]*OffChainTokenState),
+		meta:          make(map[common.Address]mockTokenMeta),
+		factoryTokens: append([]common.Address{}, this.factoryTokens...),
+		contracts:     make(map[common.Address]*payload.DeployCode),
+		inits:         make(map[common.Address]*mockTokenInit),
+		template:      this.template,
+	}
+	for addr, init := range this.inits {
+		c.inits[addr] = init
+	}
+	for addr, asset := range this.native {
+		c.native[addr] = asset.clone()
+	}
+	for addr, meta := range this.meta {
+		c.meta[addr] = meta
+	}
+	for addr, dc := range this.contracts {
+		c.contracts[addr] = dc
+	}
+	return c
+}
+
+// token returns the ledger of an OEP-4 token, ONTD included
+func (this *mockLedger) token(addr common.Address) *OffChainTokenState {
+	if addr == this.sim.Ontd.TokenAddr {
+		return this.sim.Ontd
+	}
+	return this.sim.Tokens[addr]
+}
+
+// nativeAsset returns the ledger of the native ONT or ONG contract, ONG as the quote asset is the ledger the exchanges
+// trade so that the gas comes out of the same balances
+func (this *mockLedger) nativeAsset(addr common.Address) *OffChainTokenState {
+	if addr == this.sim.Ontd.TokenAddr {
+		return this.sim.Ontd
+	}
+	return this.native[addr]
+}
+
+func (this *mockLedger) invoke(ctx *mockContext, contract common.Address, method string, items []interface{}) (interface{}, error) {
+	args := &mockArgs{method: method, items: items}
+	var result interface{}
+	var err error
+	if token := this.token(contract); token != nil {
+		result, err = this.invokeOep4(ctx, token, args)
+	} else if _, ok := this.sim.Exchanges[contract]; ok {
+		result, err = this.invokeExchange(ctx, contract, args)
+	} else if contract == this.sim.FactoryAddr {
+		result, err = this.invokeFactory(ctx, args)
+	} else if _, ok := this.contracts[contract]; ok {
+		err = fmt.Errorf("contract: %s has no mock model", contract.ToHexString())
+	} else {
+		err = fmt.Errorf("contract: %s does not exist", contract.ToHexString())
+	}
+	if err == nil && args.err != nil {
+		err = args.err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("contract: %s, method: %s, %v", contract.ToHexString(), method, err)
+	}
+	return result, nil
+}
+
+func (this *mockLedger) invokeMeta(contract common.Address, method string) (interface{}, bool) {
+	meta := this.meta[contract]
+	switch method {
+	case "name":
+		return []byte(meta.Name), true
+	case "symbol":
+		return []byte(meta.Symbol), true
+	case "decimals":
+		return big.NewInt(meta.Decimals), true
+	}
+	return nil, false
+}
+
+// invokeOep4 implements the OEP-4 methods, ONTD is an OEP-4 token as well
+func (this *mockLedger) invokeOep4(ctx *mockContext, token *OffChainTokenState, args *mockArgs) (interface{}, error) {
+	if result, ok := this.invokeMeta(token.TokenAddr, args.method); ok {
+		return result, nil
+	}
+	switch args.method {
+	case "init":
+		// like the OEP-4 template, a second init returns false
+		init, ok := this.inits[token.TokenAddr]
+		if !ok {
+			return false, nil
+		}
+		delete(this.inits, token.TokenAddr)
+		token.Mint(init.Owner, init.Supply)
+		ctx.notifyNeo(token.TokenAddr, "transfer", common.ADDRESS_EMPTY, init.Owner, init.Supply)
+		return true, nil
+	case "totalSupply":
+		return new(big.Int).Set(token.Supply), nil
+	case "balanceOf":
+		return token.BalanceOf(args.address(0)), nil
+	case "allowance":
+		return token.Allowance(args.address(0), args.address(1)), nil
+	case "transfer":
+		from, to, amount := args.address(0), args.address(1), args.int(2)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if err := ctx.checkWitness(from); err != nil {
+			return nil, err
+		}
+		if err := token.Transfer(from, to, amount); err != nil {
+			return nil, err
+		}
+		ctx.notifyNeo(token.TokenAddr, "transfer", from, to, amount)
+		return true, nil
+	case "approve":
+		owner, spender, amount := args.address(0), args.address(1), args.int(2)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if err := ctx.checkWitness(owner); err != nil {
+			return nil, err
+		}
+		if err := token.Approve(owner, spender, amount); err != nil {
+			return nil, err
+		}
+		ctx.notifyNeo(token.TokenAddr, "approval", owner, spender, amount)
+		return true, nil
+	case "transferFrom":
+		spender, from, to, amount := args.address(0), args.address(1), args.address(2), args.int(3)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if err := ctx.checkWitness(spender); err != nil {
+			return nil, err
+		}
+		if err := token.TransferFrom(spender, from, to, amount); err != nil {
+			return nil, err
+		}
+		ctx.notifyNeo(token.TokenAddr, "transfer", from, to, amount)
+		return true, nil
+	}
+	return nil, fmt.Errorf("unknown method")
+}
+
+// invokeFactory implements the read side of uniswap_factory.py, initializeFactory and createExchange
+func (this *mockLedger) invokeFactory(ctx *mockContext, args *mockArgs) (interface{}, error) {
+	sim := this.sim
+	switch args.method {
+	case "exchangeTemplate":
+		if this.template == common.ADDRESS_EMPTY {
+			return []byte{}, nil
+		}
+		return this.template[:], nil
+	case "initializeFactory":
+		template := args.reversedAddress(0)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if this.template != common.ADDRESS_EMPTY || template == common.ADDRESS_EMPTY {
+			return nil, fmt.Errorf("factory is initialized or template: %s is empty", template.ToHexString())
+		}
+		this.template = template
+		return true, nil
+	case "getExchange":
+		if exchange, ok := sim.TokenToExchange[args.reversedAddress(0)]; ok {
+			return exchange[:], nil
+		}
+		return []byte{}, nil
+	case "getToken":
+		if exchange, ok := sim.Exchanges[args.reversedAddress(0)]; ok {
+			return exchange.TokenAddr[:], nil
+		}
+		return []byte{}, nil
+	case "getTokenWithId":
+		id := args.int(0).Int64()
+		if id < 1 || id > int64(len(this.factoryTokens)) {
+			return []byte{}, nil
+		}
+		return this.factoryTokens[id-1][:], nil
+	case "tokenCount":
+		return big.NewInt(int64(len(this.factoryTokens))), nil
+	case "createExchange":
+		token := args.reversedAddress(0)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if this.template == common.ADDRESS_EMPTY {
+			return nil, fmt.Errorf("factory is not initialized")
+		}
+		if _, ok := sim.TokenToExchange[token]; ok || token == common.ADDRESS_EMPTY {
+			return nil, fmt.Errorf("exchange of token: %s exists", token.ToHexString())
+		}
+		exchange := common.AddressFromVmCode(append([]byte("mock exchange"), token[:]...))
+		this.addExchange(exchange, token)
+		ctx.notifyNeo(sim.FactoryAddr, "NewExchange", token, exchange)
+		return exchange[:], nil
+	}
+	return nil, fmt.Errorf("unknown method")
+}
+
+func (this *mockLedger) addExchange(exchange, token common.Address) {
+	this.sim.AddExchange(exchange, token)
+	this.factoryTokens = append(this.factoryTokens, token)
+	this.meta[exchange] = mockTokenMeta{"Uniswap V1", "UNI-V1", 9}
+	this.deploy(exchange, "exchange")
+	if _, ok := this.contracts[token]; !ok {
+		this.deploy(token, "token")
+	}
+}
+
+func (this *mockLedger) deploy(addr common.Address, kind string) {
+	dc, _ := payload.NewDeployCode([]byte("mock "+kind+" "+addr.ToHexString()), payload.NEOVM_TYPE, kind, "1.0", "mock", "", "")
+	this.contracts[addr] = dc
+}
+
+// swapLayout gives the param positions of one swap method, -1 means absent
+type swapLayout struct {
+	amount, limit, limit2, deadline, recipient, target, invoker int
+}
+
+var swapLayouts = map[string]swapLayout{
+	"ontToTokenSwapInput":       {3, 0, -1, 1, -1, -1, 2},
+	"ontToTokenTransferInput":   {4, 0, -1, 1, 2, -1, 3},
+	"ontToTokenSwapOutput":      {0, 3, -1, 1, -1, -1, 2},
+	"ontToTokenTransferOutput":  {0, 4, -1, 1, 2, -1, 3},
+	"tokenToOntSwapInput":       {0, 1, -1, 2, -1, -1, 3},
+	"tokenToOntTransferInput":   {0, 1, -1, 2, 4, -1, 3},
+	"tokenToOntSwapOutput":      {0, 1, -1, 2, -1, -1, 3},
+	"tokenToOntTransferOutput":  {0, 1, -1, 2, 3, -1, 4},
+	"tokenToTokenSwapInput":     {0, 1, 2, 3, -1, 4, 5},
+	"tokenToTokenTransferInput": {0, 1, 2, 3, 4, 5, 6},
+	"tokenToTokenSwapOutput":    {0, 1, 2, 3, -1, 4, 5},
+	"tokenToTokenTransferOutput": {0, 1, 2, 3, 4, 5, 6},
+}
+
+// invokeExchange implements uniswap_exchange.py on top of the simulator
+func (this *mockLedger) invokeExchange(ctx *mockContext, exchangeAddr common.Address, args *mockArgs) (interface{}, error) {
+	sim := this.sim
+	sim.Now = func() int64 { return ctx.now }
+	exchange := sim.Exchanges[exchangeAddr]
+	if result, ok := this.invokeMeta(exchangeAddr, args.method); ok {
+		return result, nil
+	}
+	ontdReserve, tokenReserve, err := sim.Reserves(exchangeAddr)
+	if err != nil {
+		return nil, err
+	}
+	switch args.method {
+	case "tokenAddress":
+		return exchange.TokenAddr[:], nil
+	case "factoryAddress":
+		return exchange.FactoryAddr[:], nil
+	case "totalSupply":
+		return new(big.Int).Set(exchange.ShareSupply), nil
+	case "balanceOf":
+		return exchange.shareOf(args.address(0)), nil
+	case "getOntToTokenInputPrice":
+		return getInputPrice(args.int(0), ontdReserve, tokenReserve)
+	case "getOntToTokenOutputPrice":
+		return getOutputPrice(args.int(0), ontdReserve, tokenReserve)
+	case "getTokenToOntInputPrice":
+		return getInputPrice(args.int(0), tokenReserve, ontdReserve)
+	case "getTokenToOntOutputPrice":
+		return getOutputPrice(args.int(0), tokenReserve, ontdReserve)
+	case "addLiquidity":
+		minLiquidity, maxTokens, deadline, depositer, ontdAmt := args.int(0), args.int(1), args.int(2).Int64(), args.address(3), args.int(4)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if err := ctx.checkWitness(depositer); err != nil {
+			return nil, err
+		}
+		minted, err := sim.AddLiquidity(exchangeAddr, minLiquidity, maxTokens, deadline, depositer, ontdAmt)
+		if err != nil {
+			return nil, err
+		}
+		_, tokenReserve2, _ := sim.Reserves(exchangeAddr)
+		ctx.notifyNeo(exchangeAddr, "AddLiquidity", depositer, ontdAmt, new(big.Int).Sub(tokenReserve2, tokenReserve))
+		return minted, nil
+	case "removeLiquidity":
+		amount, minOntd, minTokens, deadline, withdrawer := args.int(0), args.int(1), args.int(2), args.int(3).Int64(), args.address(4)
+		if args.err != nil {
+			return nil, args.err
+		}
+		if err := ctx.checkWitness(withdrawer); err != nil {
+			return nil, err
+		}
+		ontdAmt, tokenAmt, err := sim.RemoveLiquidity(exchangeAddr, amount, minOntd, minTokens, deadline, withdrawer)
+		if err != nil {
+			return nil, err
+		}
+		ctx.notifyNeo(exchangeAddr, "RemoveLiquidity", withdrawer, ontdAmt, tokenAmt)
+		return &vmArray{items: []interface{}{ontdAmt, tokenAmt}}, nil
+	}
+	return this.invokeSwap(ctx, exchangeAddr, args)
+}
+
+func (this *mockLedger) invokeSwap(ctx *mockContext, exchangeAddr common.Address, args *mockArgs) (interface{}, error) {
+	sim := this.sim
+	method := strings.Replace(args.method, "tokenToExchange", "tokenToToken", 1)
+	layout, ok := swapLayouts[method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method")
+	}
+	opt := func(i int) *big.Int {
+		if i < 0 {
+			return nil
+		}
+		return args.int(i)
+	}
+	amount, limit, limit2, deadline, invoker := args.int(layout.amount), args.int(layout.limit), opt(layout.limit2), args.int(layout.deadline).Int64(), args.address(layout.invoker)
+	recipient := invoker
+	if layout.recipient >= 0 {
+		recipient = args.address(layout.recipient)
+	}
+	var target common.Address
+	if layout.target >= 0 {
+		target = args.address(layout.target)
+		if method == args.method {
+			// tokenToToken names the token bought, tokenToExchange names its exchange
+			target = sim.TokenToExchange[target]
+		}
+	}
+	if args.err != nil {
+		return nil, args.err
+	}
+	if err := ctx.checkWitness(invoker); err != nil {
+		return nil, err
+	}
+	input := strings.HasSuffix(method, "Input")
+	ontdReserve, tokenReserve, _ := sim.Reserves(exchangeAddr)
+	var targetToken *big.Int
+	if _, ok := sim.Exchanges[target]; ok && layout.target >= 0 {
+		_, targetToken, _ = sim.Reserves(target)
+	}
+
+	var result *big.Int
+	var err error
+	switch {
+	case strings.HasPrefix(method, "ontToToken") && input:
+		result, err = sim.OntToTokenInput(exchangeAddr, amount, limit, deadline, invoker, recipient)
+	case strings.HasPrefix(method, "ontToToken"):
+		result, err = sim.OntToTokenOutput(exchangeAddr, amount, limit, deadline, invoker, recipient)
+	case strings.HasPrefix(method, "tokenToOnt") && input:
+		result, err = sim.TokenToOntInput(exchangeAddr, amount, limit, deadline, invoker, recipient)
+	case strings.HasPrefix(method, "tokenToOnt"):
+		result, err = sim.TokenToOntOutput(exchangeAddr, amount, limit, deadline, invoker, recipient)
+	case input:
+		result, err = sim.TokenToExchangeInput(exchangeAddr, amount, limit, limit2, deadline, invoker, recipient, target)
+	default:
+		result, err = sim.TokenToExchangeOutput(exchangeAddr, amount, limit, limit2, deadline, invoker, recipient, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ontdReserve2, tokenReserve2, _ := sim.Reserves(exchangeAddr)
+	if strings.HasPrefix(method, "ontToToken") {
+		ctx.notifyNeo(exchangeAddr, "TokenPurchase", invoker, new(big.Int).Sub(ontdReserve2, ontdReserve), new(big.Int).Sub(tokenReserve, tokenReserve2))
+		return result, nil
+	}
+	ontdBought := new(big.Int).Sub(ontdReserve, ontdReserve2)
+	ctx.notifyNeo(exchangeAddr, "OntPurchase", invoker, new(big.Int).Sub(tokenReserve2, tokenReserve), ontdBought)
+	if targetToken != nil {
+		_, targetToken2, _ := sim.Reserves(target)
+		ctx.notifyNeo(target, "TokenPurchase", exchangeAddr, ontdBought, new(big.Int).Sub(targetToken, targetToken2))
+	}
+	return result, nil
+}
+
+// invokeNative implements balanceOf, allowance, transfer, approve and transferFrom of the ONT and ONG contracts
+func (this *mockLedger) invokeNative(ctx *mockContext, contract common.Address, method string, items []interface{}) (interface{}, error) {
+	asset := this.nativeAsset(contract)
+	if asset == nil {
+		return nil, fmt.Errorf("native contract: %s is not mocked", contract.ToHexString())
+	}
+	if result, ok := this.invokeMeta(contract, method); ok {
+		return result, nil
+	}
+	args := &mockArgs{method: method, items: items}
+	var result interface{}
+	var err error
+	transfer := func(from, to common.Address, amount *big.Int) error {
+		if err := asset.Transfer(from, to, amount); err != nil {
+			return err
+		}
+		ctx.notify = append(ctx.notify, &mockNotify{ContractAddress: contract.ToHexString(), States: []interface{}{"transfer", from.ToBase58(), to.ToBase58(), amount.Uint64()}})
+		return nil
+	}
+	switch method {
+	case "totalSupply":
+		result = new(big.Int).Set(asset.Supply)
+	case "balanceOf":
+		result = asset.BalanceOf(args.address(0))
+	case "allowance":
+		state := &mockArgs{method: method, items: args.array(0)}
+		result = asset.Allowance(state.address(0), state.address(1))
+		args.err = state.err
+	case "transfer":
+		for _, item := range args.array(0) {
+			state := &mockArgs{method: method, items: []interface{}{item}}
+			state.items = state.array(0)
+			from, to, amount := state.address(0), state.address(1), state.int(2)
+			if err = state.err; err == nil {
+				if err = ctx.checkWitness(from); err == nil {
+					err = transfer(from, to, amount)
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		result = true
+	case "approve":
+		state := &mockArgs{method: method, items: args.array(0)}
+		owner, spender, amount := state.address(0), state.address(1), state.int(2)
+		if err = state.err; err == nil {
+			if err = ctx.checkWitness(owner); err == nil {
+				err = asset.Approve(owner, spender, amount)
+			}
+		}
+		result = true
+	case "transferFrom":
+		state := &mockArgs{method: method, items: args.array(0)}
+		spender, from, to, amount := state.address(0), state.address(1), state.address(2), state.int(3)
+		if err = state.err; err == nil {
+			if err = ctx.checkWitness(spender); err == nil {
+				err = asset.TransferFrom(spender, from, to, amount)
+			}
+		}
+		result = true
+	default:
+		err = fmt.Errorf("unknown method")
+	}
+	if err == nil {
+		err = args.err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("native contract: %s, method: %s, %v", contract.ToHexString(), method, err)
+	}
+	return result, nil
+}
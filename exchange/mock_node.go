@@ -0,0 +1,462 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"github.com/ontio/ontology/core/payload"
+	"github.com/ontio/ontology/core/types"
+	nutils "github.com/ontio/ontology/smartcontract/service/native/utils"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/skyinglyh1/uniswap_v1_test/log"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// error codes of the ontology json rpc
+const (
+	MOCK_SUCCESS = 0
+	MOCK_INVALID_PARAMS = 42002
+	MOCK_INVALID_METHOD = 42001
+	MOCK_UNKNOWN_TRANSACTION = 44001
+	MOCK_UNKNOWN_CONTRACT = 44004
+	MOCK_SMARTCODE_ERROR = 47001
+	MOCK_INTERNAL_ERROR = 45001
+)
+
+// MOCK_GAS_USED is the gas every mock transaction consumes, bounded by its gas limit
+const MOCK_GAS_USED = 20000
+
+// mockEvent is the json of one SmartContactEvent
+type mockEvent struct {
+	TxHash string
+	State byte
+	GasConsumed uint64
+	Notify []*mockNotify
+}
+
+// MockNode is an in-process ontology node serving the json rpc subset the sdk uses here: sendrawtransaction
+// (pre-executed or not), getblockcount, getsmartcodeevent, getcontractstate, getblockheightbytxhash, getversion
+// and getnetworkid. The contracts are in-memory models of OEP-4, ONTD, ONT, ONG and the uniswap factory/exchange.
+type MockNode struct {
+	// BlockInterval is the time between two blocks, the pending transactions are executed in the next block
+	BlockInterval time.Duration
+
+	lock sync.Mutex
+	ledger *mockLedger
+	height uint32
+	blockTime int64
+	pending []*types.Transaction
+	txHeight map[common.Uint256]uint32
+	events map[common.Uint256]*mockEvent
+	blockEvents map[uint32][]*mockEvent
+
+	// tokenModels are the OEP-4 tokens a deploy transaction of their code creates
+	tokenModels map[common.Address]*mockTokenModel
+
+	listener net.Listener
+	server *http.Server
+	quit chan struct{}
+	// done is closed when the block producer has returned
+	done chan struct{}
+}
+
+func NewMockNode(factoryAddr, ontdAddr common.Address) *MockNode {
+	ledger := newMockLedger(factoryAddr, ontdAddr)
+	ledger.deploy(factoryAddr, "factory")
+	ledger.deploy(ontdAddr, "ontd")
+	ledger.meta[ontdAddr] = mockTokenMeta{"ONTD Token", "ONTD", 9}
+	return &MockNode{
+		BlockInterval: 200 * time.Millisecond,
+		ledger:        ledger,
+		blockTime:     time.Now().Unix(),
+		txHeight:      make(map[common.Uint256]uint32),
+		events:        make(map[common.Uint256]*mockEvent),
+		blockEvents:   make(map[uint32][]*mockEvent),
+		tokenModels:   make(map[common.Address]*mockTokenModel),
+	}
+}
+
+type mockTokenModel struct {
+	meta mockTokenMeta
+	supply *big.Int
+}
+
+// ModelToken makes a deploy transaction of code create an OEP-4 token, whose init mints supply to the deployer
+func (this *MockNode) ModelToken(code []byte, symbol string, decimals int64, supply *big.Int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.tokenModels[common.AddressFromVmCode(code)] = &mockTokenModel{mockTokenMeta{symbol + " Token", symbol, decimals}, supply}
+}
+
+// DeployToken registers an OEP-4 token
+func (this *MockNode) DeployToken(tokenAddr common.Address, symbol string, decimals int64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.ledger.sim.Tokens[tokenAddr]; !ok {
+		this.ledger.sim.Tokens[tokenAddr] = NewOffChainTokenState(tokenAddr)
+	}
+	this.ledger.meta[tokenAddr] = mockTokenMeta{symbol + " Token", symbol, decimals}
+	this.ledger.deploy(tokenAddr, "token")
+}
+
+// InitializeFactory sets the exchange template of the factory, like initializeFactory does
+func (this *MockNode) InitializeFactory(template common.Address) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.ledger.template = template
+}
+
+// DeployExchange registers the exchange of token in the factory, like createExchange does
+func (this *MockNode) DeployExchange(exchangeAddr, tokenAddr common.Address) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.ledger.addExchange(exchangeAddr, tokenAddr)
+}
+
+// Mint credits amount of asset to owner, asset is ONT, ONG, ONTD or a deployed token
+func (this *MockNode) Mint(asset, owner common.Address, amount *big.Int) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	ledger := this.ledger.token(asset)
+	if ledger == nil {
+		ledger = this.ledger.native[asset]
+	}
+	if ledger == nil {
+		return fmt.Errorf("Mint, asset: %s is not deployed", asset.ToHexString())
+	}
+	ledger.Mint(owner, amount)
+	return nil
+}
+
+// SeedLiquidity moves reserves into exchange and credits the minted shares to provider without any transaction
+func (this *MockNode) SeedLiquidity(exchangeAddr, provider common.Address, ontdAmt, tokenAmt *big.Int) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	sim := this.ledger.sim
+	exchange, token, err := sim.exchange(exchangeAddr)
+	if err != nil {
+		return fmt.Errorf("SeedLiquidity, %v", err)
+	}
+	minted := new(big.Int).Set(ontdAmt)
+	if exchange.ShareSupply.Sign() > 0 {
+		minted.Div(minted.Mul(minted, exchange.ShareSupply), sim.Ontd.BalanceOf(exchangeAddr))
+	}
+	sim.Ontd.Mint(exchangeAddr, ontdAmt)
+	token.Mint(exchangeAddr, tokenAmt)
+	exchange.ShareBalance[provider] = new(big.Int).Add(exchange.shareOf(provider), minted)
+	exchange.ShareSupply = new(big.Int).Add(exchange.ShareSupply, minted)
+	return nil
+}
+
+// Start serves the json rpc on a random local port and produces blocks until Close, it returns the rpc address
+func (this *MockNode) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("Start, listen error: %v", err)
+	}
+	this.listener = listener
+	this.server = &http.Server{Handler: http.HandlerFunc(this.serveRpc)}
+	quit, done := make(chan struct{}), make(chan struct{})
+	this.lock.Lock()
+	this.quit, this.done = quit, done
+	this.lock.Unlock()
+	go this.server.Serve(listener)
+	go this.produceBlocks(quit, done)
+	return "http://" + listener.Addr().String(), nil
+}
+
+// Close stops the rpc server and waits for the block producer to return
+func (this *MockNode) Close() {
+	this.lock.Lock()
+	quit, done := this.quit, this.done
+	this.quit, this.done = nil, nil
+	this.lock.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	this.server.Close()
+	<-done
+}
+
+// Height returns the current block height
+func (this *MockNode) Height() uint32 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.height
+}
+
+func (this *MockNode) produceBlocks(quit, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(this.BlockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			this.generateBlock()
+		}
+	}
+}
+
+// generateBlock executes the pending transactions in a new block
+func (this *MockNode) generateBlock() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.height++
+	this.blockTime = time.Now().Unix()
+	for _, tx := range this.pending {
+		event := this.execute(tx)
+		this.txHeight[tx.Hash()] = this.height
+		this.events[tx.Hash()] = event
+		this.blockEvents[this.height] = append(this.blockEvents[this.height], event)
+	}
+	this.pending = nil
+}
+
+func (this *MockNode) newContext(ledger *mockLedger, tx *types.Transaction) *mockContext {
+	ctx := &mockContext{ledger: ledger, witnesses: make(map[common.Address]bool), now: this.blockTime}
+	for _, addr := range tx.GetSignatureAddresses() {
+		ctx.witnesses[addr] = true
+	}
+	return ctx
+}
+
+func gasUsed(tx *types.Transaction) uint64 {
+	if tx.GasLimit < MOCK_GAS_USED {
+		return tx.GasLimit
+	}
+	return MOCK_GAS_USED
+}
+
+// execute runs tx on a copy of the ledger, the copy is kept only when tx succeeds. The gas fee is paid in any case.
+func (this *MockNode) execute(tx *types.Transaction) *mockEvent {
+	hash := tx.Hash()
+	event := &mockEvent{TxHash: hash.ToHexString(), Notify: make([]*mockNotify, 0)}
+	ledger := this.ledger.clone()
+	switch code := tx.Payload.(type) {
+	case *payload.DeployCode:
+		addr := code.Address()
+		if _, ok := ledger.contracts[addr]; ok {
+			log.Debugf("MockNode, tx: %s failed: contract: %s exists", hash.ToHexString(), addr.ToHexString())
+			break
+		}
+		ledger.contracts[addr] = code
+		if model, ok := this.tokenModels[addr]; ok {
+			ledger.sim.Tokens[addr] = NewOffChainTokenState(addr)
+			ledger.meta[addr] = model.meta
+			ledger.inits[addr] = &mockTokenInit{Owner: tx.Payer, Supply: model.supply}
+		}
+		this.ledger, event.State = ledger, 1
+	case *payload.InvokeCode:
+		ctx := this.newContext(ledger, tx)
+		if _, err := ctx.run(code.Code); err != nil {
+			log.Debugf("MockNode, tx: %s failed: %v", hash.ToHexString(), err)
+			event.Notify = append(event.Notify, &mockNotify{ContractAddress: invokedContract(code.Code), States: []interface{}{hex.EncodeToString([]byte(err.Error()))}})
+		} else {
+			this.ledger, event.State, event.Notify = ledger, 1, ctx.notify
+		}
+	}
+
+	ong := this.ledger.nativeAsset(ontology_go_sdk.ONG_CONTRACT_ADDRESS)
+	fee := new(big.Int).SetUint64(tx.GasPrice * gasUsed(tx))
+	if balance := ong.BalanceOf(tx.Payer); balance.Cmp(fee) < 0 {
+		fee = balance
+	}
+	if fee.Sign() > 0 {
+		ong.Transfer(tx.Payer, nutils.GovernanceContractAddress, fee)
+		event.Notify = append(event.Notify, &mockNotify{ContractAddress: ontology_go_sdk.ONG_CONTRACT_ADDRESS.ToHexString(), States: []interface{}{"transfer", tx.Payer.ToBase58(), nutils.GovernanceContractAddress.ToBase58(), fee.Uint64()}})
+	}
+	event.GasConsumed = fee.Uint64()
+	return event
+}
+
+// invokedContract returns the contract of the last APPCALL in code, which the failure notify is attributed to
+func invokedContract(code []byte) string {
+	if len(code) > common.ADDR_LEN && code[len(code)-common.ADDR_LEN-1] == 0x67 {
+		addr, _ := common.AddressParseFromBytes(code[len(code)-common.ADDR_LEN:])
+		return addr.ToHexString()
+	}
+	return ""
+}
+
+type mockRpcRequest struct {
+	Id interface{} `json:"id"`
+	Method string `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type mockRpcResponse struct {
+	Id interface{} `json:"id"`
+	Error int64 `json:"error"`
+	Desc string `json:"desc"`
+	Result interface{} `json:"result"`
+}
+
+func (this *MockNode) serveRpc(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &mockRpcRequest{}
+	resp := &mockRpcResponse{Desc: "SUCCESS"}
+	if err := json.Unmarshal(body, req); err != nil {
+		resp.Error, resp.Desc = MOCK_INVALID_PARAMS, err.Error()
+	} else {
+		resp.Id = req.Id
+		var code int64
+		resp.Result, code, err = this.handle(req.Method, req.Params)
+		if err != nil {
+			resp.Error, resp.Desc, resp.Result = code, err.Error(), ""
+		}
+	}
+	data, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (this *MockNode) handle(method string, params []interface{}) (interface{}, int64, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	switch method {
+	case "getversion":
+		return "mock", MOCK_SUCCESS, nil
+	case "getnetworkid":
+		return 0, MOCK_SUCCESS, nil
+	case "getblockcount":
+		return this.height + 1, MOCK_SUCCESS, nil
+	case "sendrawtransaction":
+		return this.sendRawTransaction(params)
+	case "getsmartcodeevent":
+		if len(params) != 1 {
+			return nil, MOCK_INVALID_PARAMS, fmt.Errorf("invalid params")
+		}
+		if height, ok := params[0].(float64); ok {
+			return this.blockEvents[uint32(height)], MOCK_SUCCESS, nil
+		}
+		hash, err := hashParam(params)
+		if err != nil {
+			return nil, MOCK_INVALID_PARAMS, err
+		}
+		// the node answers null for a transaction not in a block yet
+		if event, ok := this.events[hash]; ok {
+			return event, MOCK_SUCCESS, nil
+		}
+		return nil, MOCK_SUCCESS, nil
+	case "getblockheightbytxhash":
+		hash, err := hashParam(params)
+		if err != nil {
+			return nil, MOCK_INVALID_PARAMS, err
+		}
+		height, ok := this.txHeight[hash]
+		if !ok {
+			return nil, MOCK_UNKNOWN_TRANSACTION, fmt.Errorf("UNKNOWN TRANSACTION")
+		}
+		return height, MOCK_SUCCESS, nil
+	case "getcontractstate":
+		if len(params) < 1 {
+			return nil, MOCK_INVALID_PARAMS, fmt.Errorf("invalid params")
+		}
+		hexAddr, _ := params[0].(string)
+		addr, err := common.AddressFromHexString(hexAddr)
+		if err != nil {
+			return nil, MOCK_INVALID_PARAMS, err
+		}
+		dc, ok := this.ledger.contracts[addr]
+		if !ok {
+			return nil, MOCK_UNKNOWN_CONTRACT, fmt.Errorf("UNKNOWN CONTRACT")
+		}
+		sink := common.NewZeroCopySink(nil)
+		dc.Serialization(sink)
+		return hex.EncodeToString(sink.Bytes()), MOCK_SUCCESS, nil
+	}
+	return nil, MOCK_INVALID_METHOD, fmt.Errorf("INVALID METHOD")
+}
+
+func hashParam(params []interface{}) (common.Uint256, error) {
+	if len(params) < 1 {
+		return common.UINT256_EMPTY, fmt.Errorf("invalid params")
+	}
+	hexHash, _ := params[0].(string)
+	return common.Uint256FromHexString(hexHash)
+}
+
+func (this *MockNode) sendRawTransaction(params []interface{}) (interface{}, int64, error) {
+	if len(params) < 1 {
+		return nil, MOCK_INVALID_PARAMS, fmt.Errorf("invalid params")
+	}
+	txHex, _ := params[0].(string)
+	raw, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, MOCK_INVALID_PARAMS, err
+	}
+	tx, err := types.TransactionFromRawBytes(raw)
+	if err != nil {
+		return nil, MOCK_INVALID_PARAMS, err
+	}
+	if len(params) > 1 {
+		return this.preExec(tx)
+	}
+
+	hash := tx.Hash()
+	if _, ok := this.events[hash]; ok {
+		return nil, MOCK_INTERNAL_ERROR, fmt.Errorf("transaction: %s is already in the ledger", hash.ToHexString())
+	}
+	for _, pending := range this.pending {
+		if pending.Hash() == hash {
+			return nil, MOCK_INTERNAL_ERROR, fmt.Errorf("transaction: %s is already pending", hash.ToHexString())
+		}
+	}
+	// like the tx pool, the payer must afford the whole gas limit
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(tx.GasPrice), new(big.Int).SetUint64(tx.GasLimit))
+	if this.ledger.nativeAsset(ontology_go_sdk.ONG_CONTRACT_ADDRESS).BalanceOf(tx.Payer).Cmp(fee) < 0 {
+		return nil, MOCK_INTERNAL_ERROR, fmt.Errorf("payer: %s has not enough ong for gas limit %d * gas price %d", tx.Payer.ToBase58(), tx.GasLimit, tx.GasPrice)
+	}
+	this.pending = append(this.pending, tx)
+	return hash.ToHexString(), MOCK_SUCCESS, nil
+}
+
+// preExec runs tx against a copy of the ledger and discards the changes
+func (this *MockNode) preExec(tx *types.Transaction) (interface{}, int64, error) {
+	code, ok := tx.Payload.(*payload.InvokeCode)
+	if !ok {
+		return nil, MOCK_INVALID_PARAMS, fmt.Errorf("only invoke transactions can be pre-executed")
+	}
+	ctx := this.newContext(this.ledger.clone(), tx)
+	ctx.now = time.Now().Unix()
+	result, err := ctx.run(code.Code)
+	if err != nil {
+		return nil, MOCK_SMARTCODE_ERROR, err
+	}
+	return map[string]interface{}{
+		"State":  1,
+		"Gas":    MOCK_GAS_USED,
+		"Result": encodeResult(result),
+		"Notify": ctx.notify,
+	}, MOCK_SUCCESS, nil
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"github.com/skyinglyh1/uniswap_v1_test/log"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// testNode is the MockNode behind testEnv, it is nil when the tests run against a real node
+var testNode *MockNode
+
+// TestMain runs the tests against the node of the config file in ONT_TEST_CONFIG, or against a fresh MockNode
+func TestMain(m *testing.M) {
+	log.InitLog(1, log.Stdout)
+	var err error
+	if configFile := os.Getenv("ONT_TEST_CONFIG"); configFile != "" {
+		testEnv, err = setupRealEnv(configFile)
+	} else {
+		testNode, testEnv, err = setupMockEnv()
+	}
+	if err != nil {
+		fmt.Printf("TestMain, setup test env error: %v\n", err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	log.Infof("gas spent by the helpers:\n%s", testEnv.Gas.Report())
+	if testNode != nil {
+		testNode.Close()
+	}
+	os.Exit(code)
+}
+
+func setupRealEnv(configFile string) (*TestEnv, error) {
+	if err := config.DefConfig.Init(configFile); err != nil {
+		return nil, fmt.Errorf("DefConfig.Init error: %v", err)
+	}
+	return NewTestEnv(config.DefConfig)
+}
+
+func mockAddr(name string) common.Address {
+	return common.AddressFromVmCode([]byte(name))
+}
+
+// setupMockEnv deploys ONTD, three tokens and their exchanges on a MockNode, funds three accounts and lets the
+// first one seed all the pools
+func setupMockEnv() (*MockNode, *TestEnv, error) {
+	return setupMockEnvWithQuote(mockAddr("ontd"))
+}
+
+// setupMockEnvWithQuote is setupMockEnv with the pools quoted in ontd, which can be the native ONG
+func setupMockEnvWithQuote(ontd common.Address) (*MockNode, *TestEnv, error) {
+	factory := mockAddr("factory")
+	tokens := []common.Address{mockAddr("token1"), mockAddr("token2"), mockAddr("token3")}
+	exchanges := []common.Address{mockAddr("exchange1"), mockAddr("exchange2"), mockAddr("exchange3")}
+	accts := []*ontology_go_sdk.Account{ontology_go_sdk.NewAccount(), ontology_go_sdk.NewAccount(), ontology_go_sdk.NewAccount()}
+
+	node := NewMockNode(factory, ontd)
+	node.BlockInterval = 100 * time.Millisecond
+	node.InitializeFactory(mockAddr("exchange template"))
+	for i := range tokens {
+		node.DeployToken(tokens[i], fmt.Sprintf("TK%d", i+1), 9)
+		node.DeployExchange(exchanges[i], tokens[i])
+	}
+	for _, acct := range accts {
+		for _, asset := range append([]common.Address{ontology_go_sdk.ONG_CONTRACT_ADDRESS, ontd}, tokens...) {
+			if err := node.Mint(asset, acct.Address, big.NewInt(1000000000000000)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	for i := range exchanges {
+		if err := node.SeedLiquidity(exchanges[i], accts[0].Address, big.NewInt(10000000000), big.NewInt(20000000000)); err != nil {
+			return nil, nil, err
+		}
+	}
+	url, err := node.Start()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := &config.Config{
+		OntRpcAddress: url,
+		FactoryHash:   factory.ToHexString(),
+		OntdHash:      ontd.ToHexString(),
+		GasPrice:      500,
+		GasLimit:      20000,
+		WaitTxTimeOut: 10,
+	}
+	for i := range tokens {
+		cfg.Pairs = append(cfg.Pairs, &config.Pair{TokenHash: tokens[i].ToHexString(), ExchangeHash: exchanges[i].ToHexString()})
+	}
+	env, err := NewTestEnv(cfg, WithClient(NewRpcClient(url)), WithAccounts(accts))
+	if err != nil {
+		node.Close()
+		return nil, nil, err
+	}
+	return node, env, nil
+}
+
+func Test_MockNode(t *testing.T) {
+	if testNode == nil {
+		t.Skip("running against a real node")
+	}
+	client, owner, spender := testEnv.Client, testEnv.Users[1], testEnv.Users[2].Address
+	token := testEnv.OnChainTState[0].TokenAddr
+	ong := NewAsset(client, ontology_go_sdk.ONG_CONTRACT_ADDRESS)
+	ongBefore, err := ong.BalanceOf(owner.Address)
+	if err != nil {
+		t.Fatalf("BalanceOf error: %v", err)
+	}
+
+	txHash, err := client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, owner, owner, token, []interface{}{"approve", []interface{}{owner.Address, spender, big.NewInt(12345)}})
+	if err != nil {
+		t.Fatalf("approve error: %v", err)
+	}
+	if _, err := client.WaitForGenerateBlock(testEnv.WaitTxTimeOut, 1); err != nil {
+		t.Fatalf("WaitForGenerateBlock error: %v", err)
+	}
+	event, err := client.GetSmartContractEvent(txHash.ToHexString())
+	if err != nil || event == nil {
+		t.Fatalf("GetSmartContractEvent: %v, error: %v", event, err)
+	}
+	if event.State != 1 || len(event.Notify) != 2 {
+		t.Fatalf("approve event: %+v", event)
+	}
+	allowances, err := GetAllowances(client, token, owner.Address, []common.Address{spender})
+	if err != nil {
+		t.Fatalf("GetAllowances error: %v", err)
+	}
+	if allowances[spender].Cmp(big.NewInt(12345)) != 0 {
+		t.Fatalf("allowance: %v, expect 12345", allowances[spender])
+	}
+	ongAfter, err := ong.BalanceOf(owner.Address)
+	if err != nil {
+		t.Fatalf("BalanceOf error: %v", err)
+	}
+	if new(big.Int).Sub(ongBefore, ongAfter).Uint64() != event.GasConsumed || event.GasConsumed != testEnv.GasPrice*MOCK_GAS_USED {
+		t.Fatalf("ong: %d -> %d, gas consumed: %d", ongBefore, ongAfter, event.GasConsumed)
+	}
+
+	// a failed transaction keeps the state but still pays the gas
+	txHash, err = client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, owner, owner, token, []interface{}{"transferFrom", []interface{}{owner.Address, spender, owner.Address, big.NewInt(1)}})
+	if err != nil {
+		t.Fatalf("transferFrom error: %v", err)
+	}
+	if _, err := client.WaitForGenerateBlock(testEnv.WaitTxTimeOut, 1); err != nil {
+		t.Fatalf("WaitForGenerateBlock error: %v", err)
+	}
+	event, err = client.GetSmartContractEvent(txHash.ToHexString())
+	if err != nil || event == nil {
+		t.Fatalf("GetSmartContractEvent: %v, error: %v", event, err)
+	}
+	if event.State != 0 || event.GasConsumed == 0 {
+		t.Fatalf("transferFrom without allowance event: %+v", event)
+	}
+
+	if _, err := client.GetSmartContract(token.ToHexString()); err != nil {
+		t.Fatalf("GetSmartContract error: %v", err)
+	}
+}
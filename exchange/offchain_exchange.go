@@ -18,83 +18,643 @@
 package exchange
 
 import (
+	"errors"
+	"fmt"
 	"github.com/ontio/ontology/common"
 	"github.com/skyinglyh1/uniswap_v1_test/log"
 	"math/big"
+	"time"
 )
 
+// The minimum ontd of the first deposit, as required by uniswap_exchange.py
+const MIN_INITIAL_ONTD = 1000000000
+
+var (
+	ErrDeadlineExpired        = errors.New("deadline expired")
+	ErrZeroAmount             = errors.New("amount must be positive")
+	ErrEmptyReserve           = errors.New("reserves must be positive")
+	ErrNoLiquidity            = errors.New("total liquidity is zero")
+	ErrInitialOntdTooLow      = errors.New("initial ontd deposit too low")
+	ErrInvalidExchangeSetup   = errors.New("exchange token or factory not set")
+	ErrMinLiquidityNotReached = errors.New("liquidity minted less than min liquidity")
+	ErrMaxTokensExceeded      = errors.New("tokens needed exceed max tokens")
+	ErrMaxOntdExceeded        = errors.New("ontd needed exceeds max ontd")
+	ErrMinTokensNotReached    = errors.New("tokens bought less than min tokens")
+	ErrMinOntdNotReached      = errors.New("ontd bought less than min ontd")
+	ErrInvalidTargetExchange  = errors.New("invalid target exchange")
+	ErrInsufficientShare      = errors.New("share balance not enough")
+	ErrInsufficientBalance    = errors.New("balance not enough")
+	ErrInsufficientAllowance  = errors.New("allowance not enough")
+)
+
+// OffChainTokenState is the ledger of an OEP-4 token
+type OffChainTokenState struct {
+	TokenAddr common.Address
+	Balances map[common.Address]*big.Int
+	// owner => spender => allowance
+	Allowances map[common.Address]map[common.Address]*big.Int
+	Supply *big.Int
+}
+
+func NewOffChainTokenState(tokenAddr common.Address) *OffChainTokenState {
+	return &OffChainTokenState{
+		TokenAddr:  tokenAddr,
+		Balances:   make(map[common.Address]*big.Int),
+		Allowances: make(map[common.Address]map[common.Address]*big.Int),
+		Supply:     big.NewInt(0),
+	}
+}
+
+func (this *OffChainTokenState) BalanceOf(owner common.Address) *big.Int {
+	if balance, ok := this.Balances[owner]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return big.NewInt(0)
+}
+
+func (this *OffChainTokenState) Allowance(owner, spender common.Address) *big.Int {
+	if allowance, ok := this.Allowances[owner][spender]; ok {
+		return new(big.Int).Set(allowance)
+	}
+	return big.NewInt(0)
+}
+
+// Mint credits amount to owner and increases the supply, it is used to seed the ledger
+func (this *OffChainTokenState) Mint(owner common.Address, amount *big.Int) {
+	this.Balances[owner] = new(big.Int).Add(this.BalanceOf(owner), amount)
+	this.Supply = new(big.Int).Add(this.Supply, amount)
+}
+
+func (this *OffChainTokenState) Approve(owner, spender common.Address, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return ErrZeroAmount
+	}
+	if this.Allowances[owner] == nil {
+		this.Allowances[owner] = make(map[common.Address]*big.Int)
+	}
+	this.Allowances[owner][spender] = new(big.Int).Set(amount)
+	return nil
+}
+
+func (this *OffChainTokenState) Transfer(from, to common.Address, amount *big.Int) error {
+	if amount.Sign() < 0 {
+		return ErrZeroAmount
+	}
+	if this.BalanceOf(from).Cmp(amount) < 0 {
+		return ErrInsufficientBalance
+	}
+	this.Balances[from] = new(big.Int).Sub(this.BalanceOf(from), amount)
+	this.Balances[to] = new(big.Int).Add(this.BalanceOf(to), amount)
+	return nil
+}
+
+func (this *OffChainTokenState) TransferFrom(spender, from, to common.Address, amount *big.Int) error {
+	allowance := this.Allowance(from, spender)
+	if allowance.Cmp(amount) < 0 {
+		return ErrInsufficientAllowance
+	}
+	if err := this.Transfer(from, to, amount); err != nil {
+		return err
+	}
+	this.Allowances[from][spender] = allowance.Sub(allowance, amount)
+	return nil
+}
+
+func (this *OffChainTokenState) clone() *OffChainTokenState {
+	c := NewOffChainTokenState(this.TokenAddr)
+	c.Supply = new(big.Int).Set(this.Supply)
+	for owner, balance := range this.Balances {
+		c.Balances[owner] = new(big.Int).Set(balance)
+	}
+	for owner, spenders := range this.Allowances {
+		c.Allowances[owner] = make(map[common.Address]*big.Int)
+		for spender, allowance := range spenders {
+			c.Allowances[owner][spender] = new(big.Int).Set(allowance)
+		}
+	}
+	return c
+}
+
+// OffChainExchangeState is the share ledger of one exchange, its reserves are the balances of ExchangeAddr in the
+// ontd and token ledgers, the same way the contract reads them through balanceOf
 type OffChainExchangeState struct {
+	ExchangeAddr common.Address
 	TokenAddr common.Address
 	FactoryAddr common.Address
-	OngLiquid uint64
-	TokenLiquid *big.Int
 	ShareBalance map[common.Address]*big.Int
 	ShareSupply *big.Int
 }
 
+func (this *OffChainExchangeState) shareOf(owner common.Address) *big.Int {
+	if balance, ok := this.ShareBalance[owner]; ok {
+		return new(big.Int).Set(balance)
+	}
+	return big.NewInt(0)
+}
+
+func (this *OffChainExchangeState) clone() *OffChainExchangeState {
+	c := &OffChainExchangeState{
+		ExchangeAddr: this.ExchangeAddr,
+		TokenAddr:    this.TokenAddr,
+		FactoryAddr:  this.FactoryAddr,
+		ShareBalance: make(map[common.Address]*big.Int),
+		ShareSupply:  new(big.Int).Set(this.ShareSupply),
+	}
+	for owner, balance := range this.ShareBalance {
+		c.ShareBalance[owner] = new(big.Int).Set(balance)
+	}
+	return c
+}
 
+// OffChainSimulator applies the uniswap_exchange.py operations to in-memory ledgers without any chain connection.
+// Every operation either succeeds as a whole or fails with the error the contract asserts on and leaves the state
+// untouched.
+type OffChainSimulator struct {
+	FactoryAddr common.Address
+	Ontd *OffChainTokenState
+	Tokens map[common.Address]*OffChainTokenState
+	Exchanges map[common.Address]*OffChainExchangeState
+	TokenToExchange map[common.Address]common.Address
+	// Now returns the block timestamp the deadlines are checked against
+	Now func() int64
+}
 
-func (this *OnChainExchangeState) getInputPrice(inputAmt *big.Int, inputReserve *big.Int, outputReserve *big.Int) *big.Int {
-	if (inputReserve.Cmp(big.NewInt(0)) < 1 && outputReserve.Cmp(big.NewInt(0)) < 1) {
-		panic("_getInputPrice, assert error")
+func NewOffChainSimulator(factoryAddr, ontdAddr common.Address) *OffChainSimulator {
+	return &OffChainSimulator{
+		FactoryAddr:     factoryAddr,
+		Ontd:            NewOffChainTokenState(ontdAddr),
+		Tokens:          make(map[common.Address]*OffChainTokenState),
+		Exchanges:       make(map[common.Address]*OffChainExchangeState),
+		TokenToExchange: make(map[common.Address]common.Address),
+		Now: func() int64 {
+			return time.Now().Unix()
+		},
 	}
-	inputAmtWithFee := big.NewInt(0).Mul(inputAmt, big.NewInt(9975))
-	numerator := big.NewInt(0).Mul(inputAmtWithFee, outputReserve)
-	denominator := big.NewInt(0).Add(big.NewInt(0).Mul(inputReserve, big.NewInt(10000)), inputAmtWithFee)
-	return big.NewInt(0).Div(numerator, denominator)
 }
 
-func (this *OnChainExchangeState) getOutputPrice(outputAmt *big.Int, inputReserve *big.Int, outputReserve *big.Int) *big.Int {
-	numerator := big.NewInt(0).Mul(big.NewInt(0).Mul(inputReserve, outputAmt), big.NewInt(10000))
-	denominator := big.NewInt(0).Mul(big.NewInt(0).Sub(outputReserve, outputAmt), big.NewInt(9975))
-	return big.NewInt(0).Add(big.NewInt(0).Div(numerator, denominator), big.NewInt(1))
+// AddExchange registers the exchange of token the way the factory createExchange does
+func (this *OffChainSimulator) AddExchange(exchangeAddr, tokenAddr common.Address) *OffChainExchangeState {
+	if _, ok := this.Tokens[tokenAddr]; !ok {
+		this.Tokens[tokenAddr] = NewOffChainTokenState(tokenAddr)
+	}
+	exchange := &OffChainExchangeState{
+		ExchangeAddr: exchangeAddr,
+		TokenAddr:    tokenAddr,
+		FactoryAddr:  this.FactoryAddr,
+		ShareBalance: make(map[common.Address]*big.Int),
+		ShareSupply:  big.NewInt(0),
+	}
+	this.Exchanges[exchangeAddr] = exchange
+	this.TokenToExchange[tokenAddr] = exchangeAddr
+	return exchange
 }
 
-func (this *OnChainExchangeState) offOntToTokenInput(ontdSold *big.Int, minTokens *big.Int) error {
-	tokenBought := this.getInputPrice(ontdSold, this.OntdLiquid, this.TokenLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	log.Debugf("offOntToTokenInput, ontToTokenInput, tokenBought is %+v, minTokens is %+v", tokenBought.String(), minTokens.String())
-	return nil
+// Reserves returns the ontd and token reserves of the exchange
+func (this *OffChainSimulator) Reserves(exchangeAddr common.Address) (*big.Int, *big.Int, error) {
+	exchange, token, err := this.exchange(exchangeAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return this.Ontd.BalanceOf(exchange.ExchangeAddr), token.BalanceOf(exchange.ExchangeAddr), nil
 }
-func (this *OnChainExchangeState) offOntToTokenOutput(tokensBought *big.Int, maxOntd *big.Int) error {
-	ontdSold := this.getOutputPrice(tokensBought, this.OntdLiquid, this.TokenLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	log.Debugf("offOntToTokenOutput, OntToTokenOutput, ontdSold is %+v, maxOntd is %+v", ontdSold.String(), maxOntd.String())
-	return nil
+
+func (this *OffChainSimulator) Clone() *OffChainSimulator {
+	c := NewOffChainSimulator(this.FactoryAddr, this.Ontd.TokenAddr)
+	c.Now = this.Now
+	c.Ontd = this.Ontd.clone()
+	for addr, token := range this.Tokens {
+		c.Tokens[addr] = token.clone()
+	}
+	for addr, exchange := range this.Exchanges {
+		c.Exchanges[addr] = exchange.clone()
+	}
+	for token, exchange := range this.TokenToExchange {
+		c.TokenToExchange[token] = exchange
+	}
+	return c
 }
-func (this *OnChainExchangeState) offTokenToOntInput(tokenSold *big.Int, minOng *big.Int) error {
-	ongBought := this.getInputPrice(tokenSold, this.TokenLiquid, this.OntdLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	log.Debugf("offTokenToOntInput, ongBought is %+v, minOng is %+v", ongBought.String(), minOng.String())
-	return nil
+
+func (this *OffChainSimulator) exchange(exchangeAddr common.Address) (*OffChainExchangeState, *OffChainTokenState, error) {
+	exchange, ok := this.Exchanges[exchangeAddr]
+	if !ok {
+		return nil, nil, fmt.Errorf("exchange: %s is not simulated", exchangeAddr.ToHexString())
+	}
+	token, ok := this.Tokens[exchange.TokenAddr]
+	if !ok {
+		return nil, nil, fmt.Errorf("token: %s of exchange: %s is not simulated", exchange.TokenAddr.ToHexString(), exchangeAddr.ToHexString())
+	}
+	return exchange, token, nil
 }
-func (this *OnChainExchangeState) offTokenToOntOutput(ongBought *big.Int, maxTokens *big.Int) error {
-	tokenSold := this.getOutputPrice(ongBought, this.TokenLiquid, this.OntdLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	log.Debugf("offTokenToOntOutput, tokenSold is %+v, maxToken is %+v", tokenSold.String(), maxTokens.String())
+
+// atomic runs op on a copy of the state and only keeps the result when op succeeds, like a reverted transaction
+func (this *OffChainSimulator) atomic(op func(sim *OffChainSimulator) error) error {
+	c := this.Clone()
+	if err := op(c); err != nil {
+		return err
+	}
+	*this = *c
 	return nil
 }
 
-func (this *TestEnv) offTokenToTokenInput(tokenSold *big.Int) (*big.Int, *big.Int) {
-	ontdBought := this.OnChainEState[0].getInputPrice(tokenSold, this.OnChainEState[0].TokenLiquid, this.OnChainEState[0].OntdLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	tokenBought := this.OnChainEState[1].getInputPrice(ontdBought, this.OnChainEState[1].OntdLiquid, this.OnChainEState[1].TokenLiquid)
-	log.Debugf("offTokenToTokenInput, tokenSold is %+v, minOntdBought is %+v,  minTokenBought is is %+v", tokenSold.String(), ontdBought, tokenBought.String())
-	return ontdBought, tokenBought
+// getInputPrice is the contract's getInputPrice including its reserve assertion
+func getInputPrice(inputAmt, inputReserve, outputReserve *big.Int) (*big.Int, error) {
+	if inputReserve.Sign() <= 0 || outputReserve.Sign() <= 0 {
+		return nil, ErrEmptyReserve
+	}
+	return inputPrice(inputAmt, inputReserve, outputReserve), nil
+}
+
+// getOutputPrice is the contract's getOutputPrice including its reserve assertion
+func getOutputPrice(outputAmt, inputReserve, outputReserve *big.Int) (*big.Int, error) {
+	if inputReserve.Sign() <= 0 || outputReserve.Sign() <= 0 || outputAmt.Cmp(outputReserve) >= 0 {
+		return nil, ErrEmptyReserve
+	}
+	return outputPrice(outputAmt, inputReserve, outputReserve), nil
+}
+
+// AddLiquidity returns the liquidity minted to depositer
+func (this *OffChainSimulator) AddLiquidity(exchangeAddr common.Address, minLiquidity, maxTokens *big.Int, deadline int64, depositer common.Address, ontdAmt *big.Int) (*big.Int, error) {
+	var minted *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		exchange, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if deadline <= sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if maxTokens.Sign() <= 0 || ontdAmt.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		var tokenAmt *big.Int
+		if exchange.ShareSupply.Sign() > 0 {
+			if minLiquidity.Sign() <= 0 {
+				return ErrZeroAmount
+			}
+			ontdReserve := sim.Ontd.BalanceOf(exchangeAddr)
+			tokenReserve := token.BalanceOf(exchangeAddr)
+			tokenAmt = new(big.Int).Add(new(big.Int).Div(new(big.Int).Mul(ontdAmt, tokenReserve), ontdReserve), big.NewInt(1))
+			minted = new(big.Int).Div(new(big.Int).Mul(ontdAmt, exchange.ShareSupply), ontdReserve)
+			if maxTokens.Cmp(tokenAmt) < 0 {
+				return ErrMaxTokensExceeded
+			}
+			if minted.Cmp(minLiquidity) < 0 {
+				return ErrMinLiquidityNotReached
+			}
+		} else {
+			if exchange.FactoryAddr == common.ADDRESS_EMPTY || exchange.TokenAddr == common.ADDRESS_EMPTY {
+				return ErrInvalidExchangeSetup
+			}
+			if ontdAmt.Cmp(big.NewInt(MIN_INITIAL_ONTD)) < 0 {
+				return ErrInitialOntdTooLow
+			}
+			tokenAmt = new(big.Int).Set(maxTokens)
+			minted = new(big.Int).Set(ontdAmt)
+		}
+		exchange.ShareBalance[depositer] = new(big.Int).Add(exchange.shareOf(depositer), minted)
+		exchange.ShareSupply = new(big.Int).Add(exchange.ShareSupply, minted)
+		if err := token.TransferFrom(exchangeAddr, depositer, exchangeAddr, tokenAmt); err != nil {
+			return err
+		}
+		return sim.Ontd.TransferFrom(exchangeAddr, depositer, exchangeAddr, ontdAmt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return minted, nil
+}
+
+// RemoveLiquidity burns amount shares of withdrawer and returns the ontd and tokens paid back
+func (this *OffChainSimulator) RemoveLiquidity(exchangeAddr common.Address, amount, minOntd, minTokens *big.Int, deadline int64, withdrawer common.Address) (*big.Int, *big.Int, error) {
+	var ontdAmt, tokenAmt *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		exchange, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if amount.Sign() <= 0 || minOntd.Sign() <= 0 || minTokens.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		if deadline <= sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if exchange.ShareSupply.Sign() <= 0 {
+			return ErrNoLiquidity
+		}
+		ontdAmt = new(big.Int).Div(new(big.Int).Mul(amount, sim.Ontd.BalanceOf(exchangeAddr)), exchange.ShareSupply)
+		tokenAmt = new(big.Int).Div(new(big.Int).Mul(amount, token.BalanceOf(exchangeAddr)), exchange.ShareSupply)
+		if ontdAmt.Cmp(minOntd) < 0 {
+			return ErrMinOntdNotReached
+		}
+		if tokenAmt.Cmp(minTokens) < 0 {
+			return ErrMinTokensNotReached
+		}
+		if exchange.shareOf(withdrawer).Cmp(amount) < 0 {
+			return ErrInsufficientShare
+		}
+		exchange.ShareBalance[withdrawer] = new(big.Int).Sub(exchange.shareOf(withdrawer), amount)
+		exchange.ShareSupply = new(big.Int).Sub(exchange.ShareSupply, amount)
+		if err := sim.Ontd.Transfer(exchangeAddr, withdrawer, ontdAmt); err != nil {
+			return err
+		}
+		return token.Transfer(exchangeAddr, withdrawer, tokenAmt)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ontdAmt, tokenAmt, nil
+}
+
+func (sim *OffChainSimulator) ontToTokenInput(exchangeAddr common.Address, ontdSold, minTokens *big.Int, deadline int64, buyer, recipient common.Address, pulled bool) (*big.Int, error) {
+	_, token, err := sim.exchange(exchangeAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline < sim.Now() {
+		return nil, ErrDeadlineExpired
+	}
+	if ontdSold.Sign() <= 0 || minTokens.Sign() <= 0 {
+		return nil, ErrZeroAmount
+	}
+	ontdReserve := sim.Ontd.BalanceOf(exchangeAddr)
+	if pulled {
+		// the ontd of a token to token trade is already in the reserve
+		ontdReserve.Sub(ontdReserve, ontdSold)
+	}
+	tokensBought, err := getInputPrice(ontdSold, ontdReserve, token.BalanceOf(exchangeAddr))
+	if err != nil {
+		return nil, err
+	}
+	if tokensBought.Cmp(minTokens) < 0 {
+		return nil, ErrMinTokensNotReached
+	}
+	if !pulled {
+		if err := sim.Ontd.TransferFrom(exchangeAddr, buyer, exchangeAddr, ontdSold); err != nil {
+			return nil, err
+		}
+	}
+	if err := token.Transfer(exchangeAddr, recipient, tokensBought); err != nil {
+		return nil, err
+	}
+	return tokensBought, nil
+}
+
+func (sim *OffChainSimulator) ontToTokenOutput(exchangeAddr common.Address, tokensBought, maxOntd *big.Int, deadline int64, buyer, recipient common.Address, pulled bool) (*big.Int, error) {
+	_, token, err := sim.exchange(exchangeAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline < sim.Now() {
+		return nil, ErrDeadlineExpired
+	}
+	if tokensBought.Sign() <= 0 || maxOntd.Sign() <= 0 {
+		return nil, ErrZeroAmount
+	}
+	ontdReserve := sim.Ontd.BalanceOf(exchangeAddr)
+	if pulled {
+		ontdReserve.Sub(ontdReserve, maxOntd)
+	}
+	ontdSold, err := getOutputPrice(tokensBought, ontdReserve, token.BalanceOf(exchangeAddr))
+	if err != nil {
+		return nil, err
+	}
+	if ontdSold.Cmp(maxOntd) > 0 {
+		return nil, ErrMaxOntdExceeded
+	}
+	if !pulled {
+		if err := sim.Ontd.TransferFrom(exchangeAddr, buyer, exchangeAddr, ontdSold); err != nil {
+			return nil, err
+		}
+	}
+	if err := token.Transfer(exchangeAddr, recipient, tokensBought); err != nil {
+		return nil, err
+	}
+	return ontdSold, nil
+}
+
+// OntToTokenInput sells ontdSold of buyer for tokens sent to recipient, a swap when recipient is buyer
+func (this *OffChainSimulator) OntToTokenInput(exchangeAddr common.Address, ontdSold, minTokens *big.Int, deadline int64, buyer, recipient common.Address) (*big.Int, error) {
+	var tokensBought *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		var err error
+		tokensBought, err = sim.ontToTokenInput(exchangeAddr, ontdSold, minTokens, deadline, buyer, recipient, false)
+		return err
+	})
+	return tokensBought, err
+}
+
+// OntToTokenOutput buys tokensBought for recipient with the ontd of buyer and returns the ontd sold
+func (this *OffChainSimulator) OntToTokenOutput(exchangeAddr common.Address, tokensBought, maxOntd *big.Int, deadline int64, buyer, recipient common.Address) (*big.Int, error) {
+	var ontdSold *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		var err error
+		ontdSold, err = sim.ontToTokenOutput(exchangeAddr, tokensBought, maxOntd, deadline, buyer, recipient, false)
+		return err
+	})
+	return ontdSold, err
+}
+
+// TokenToOntInput sells tokensSold of buyer for ontd sent to recipient and returns the ontd bought
+func (this *OffChainSimulator) TokenToOntInput(exchangeAddr common.Address, tokensSold, minOntd *big.Int, deadline int64, buyer, recipient common.Address) (*big.Int, error) {
+	var ontdBought *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		_, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if deadline < sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if tokensSold.Sign() <= 0 || minOntd.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		ontdBought, err = getInputPrice(tokensSold, token.BalanceOf(exchangeAddr), sim.Ontd.BalanceOf(exchangeAddr))
+		if err != nil {
+			return err
+		}
+		if ontdBought.Cmp(minOntd) < 0 {
+			return ErrMinOntdNotReached
+		}
+		if err := sim.Ontd.Transfer(exchangeAddr, recipient, ontdBought); err != nil {
+			return err
+		}
+		return token.TransferFrom(exchangeAddr, buyer, exchangeAddr, tokensSold)
+	})
+	return ontdBought, err
+}
+
+// TokenToOntOutput buys ontdBought for recipient with the tokens of buyer and returns the tokens sold
+func (this *OffChainSimulator) TokenToOntOutput(exchangeAddr common.Address, ontdBought, maxTokens *big.Int, deadline int64, buyer, recipient common.Address) (*big.Int, error) {
+	var tokensSold *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		_, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if deadline < sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if ontdBought.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		tokensSold, err = getOutputPrice(ontdBought, token.BalanceOf(exchangeAddr), sim.Ontd.BalanceOf(exchangeAddr))
+		if err != nil {
+			return err
+		}
+		if tokensSold.Cmp(maxTokens) > 0 {
+			return ErrMaxTokensExceeded
+		}
+		if err := sim.Ontd.Transfer(exchangeAddr, recipient, ontdBought); err != nil {
+			return err
+		}
+		return token.TransferFrom(exchangeAddr, buyer, exchangeAddr, tokensSold)
+	})
+	return tokensSold, err
+}
+
+// TokenToTokenInput sells tokensSold on exchangeAddr for the token of the exchange the factory created for tokenAddr
+func (this *OffChainSimulator) TokenToTokenInput(exchangeAddr common.Address, tokensSold, minTokensBought, minOntdBought *big.Int, deadline int64, buyer, recipient, tokenAddr common.Address) (*big.Int, error) {
+	return this.TokenToExchangeInput(exchangeAddr, tokensSold, minTokensBought, minOntdBought, deadline, buyer, recipient, this.TokenToExchange[tokenAddr])
+}
+
+// TokenToTokenOutput buys tokensBought of tokenAddr with the tokens of exchangeAddr and returns the tokens sold
+func (this *OffChainSimulator) TokenToTokenOutput(exchangeAddr common.Address, tokensBought, maxTokensSold, maxOntdSold *big.Int, deadline int64, buyer, recipient, tokenAddr common.Address) (*big.Int, error) {
+	return this.TokenToExchangeOutput(exchangeAddr, tokensBought, maxTokensSold, maxOntdSold, deadline, buyer, recipient, this.TokenToExchange[tokenAddr])
+}
+
+// TokenToExchangeInput sells tokensSold on exchangeAddr for ontd, and the ontd on targetAddr for its token
+func (this *OffChainSimulator) TokenToExchangeInput(exchangeAddr common.Address, tokensSold, minTokensBought, minOntdBought *big.Int, deadline int64, buyer, recipient, targetAddr common.Address) (*big.Int, error) {
+	var tokensBought *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		_, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if deadline < sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if tokensSold.Sign() <= 0 || minTokensBought.Sign() <= 0 || minOntdBought.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		if targetAddr == exchangeAddr || targetAddr == common.ADDRESS_EMPTY {
+			return ErrInvalidTargetExchange
+		}
+		ontdBought, err := getInputPrice(tokensSold, token.BalanceOf(exchangeAddr), sim.Ontd.BalanceOf(exchangeAddr))
+		if err != nil {
+			return err
+		}
+		if ontdBought.Cmp(minOntdBought) < 0 {
+			return ErrMinOntdNotReached
+		}
+		if err := token.TransferFrom(exchangeAddr, buyer, exchangeAddr, tokensSold); err != nil {
+			return err
+		}
+		// the ontd goes to the target exchange, which then runs ontToTokenTransferInput for recipient
+		if err := sim.Ontd.Transfer(exchangeAddr, targetAddr, ontdBought); err != nil {
+			return err
+		}
+		tokensBought, err = sim.ontToTokenInput(targetAddr, ontdBought, minTokensBought, deadline, exchangeAddr, recipient, true)
+		return err
+	})
+	return tokensBought, err
+}
+
+// TokenToExchangeOutput buys tokensBought on targetAddr with ontd bought by the tokens of exchangeAddr
+func (this *OffChainSimulator) TokenToExchangeOutput(exchangeAddr common.Address, tokensBought, maxTokensSold, maxOntdSold *big.Int, deadline int64, buyer, recipient, targetAddr common.Address) (*big.Int, error) {
+	var tokensSold *big.Int
+	err := this.atomic(func(sim *OffChainSimulator) error {
+		_, token, err := sim.exchange(exchangeAddr)
+		if err != nil {
+			return err
+		}
+		if deadline < sim.Now() {
+			return ErrDeadlineExpired
+		}
+		if tokensBought.Sign() <= 0 || maxOntdSold.Sign() <= 0 {
+			return ErrZeroAmount
+		}
+		if targetAddr == exchangeAddr || targetAddr == common.ADDRESS_EMPTY {
+			return ErrInvalidTargetExchange
+		}
+		_, targetToken, err := sim.exchange(targetAddr)
+		if err != nil {
+			return err
+		}
+		ontdBought, err := getOutputPrice(tokensBought, sim.Ontd.BalanceOf(targetAddr), targetToken.BalanceOf(targetAddr))
+		if err != nil {
+			return err
+		}
+		tokensSold, err = getOutputPrice(ontdBought, token.BalanceOf(exchangeAddr), sim.Ontd.BalanceOf(exchangeAddr))
+		if err != nil {
+			return err
+		}
+		if tokensSold.Cmp(maxTokensSold) > 0 {
+			return ErrMaxTokensExceeded
+		}
+		if ontdBought.Cmp(maxOntdSold) > 0 {
+			return ErrMaxOntdExceeded
+		}
+		if err := token.TransferFrom(exchangeAddr, buyer, exchangeAddr, tokensSold); err != nil {
+			return err
+		}
+		if err := sim.Ontd.Transfer(exchangeAddr, targetAddr, ontdBought); err != nil {
+			return err
+		}
+		_, err = sim.ontToTokenOutput(targetAddr, tokensBought, ontdBought, deadline, exchangeAddr, recipient, true)
+		return err
+	})
+	return tokensSold, err
+}
+
+// inputPrice is the amount bought when selling inputAmt, after the 0.25% fee
+func inputPrice(inputAmt *big.Int, inputReserve *big.Int, outputReserve *big.Int) *big.Int {
+	inputAmtWithFee := big.NewInt(0).Mul(inputAmt, big.NewInt(9975))
+	numerator := big.NewInt(0).Mul(inputAmtWithFee, outputReserve)
+	denominator := big.NewInt(0).Add(big.NewInt(0).Mul(inputReserve, big.NewInt(10000)), inputAmtWithFee)
+	return big.NewInt(0).Div(numerator, denominator)
 }
 
+// outputPrice is the amount to sell for buying outputAmt, after the 0.25% fee
+func outputPrice(outputAmt *big.Int, inputReserve *big.Int, outputReserve *big.Int) *big.Int {
+	numerator := big.NewInt(0).Mul(big.NewInt(0).Mul(inputReserve, outputAmt), big.NewInt(10000))
+	denominator := big.NewInt(0).Mul(big.NewInt(0).Sub(outputReserve, outputAmt), big.NewInt(9975))
+	return big.NewInt(0).Add(big.NewInt(0).Div(numerator, denominator), big.NewInt(1))
+}
 
-func (this *TestEnv) offTokenToTokenOutput(tokenBought *big.Int) (*big.Int, *big.Int) {
-	ontdBought := this.OnChainEState[0].getOutputPrice(tokenBought, this.OnChainEState[0].TokenLiquid, this.OnChainEState[0].OntdLiquid)
-	//TODO: exchange token balance increase ongBought
-	//TODO: exchange ong decrease ongBought
-	tokenBought1 := this.OnChainEState[1].getInputPrice(ontdBought, this.OnChainEState[1].OntdLiquid, this.OnChainEState[1].TokenLiquid)
-	log.Debugf("offTokenToTokenInput, tokenSold is %+v, minOntdBought is %+v,  minTokenBought is is %+v", tokenBought.String(), ontdBought, tokenBought.String())
-	return ontdBought, tokenBought1
+// offTokenToTokenInput prices selling tokensSold of soldPool for the token of boughtPool at the refreshed reserves,
+// it returns the ontd bought in soldPool and the tokens bought with it in boughtPool
+func (this *TestEnv) offTokenToTokenInput(soldPool, boughtPool int, tokensSold *big.Int) (*big.Int, *big.Int, error) {
+	if err := this.refreshPools(soldPool, boughtPool); err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenInput, refreshBalance err: %w", err)
+	}
+	sold, bought := this.OnChainEState[soldPool], this.OnChainEState[boughtPool]
+	ontdBought, err := getInputPrice(tokensSold, sold.TokenLiquid, sold.OntdLiquid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenInput, pool %d: %w", soldPool, err)
+	}
+	tokensBought, err := getInputPrice(ontdBought, bought.OntdLiquid, bought.TokenLiquid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenInput, pool %d: %w", boughtPool, err)
+	}
+	log.Debugf("offTokenToTokenInput, tokensSold: %s, ontdBought: %s, tokensBought: %s", tokensSold, ontdBought, tokensBought)
+	return ontdBought, tokensBought, nil
 }
 
+// offTokenToTokenOutput prices buying tokensBought of boughtPool with the token of soldPool at the refreshed reserves,
+// the ontd boughtPool asks for is priced first, it returns the tokens sold in soldPool and that ontd
+func (this *TestEnv) offTokenToTokenOutput(soldPool, boughtPool int, tokensBought *big.Int) (*big.Int, *big.Int, error) {
+	if err := this.refreshPools(soldPool, boughtPool); err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenOutput, refreshBalance err: %w", err)
+	}
+	sold, bought := this.OnChainEState[soldPool], this.OnChainEState[boughtPool]
+	ontdSold, err := getOutputPrice(tokensBought, bought.OntdLiquid, bought.TokenLiquid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenOutput, pool %d: %w", boughtPool, err)
+	}
+	tokensSold, err := getOutputPrice(ontdSold, sold.TokenLiquid, sold.OntdLiquid)
+	if err != nil {
+		return nil, nil, fmt.Errorf("offTokenToTokenOutput, pool %d: %w", soldPool, err)
+	}
+	log.Debugf("offTokenToTokenOutput, tokensBought: %s, ontdSold: %s, tokensSold: %s", tokensBought, ontdSold, tokensSold)
+	return tokensSold, ontdSold, nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func simAddr(b byte) common.Address {
+	return common.Address{b}
+}
+
+// newTestSimulator builds two funded exchanges with the first liquidity of provider already added
+func newTestSimulator(t *testing.T) (*OffChainSimulator, common.Address, common.Address, common.Address) {
+	sim := NewOffChainSimulator(simAddr(0xf0), simAddr(0xf1))
+	sim.Now = func() int64 { return 1000 }
+	provider, exchange1, exchange2 := simAddr(1), simAddr(0xe1), simAddr(0xe2)
+	for i, exchangeAddr := range []common.Address{exchange1, exchange2} {
+		tokenAddr := simAddr(byte(0xa1 + i))
+		sim.AddExchange(exchangeAddr, tokenAddr)
+		sim.Tokens[tokenAddr].Mint(provider, big.NewInt(1e12))
+		sim.Tokens[tokenAddr].Approve(provider, exchangeAddr, big.NewInt(1e12))
+		sim.Tokens[tokenAddr].Mint(simAddr(2), big.NewInt(1e12))
+		sim.Tokens[tokenAddr].Approve(simAddr(2), exchangeAddr, big.NewInt(1e12))
+	}
+	sim.Ontd.Mint(provider, big.NewInt(1e13))
+	sim.Ontd.Mint(simAddr(2), big.NewInt(1e13))
+	for _, exchangeAddr := range []common.Address{exchange1, exchange2} {
+		sim.Ontd.Approve(provider, exchangeAddr, big.NewInt(1e13))
+		sim.Ontd.Approve(simAddr(2), exchangeAddr, big.NewInt(1e13))
+		if _, err := sim.AddLiquidity(exchangeAddr, big.NewInt(0), big.NewInt(4e9), 1001, provider, big.NewInt(2e9)); err != nil {
+			t.Fatalf("AddLiquidity error: %v", err)
+		}
+	}
+	return sim, provider, exchange1, exchange2
+}
+
+func Test_SimulatorLiquidity(t *testing.T) {
+	sim, provider, exchange1, _ := newTestSimulator(t)
+	if _, err := sim.AddLiquidity(exchange1, big.NewInt(1), big.NewInt(4e9), 1000, provider, big.NewInt(1e9)); err != ErrDeadlineExpired {
+		t.Fatalf("expect ErrDeadlineExpired, got %v", err)
+	}
+	minted, err := sim.AddLiquidity(exchange1, big.NewInt(1), big.NewInt(4e9), 1001, provider, big.NewInt(1e9))
+	if err != nil {
+		t.Fatalf("AddLiquidity error: %v", err)
+	}
+	ontdReserve, tokenReserve, _ := sim.Reserves(exchange1)
+	// 1e9 * 4e9 / 2e9 + 1 tokens are pulled for 1e9 shares
+	if minted.Cmp(big.NewInt(1e9)) != 0 || ontdReserve.Cmp(big.NewInt(3e9)) != 0 || tokenReserve.Cmp(big.NewInt(6e9+1)) != 0 {
+		t.Fatalf("unexpected minted: %s, ontd reserve: %s, token reserve: %s", minted, ontdReserve, tokenReserve)
+	}
+	if _, err := sim.AddLiquidity(exchange1, big.NewInt(1), big.NewInt(2e9), 1001, provider, big.NewInt(1e9)); err != ErrMaxTokensExceeded {
+		t.Fatalf("expect ErrMaxTokensExceeded, got %v", err)
+	}
+
+	ontdAmt, tokenAmt, err := sim.RemoveLiquidity(exchange1, big.NewInt(1e9), big.NewInt(1), big.NewInt(1), 1001, provider)
+	if err != nil {
+		t.Fatalf("RemoveLiquidity error: %v", err)
+	}
+	if ontdAmt.Cmp(big.NewInt(1e9)) != 0 || tokenAmt.Cmp(big.NewInt(2e9)) != 0 {
+		t.Fatalf("unexpected ontd: %s, tokens: %s", ontdAmt, tokenAmt)
+	}
+	if sim.Exchanges[exchange1].ShareSupply.Cmp(big.NewInt(2e9)) != 0 {
+		t.Fatalf("unexpected share supply: %s", sim.Exchanges[exchange1].ShareSupply)
+	}
+	if _, _, err := sim.RemoveLiquidity(exchange1, big.NewInt(1e9), big.NewInt(1), big.NewInt(1), 1001, simAddr(2)); err != ErrInsufficientShare {
+		t.Fatalf("expect ErrInsufficientShare, got %v", err)
+	}
+}
+
+func Test_SimulatorInitialLiquidity(t *testing.T) {
+	sim := NewOffChainSimulator(simAddr(0xf0), simAddr(0xf1))
+	sim.AddExchange(simAddr(0xe1), simAddr(0xa1))
+	sim.Ontd.Mint(simAddr(1), big.NewInt(1e10))
+	sim.Ontd.Approve(simAddr(1), simAddr(0xe1), big.NewInt(1e10))
+	deadline := time.Now().Unix() + 60
+	if _, err := sim.AddLiquidity(simAddr(0xe1), big.NewInt(0), big.NewInt(1), deadline, simAddr(1), big.NewInt(MIN_INITIAL_ONTD-1)); err != ErrInitialOntdTooLow {
+		t.Fatalf("expect ErrInitialOntdTooLow, got %v", err)
+	}
+	// no token allowance, nothing may be left behind by the failed deposit
+	if _, err := sim.AddLiquidity(simAddr(0xe1), big.NewInt(0), big.NewInt(1), deadline, simAddr(1), big.NewInt(MIN_INITIAL_ONTD)); err != ErrInsufficientAllowance {
+		t.Fatalf("expect ErrInsufficientAllowance, got %v", err)
+	}
+	if sim.Exchanges[simAddr(0xe1)].ShareSupply.Sign() != 0 || sim.Ontd.BalanceOf(simAddr(1)).Cmp(big.NewInt(1e10)) != 0 {
+		t.Fatalf("failed deposit changed the state")
+	}
+}
+
+func Test_SimulatorOntToToken(t *testing.T) {
+	sim, _, exchange1, _ := newTestSimulator(t)
+	buyer, recipient := simAddr(2), simAddr(3)
+	expected := inputPrice(big.NewInt(1e6), big.NewInt(2e9), big.NewInt(4e9))
+	bought, err := sim.OntToTokenInput(exchange1, big.NewInt(1e6), big.NewInt(1), 1000, buyer, recipient)
+	if err != nil {
+		t.Fatalf("OntToTokenInput error: %v", err)
+	}
+	if bought.Cmp(expected) != 0 || sim.Tokens[simAddr(0xa1)].BalanceOf(recipient).Cmp(expected) != 0 {
+		t.Fatalf("expect %s tokens, got %s", expected, bought)
+	}
+	if _, err := sim.OntToTokenInput(exchange1, big.NewInt(1e6), big.NewInt(1e9), 1000, buyer, buyer); err != ErrMinTokensNotReached {
+		t.Fatalf("expect ErrMinTokensNotReached, got %v", err)
+	}
+	if _, err := sim.OntToTokenInput(exchange1, big.NewInt(1e6), big.NewInt(1), 999, buyer, buyer); err != ErrDeadlineExpired {
+		t.Fatalf("expect ErrDeadlineExpired, got %v", err)
+	}
+
+	ontdReserve, tokenReserve, _ := sim.Reserves(exchange1)
+	expected = outputPrice(big.NewInt(1e6), ontdReserve, tokenReserve)
+	sold, err := sim.OntToTokenOutput(exchange1, big.NewInt(1e6), big.NewInt(1e7), 1000, buyer, buyer)
+	if err != nil {
+		t.Fatalf("OntToTokenOutput error: %v", err)
+	}
+	if sold.Cmp(expected) != 0 {
+		t.Fatalf("expect %s ontd sold, got %s", expected, sold)
+	}
+	if _, err := sim.OntToTokenOutput(exchange1, big.NewInt(1e6), big.NewInt(1), 1000, buyer, buyer); err != ErrMaxOntdExceeded {
+		t.Fatalf("expect ErrMaxOntdExceeded, got %v", err)
+	}
+}
+
+func Test_SimulatorTokenToOnt(t *testing.T) {
+	sim, _, exchange1, _ := newTestSimulator(t)
+	seller := simAddr(2)
+	before := sim.Ontd.BalanceOf(seller)
+	expected := inputPrice(big.NewInt(1e6), big.NewInt(4e9), big.NewInt(2e9))
+	bought, err := sim.TokenToOntInput(exchange1, big.NewInt(1e6), big.NewInt(1), 1000, seller, seller)
+	if err != nil {
+		t.Fatalf("TokenToOntInput error: %v", err)
+	}
+	if bought.Cmp(expected) != 0 || new(big.Int).Sub(sim.Ontd.BalanceOf(seller), before).Cmp(expected) != 0 {
+		t.Fatalf("expect %s ontd, got %s", expected, bought)
+	}
+	if _, err := sim.TokenToOntOutput(exchange1, big.NewInt(1e6), big.NewInt(1), 1000, seller, seller); err != ErrMaxTokensExceeded {
+		t.Fatalf("expect ErrMaxTokensExceeded, got %v", err)
+	}
+	if _, err := sim.TokenToOntOutput(exchange1, big.NewInt(1e6), big.NewInt(1e7), 1000, seller, seller); err != nil {
+		t.Fatalf("TokenToOntOutput error: %v", err)
+	}
+}
+
+func Test_SimulatorTokenToToken(t *testing.T) {
+	sim, _, exchange1, exchange2 := newTestSimulator(t)
+	trader := simAddr(2)
+	ontdBought := inputPrice(big.NewInt(1e6), big.NewInt(4e9), big.NewInt(2e9))
+	expected := inputPrice(ontdBought, big.NewInt(2e9), big.NewInt(4e9))
+	bought, err := sim.TokenToTokenInput(exchange1, big.NewInt(1e6), big.NewInt(1), big.NewInt(1), 1000, trader, trader, simAddr(0xa2))
+	if err != nil {
+		t.Fatalf("TokenToTokenInput error: %v", err)
+	}
+	if bought.Cmp(expected) != 0 {
+		t.Fatalf("expect %s tokens, got %s", expected, bought)
+	}
+	ontdReserve2, _, _ := sim.Reserves(exchange2)
+	if ontdReserve2.Cmp(new(big.Int).Add(big.NewInt(2e9), ontdBought)) != 0 {
+		t.Fatalf("unexpected ontd reserve of exchange2: %s", ontdReserve2)
+	}
+	if _, err := sim.TokenToExchangeInput(exchange1, big.NewInt(1e6), big.NewInt(1), big.NewInt(1), 1000, trader, trader, exchange1); err != ErrInvalidTargetExchange {
+		t.Fatalf("expect ErrInvalidTargetExchange, got %v", err)
+	}
+
+	ontdReserve1, tokenReserve1, _ := sim.Reserves(exchange1)
+	ontdReserve2, tokenReserve2, _ := sim.Reserves(exchange2)
+	ontdSold := outputPrice(big.NewInt(1e6), ontdReserve2, tokenReserve2)
+	expected = outputPrice(ontdSold, tokenReserve1, ontdReserve1)
+	sold, err := sim.TokenToExchangeOutput(exchange1, big.NewInt(1e6), big.NewInt(1e7), big.NewInt(1e7), 1000, trader, simAddr(3), exchange2)
+	if err != nil {
+		t.Fatalf("TokenToExchangeOutput error: %v", err)
+	}
+	if sold.Cmp(expected) != 0 || sim.Tokens[simAddr(0xa2)].BalanceOf(simAddr(3)).Cmp(big.NewInt(1e6)) != 0 {
+		t.Fatalf("expect %s tokens sold, got %s", expected, sold)
+	}
+	if _, err := sim.TokenToTokenOutput(exchange1, big.NewInt(1e6), big.NewInt(1e7), big.NewInt(1), 1000, trader, trader, simAddr(0xa2)); err != ErrMaxOntdExceeded {
+		t.Fatalf("expect ErrMaxOntdExceeded, got %v", err)
+	}
+}
+
+// the vectors below are worked out by hand from the contract's formulas with the 0.25% fee,
+// they pin the pricing and share math without comparing the simulator against itself
+func Test_PriceVectors(t *testing.T) {
+	vectors := []struct {
+		amount, inputReserve, outputReserve int64
+		bought, sold                        int64
+	}{
+		{100, 1000, 1000, 90, 112},
+		{1000000, 1000000000, 2000000000, 1993011, 501504},
+		{500000000, 1000000000, 2000000000, 665554628, 334168756},
+		{123456789, 3000000011, 1000000007, 39430773, 423594191},
+	}
+	for i, v := range vectors {
+		bought, err := getInputPrice(big.NewInt(v.amount), big.NewInt(v.inputReserve), big.NewInt(v.outputReserve))
+		if err != nil || bought.Cmp(big.NewInt(v.bought)) != 0 {
+			t.Fatalf("vector %d: getInputPrice expect %d, got %v, err: %v", i, v.bought, bought, err)
+		}
+		sold, err := getOutputPrice(big.NewInt(v.amount), big.NewInt(v.inputReserve), big.NewInt(v.outputReserve))
+		if err != nil || sold.Cmp(big.NewInt(v.sold)) != 0 {
+			t.Fatalf("vector %d: getOutputPrice expect %d, got %v, err: %v", i, v.sold, sold, err)
+		}
+	}
+	if _, err := getInputPrice(big.NewInt(1), big.NewInt(0), big.NewInt(1000)); err != ErrEmptyReserve {
+		t.Fatalf("expect ErrEmptyReserve, got %v", err)
+	}
+	if _, err := getOutputPrice(big.NewInt(1000), big.NewInt(1000), big.NewInt(1000)); err != ErrEmptyReserve {
+		t.Fatalf("expect ErrEmptyReserve, got %v", err)
+	}
+}
+
+func Test_LiquidityVectors(t *testing.T) {
+	sim := NewOffChainSimulator(simAddr(0xf0), simAddr(0xf1))
+	sim.Now = func() int64 { return 1000 }
+	provider, exchangeAddr, tokenAddr := simAddr(1), simAddr(0xe1), simAddr(0xa1)
+	sim.AddExchange(exchangeAddr, tokenAddr)
+	sim.Tokens[tokenAddr].Mint(provider, big.NewInt(1e12))
+	sim.Tokens[tokenAddr].Approve(provider, exchangeAddr, big.NewInt(1e12))
+	sim.Ontd.Mint(provider, big.NewInt(1e13))
+	sim.Ontd.Approve(provider, exchangeAddr, big.NewInt(1e13))
+
+	minted, err := sim.AddLiquidity(exchangeAddr, big.NewInt(0), big.NewInt(3000000011), 1001, provider, big.NewInt(1000000007))
+	if err != nil || minted.Cmp(big.NewInt(1000000007)) != 0 {
+		t.Fatalf("first deposit expect 1000000007 shares, got %v, err: %v", minted, err)
+	}
+	// a donation moves the reserves away from the share supply: 1500000010 ontd, 3000000024 tokens, 1000000007 shares
+	sim.Ontd.Mint(exchangeAddr, big.NewInt(500000003))
+	sim.Tokens[tokenAddr].Mint(exchangeAddr, big.NewInt(13))
+
+	// tokens: 123456789 * 3000000024 / 1500000010 + 1, shares: 123456789 * 1000000007 / 1500000010
+	minted, err = sim.AddLiquidity(exchangeAddr, big.NewInt(1), big.NewInt(1e12), 1001, provider, big.NewInt(123456789))
+	if err != nil || minted.Cmp(big.NewInt(82304526)) != 0 {
+		t.Fatalf("deposit expect 82304526 shares, got %v, err: %v", minted, err)
+	}
+	ontdReserve, tokenReserve, _ := sim.Reserves(exchangeAddr)
+	if ontdReserve.Cmp(big.NewInt(1623456799)) != 0 || tokenReserve.Cmp(big.NewInt(3246913603)) != 0 {
+		t.Fatalf("expect reserves 1623456799/3246913603, got %s/%s", ontdReserve, tokenReserve)
+	}
+	if sim.Exchanges[exchangeAddr].ShareSupply.Cmp(big.NewInt(1082304533)) != 0 {
+		t.Fatalf("expect share supply 1082304533, got %s", sim.Exchanges[exchangeAddr].ShareSupply)
+	}
+
+	// ontd: 400000000 * 1623456799 / 1082304533, tokens: 400000000 * 3246913603 / 1082304533
+	ontdAmt, tokenAmt, err := sim.RemoveLiquidity(exchangeAddr, big.NewInt(400000000), big.NewInt(1), big.NewInt(1), 1001, provider)
+	if err != nil {
+		t.Fatalf("RemoveLiquidity error: %v", err)
+	}
+	if ontdAmt.Cmp(big.NewInt(599999999)) != 0 || tokenAmt.Cmp(big.NewInt(1200000001)) != 0 {
+		t.Fatalf("expect 599999999 ontd and 1200000001 tokens, got %s and %s", ontdAmt, tokenAmt)
+	}
+}
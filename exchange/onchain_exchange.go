@@ -5,7 +5,6 @@ import (
 	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
 	"github.com/ontio/ontology/common"
 	"github.com/skyinglyh1/uniswap_v1_test/log"
-	"github.com/skyinglyh1/uniswap_v1_test/utils"
 	"math/big"
 	"time"
 )
@@ -30,153 +29,298 @@ type ProviderBalanceMap struct {
 
 
 
-func (this *TestEnv) addLiquid(exchangeIndex int, minLiquidity, maxTokens *big.Int, ontdAmt *big.Int) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("addLiquid, refreshBalance err: %v", err)
+// checkPool returns an error unless pool indexes one of the configured token/exchange pairs
+func (this *TestEnv) checkPool(pool int) error {
+	if pool < 0 || pool >= len(this.OnChainEState) {
+		return fmt.Errorf("pool index %d out of range [0, %d)", pool, len(this.OnChainEState))
+	}
+	return nil
+}
+
+// poolIndex returns the index of the pair whose token or exchange is addr
+func (this *TestEnv) poolIndex(addr common.Address) (int, error) {
+	for i := range this.OnChainEState {
+		if this.OnChainEState[i].ExchangeAddr == addr || this.OnChainTState[i].TokenAddr == addr {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%s is neither a configured token nor exchange", addr.ToHexString())
+}
+
+// ensureOntdAllowance approves amount of ontd from invoker to the exchange of pool if the allowance is not enough
+func (this *TestEnv) ensureOntdAllowance(pool int, invoker *ontology_go_sdk.Account, amount *big.Int) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("ensureOntdAllowance, %w", err)
+	}
+	exchangeAddr := this.OnChainEState[pool].ExchangeAddr
+	if bigOrZero(this.OntdAllowance[invoker.Address][exchangeAddr]).Cmp(amount) >= 0 {
+		return nil
+	}
+	return this.approve(this.OntdAddr, invoker, exchangeAddr, amount)
+}
+
+// ensureTokenAllowance approves amount of the token of pool from invoker to its exchange if the allowance is not enough
+func (this *TestEnv) ensureTokenAllowance(pool int, invoker *ontology_go_sdk.Account, amount *big.Int) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("ensureTokenAllowance, %w", err)
+	}
+	if bigOrZero(this.OnChainTState[pool].Allowances[invoker.Address]).Cmp(amount) >= 0 {
+		return nil
+	}
+	return this.approve(this.OnChainTState[pool].TokenAddr, invoker, this.OnChainEState[pool].ExchangeAddr, amount)
+}
+
+// confirmed accounts for the result of a transaction sent by operation whether it executed or not: it is printed,
+// its gas is charged to payer and the share holders in its events are tracked
+func (this *TestEnv) confirmed(check *swapCheck, operation string, payer common.Address, result *TxResult) error {
+	printTxResult(result)
+	this.chargeGas(check, operation, payer, result)
+	if err := this.discoverShareHolders(result); err != nil {
+		return fmt.Errorf("%s, %w", operation, err)
+	}
+	return nil
+}
+
+func (this *TestEnv) approve(tokenAddr common.Address, owner *ontology_go_sdk.Account, spender common.Address, amount *big.Int) error {
+	log.Debugf("approve, owner: %s, token: %s, spender: %s, amount: %s", owner.Address.ToBase58(), tokenAddr.ToHexString(), spender.ToHexString(), amount.String())
+	approveTxHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, owner, owner, tokenAddr, []interface{}{"approve", []interface{}{
+		owner.Address, spender, amount,
+	}})
+	if err != nil {
+		return fmt.Errorf("owner: %s, approve token: %s to exchange err: %v", owner.Address.ToBase58(), tokenAddr.ToHexString(), err)
+	}
+	result, err := this.Waiter.Wait(approveTxHash)
+	if err != nil {
+		return fmt.Errorf("approve, %w", err)
+	}
+	if err := this.confirmed(nil, "approve", owner.Address, result); err != nil {
+		return err
+	}
+	// a failed approve leaves the allowance as it was
+	if result.Status == TX_SUCCEEDED {
+		this.mirrorApprove(tokenAddr, owner.Address, spender, amount)
+	}
+	// the swaps read the allowances they consume from the refreshed state
+	refresh := this.refreshAcctBalance
+	if pool, err := this.poolIndex(spender); err == nil {
+		refresh = func() error { return this.refreshPools(pool) }
 	}
+	if err := refresh(); err != nil {
+		return fmt.Errorf("approve, refreshBalance err: %w", err)
+	}
+	return executionError(result, tokenAddr, "approve")
+}
 
-	exOntdBalance1 := this.OnChainEState[exchangeIndex].OntdLiquid
-	exTokenBalance1 := this.OnChainEState[exchangeIndex].TokenLiquid
+func (this *TestEnv) addLiquid(exchangeIndex int, minLiquidity, maxTokens *big.Int, ontdAmt *big.Int) error {
+	if err := this.checkPool(exchangeIndex); err != nil {
+		return fmt.Errorf("addLiquid, %w", err)
+	}
+	if err := this.refreshPools(exchangeIndex); err != nil {
+		return fmt.Errorf("addLiquid, refreshBalance err: %w", err)
+	}
 
 	for _, provider := range this.OnChainEState[exchangeIndex].Providers {
-		if this.OnChainTState[0].Balances[provider.Address].Cmp(maxTokens) < 0 {
+		if this.OnChainTState[exchangeIndex].Balances[provider.Address].Cmp(maxTokens) < 0 {
 			return fmt.Errorf("provider: %s does not have enough token: %v", provider.Address.ToBase58(), maxTokens)
 		}
-		if this.OnChainTState[0].Allowances[provider.Address].Cmp(maxTokens) < 0 {
-			// approve token to exchange
-			approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, provider, provider, this.OnChainEState[exchangeIndex].TokenAddr, []interface{}{"approve", []interface{}{
-				provider.Address, this.OnChainEState[exchangeIndex].ExchangeAddr, maxTokens,
-			}})
-			if err != nil {
-				return fmt.Errorf("Provider: %s, approve token to exchange err: %v", provider.Address.ToBase58(), err)
-			}
-			if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-				return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-			}
-			utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
-
+		if err := this.ensureTokenAllowance(exchangeIndex, provider, maxTokens); err != nil {
+			return fmt.Errorf("addLiquid, %w", err)
 		}
 		if this.OntdBalance[provider.Address].Cmp(ontdAmt) < 0 {
 			return fmt.Errorf("provider: %s does not have enough ontd: %v", provider.Address.ToBase58(), ontdAmt)
 		}
+		if err := this.ensureOntdAllowance(exchangeIndex, provider, ontdAmt); err != nil {
+			return fmt.Errorf("addLiquid, %w", err)
+		}
+
+		// every deposit moves the reserves the next one is priced on, so each is checked on its own
+		check := newSwapCheck("addLiquidity")
+		before := this.Snapshot()
+		exState := this.OnChainEState[exchangeIndex]
+		minted, tokenAmt := liquidityMinted(ontdAmt, maxTokens, exState.OntdLiquid, exState.TokenLiquid, exState.ShareSupply)
+		this.expectAddLiquidity(check, exchangeIndex, provider.Address, ontdAmt, tokenAmt, minted)
 
+		deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 		// addLiquidity
-		txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, provider, provider, this.OnChainEState[exchangeIndex].ExchangeAddr, []interface{}{"addLiquidity", []interface{}{
-			minLiquidity,
-				//TODO: check
-				maxTokens,
-				time.Now().Add(this.WaitTxTimeOut).Unix(), provider.Address, ontdAmt,
+		txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, provider, provider, exState.ExchangeAddr, []interface{}{"addLiquidity", []interface{}{
+			minLiquidity, maxTokens, deadline, provider.Address, ontdAmt,
 		}})
 		if err != nil {
 			return fmt.Errorf("Provider: %s, addLiquid err: %v", provider.Address.ToBase58(), err)
 		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
+		result, err := this.Waiter.Wait(txHash)
+		if err != nil {
+			return fmt.Errorf("addLiquid, %w", err)
 		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-	}
-
-
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("addLiquid, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[exchangeIndex].OntdLiquid
-	exTokenBalance2 := this.OnChainEState[exchangeIndex].TokenLiquid
+		if err := this.confirmed(check, "addLiquid", provider.Address, result); err != nil {
+			return err
+		}
+		mirror := func() error {
+			_, err := this.Simulator.AddLiquidity(exState.ExchangeAddr, minLiquidity, maxTokens, deadline, provider.Address, ontdAmt)
+			return err
+		}
+		if result.Status == TX_FAILED {
+			return this.reverted("addLiquid", result, exState.ExchangeAddr, "addLiquidity", mirror, exchangeIndex)
+		}
+		simErr := mirror()
+		mirrorResult("addLiquid", simErr)
 
-	if big.NewInt(0).Sub( exOngBalance2, exOntdBalance1).Cmp(ontdAmt) < 0{
-		// TODO: if we don't count the tx fee, they will not equal
-		return fmt.Errorf("exchange ong balance increse incorrect")
+		if err := this.refreshPools(exchangeIndex); err != nil {
+			return fmt.Errorf("addLiquid, refreshBalance err: %w", err)
+		}
+		if err := this.checkStates(); err != nil {
+			return fmt.Errorf("addLiquid, %w", err)
+		}
+		if err := check.verify(simErr == nil); err != nil {
+			return err
+		}
+		if err := this.checkInvariants(before, result.TxHash, "addLiquidity", false, exchangeIndex); err != nil {
+			return err
+		}
+		log.Debugf("addLiquid, provider: %s, minted: %v, token deposited: %v, executed: %v", provider.Address.ToBase58(), minted, tokenAmt, simErr == nil)
 	}
-	//if big.NewInt(0).Sub(exTokenBalance2, exTokenBalance1).Cmp(maxTokens) != 1 {
-	//	return fmt.Errorf("exchange token balance increse incorrect")
-	//}
-	log.Debugf("exchange token increased by : %v\n", big.NewInt(0).Sub(exTokenBalance2, exTokenBalance1))
-
-	// TODO: update off chain state
-	// TODO: Check onchain states equals offchain states
-
 	return nil
 }
 
 
-func (this *TestEnv) removeLiquid(exchangeIndex int, amount, min_ong *big.Int, withdrawer *ontology_go_sdk.Account) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("removeLiquid, refreshBalance err: %v", err)
+func (this *TestEnv) removeLiquid(exchangeIndex int, amount, minOntd, minTokens *big.Int, withdrawer *ontology_go_sdk.Account) error {
+	if err := this.checkPool(exchangeIndex); err != nil {
+		return fmt.Errorf("removeLiquid, %w", err)
+	}
+	if err := this.refreshPools(exchangeIndex); err != nil {
+		return fmt.Errorf("removeLiquid, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[exchangeIndex].OntdLiquid
-	shareB1 := this.OnChainEState[exchangeIndex].ShareBalance[withdrawer.Address]
 
 	// Condition check
-	if this.OnChainEState[exchangeIndex].ShareBalance[withdrawer.Address].Cmp(amount) < 0 {
+	exState := this.OnChainEState[exchangeIndex]
+	if bigOrZero(exState.ShareBalance[withdrawer.Address]).Cmp(amount) < 0 {
 		return fmt.Errorf("removeLiquid, withdrawer: %s, not have enough share balance", withdrawer.Address.ToBase58())
 	}
 
+	check := newSwapCheck("removeLiquidity")
+	before := this.Snapshot()
+	ontdAmt, tokenAmt := liquidityRedeemed(amount, exState.OntdLiquid, exState.TokenLiquid, exState.ShareSupply)
+	this.expectRemoveLiquidity(check, exchangeIndex, withdrawer.Address, amount, ontdAmt, tokenAmt)
+
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	// removeLiquidity
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, withdrawer, withdrawer, this.OnChainEState[exchangeIndex].ExchangeAddr, []interface{}{"removeLiquidity", []interface{}{
+	txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, withdrawer, withdrawer, exState.ExchangeAddr, []interface{}{"removeLiquidity", []interface{}{
 		amount,
-		1,
-		1,
-		time.Now().Add(this.WaitTxTimeOut).Unix(),
+		minOntd,
+		minTokens,
+		deadline,
 		withdrawer.Address,
 	}})
 	if err != nil {
 		return fmt.Errorf("removeLiquid, withdrawer: %s withdraw err: %v", withdrawer.Address.ToBase58(), err)
 	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("removeLiquid, Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
+	result, err := this.Waiter.Wait(txHash)
+	if err != nil {
+		return fmt.Errorf("removeLiquid, %w", err)
+	}
+	if err := this.confirmed(check, "removeLiquid", withdrawer.Address, result); err != nil {
+		return err
 	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
+	mirror := func() error {
+		_, _, err := this.Simulator.RemoveLiquidity(exState.ExchangeAddr, amount, minOntd, minTokens, deadline, withdrawer.Address)
+		return err
+	}
+	if result.Status == TX_FAILED {
+		return this.reverted("removeLiquid", result, exState.ExchangeAddr, "removeLiquidity", mirror, exchangeIndex)
+	}
+	simErr := mirror()
+	mirrorResult("removeLiquid", simErr)
 
+	if err := this.refreshPools(exchangeIndex); err != nil {
+		return fmt.Errorf("removeLiquid, refreshBalance err: %w", err)
+	}
+	if err := this.checkStates(); err != nil {
+		return fmt.Errorf("removeLiquid, %w", err)
+	}
+	if err := check.verify(simErr == nil); err != nil {
+		return err
+	}
+	if err := this.checkInvariants(before, result.TxHash, "removeLiquidity", false, exchangeIndex); err != nil {
+		return err
+	}
+	log.Debugf("removeLiquid, withdrawer: %s, ontd returned: %v, token returned: %v, executed: %v", withdrawer.Address.ToBase58(), ontdAmt, tokenAmt, simErr == nil)
+	return nil
+}
 
 
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("removeLiquid, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[exchangeIndex].OntdLiquid
-	shareB2 := this.OnChainEState[exchangeIndex].ShareBalance[withdrawer.Address]
 
-	//if exOngBalance2 - exOngBalance1 != min_ong {
-	//	return fmt.Errorf("exchange ong balance decrease incorrect")
-	//}
-	log.Debugf("removeLiquid, exchange ong decreased by : %d\n", exOngBalance1.Uint64() - exOngBalance2.Uint64())
-	// TODO: token means share balance
-	if big.NewInt(0).Sub(shareB1, shareB2).Cmp(amount) != 0 {
-		return fmt.Errorf("removeLiquid, withdrawer share balance decrease incorrect")
+// reverted resyncs the env with a transaction that failed on chain and returns its *ExecutionFailedError. The mirror
+// only gives its verdict on the simulator, whatever it changed is rolled back as the chain kept nothing but the gas
+func (this *TestEnv) reverted(operation string, result *TxResult, contract common.Address, method string, mirror func() error, pools ...int) error {
+	saved := this.Simulator.Clone()
+	if simErr := mirror(); simErr != nil {
+		mirrorResult(operation, simErr)
+	} else {
+		log.Warnf("%s, offchain executed a transaction failed on chain", operation)
 	}
-
-	return nil
+	*this.Simulator = *saved
+	if err := this.refreshPools(pools...); err != nil {
+		return fmt.Errorf("%s, refreshBalance err: %w", operation, err)
+	}
+	return executionError(result, contract, method)
 }
 
+// runSwap sends the swap params of invoker to the exchange of pool for operation, the helper its gas is accounted to,
+// mirrors it off chain with mirror, then checks the changes expected in check and the invariants of pool and of the
+// other pools the swap touches. The exact changes follow from the pre-trade reserves, when the pricing rejects the
+// swap so does the simulator. A swap failed on chain skips the checks and returns its *ExecutionFailedError.
+func (this *TestEnv) runSwap(operation string, check *swapCheck, invoker *ontology_go_sdk.Account, params []interface{}, mirror func() error, pool int, others ...int) error {
+	method, exchangeAddr := params[0].(string), this.OnChainEState[pool].ExchangeAddr
+	pools := append([]int{pool}, others...)
+	before := this.Snapshot()
+	txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, exchangeAddr, params)
+	if err != nil {
+		return fmt.Errorf("%s, invoker: %s invoke err: %v", operation, invoker.Address.ToBase58(), err)
+	}
+	result, err := this.Waiter.Wait(txHash)
+	if err != nil {
+		return fmt.Errorf("%s, %v", operation, err)
+	}
+	if err := this.confirmed(check, operation, invoker.Address, result); err != nil {
+		return err
+	}
+	if result.Status == TX_FAILED {
+		return this.reverted(operation, result, exchangeAddr, method, mirror, pools...)
+	}
+	simErr := mirror()
+	mirrorResult(operation, simErr)
 
+	if err := this.refreshPools(pools...); err != nil {
+		return fmt.Errorf("%s, refreshBalance err: %v", operation, err)
+	}
+	if err := this.checkStates(); err != nil {
+		return fmt.Errorf("%s, %v", operation, err)
+	}
+	// a *SwapMismatchError, returned as is so that callers can inspect it
+	if err := check.verify(simErr == nil); err != nil {
+		return err
+	}
+	return this.checkInvariants(before, result.TxHash, method, true, pools...)
+}
 
-func (this *TestEnv) ontToTokenInput(ontdAmt, minTokens *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("ontToTokenInput, refreshBalance err: %v", err)
+func (this *TestEnv) ontToTokenInput(pool int, ontdAmt, minTokens *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("ontToTokenInput, %w", err)
+	}
+	if err := this.refreshPools(pool); err != nil {
+		return fmt.Errorf("ontToTokenInput, refreshBalance err: %w", err)
 	}
 
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	recBal1 := this.OnChainTState[0].Balances[recipient]
 	// Condition check
 	if this.OntdBalance[invoker.Address].Cmp(ontdAmt) < 0 {
 		return fmt.Errorf("ontToTokenInput, invoker: %s, not have enough ontd balance", invoker.Address.ToBase58())
 	}
 
-	if this.OntdAllowance[invoker.Address][this.OnChainEState[0].ExchangeAddr].Cmp(ontdAmt) < 0 {
-		// approve ontd  to exchange
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OntdAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, ontdAmt,
-		}})
-		if err != nil {
-			return fmt.Errorf("ontToTokenInput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
-
+	if err := this.ensureOntdAllowance(pool, invoker, ontdAmt); err != nil {
+		return fmt.Errorf("ontToTokenInput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// ongToTokenSwap
 	if invoker.Address == recipient {
@@ -184,7 +328,7 @@ func (this *TestEnv) ontToTokenInput(ontdAmt, minTokens *big.Int, invoker *ontol
 			"ontToTokenSwapInput",
 			[]interface{}{
 				minTokens,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				invoker.Address,
 				ontdAmt,
 			},
@@ -194,77 +338,41 @@ func (this *TestEnv) ontToTokenInput(ontdAmt, minTokens *big.Int, invoker *ontol
 			"ontToTokenTransferInput",
 			[]interface{}{
 				minTokens,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				invoker.Address,
 				ontdAmt,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("ontToTokenInput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
-
-
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("ontToTokenInput, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-
-	ongDecrement := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	if ongDecrement.Cmp(ontdAmt) < 0 {
-		return fmt.Errorf("exchange ong balance decrease incorrect")
-	}
-	log.Debugf("exchange ong increased by : %d\n", ongDecrement)
-
-	if invoker.Address == recipient {
-
-	} else {
-		recBal2 := this.OnChainTState[0].Balances[recipient]
-		increment := big.NewInt(0).Sub(recBal2, recBal1)
-		if increment.Cmp(big.NewInt(0)) > 1 {
-			log.Debugf("recipient: %s received %+v tokens\n", recipient.ToBase58(), increment)
-		}
-	}
-
-	return nil
+	check := newSwapCheck(params[0].(string))
+	tokensBought, _ := getInputPrice(ontdAmt, this.OnChainEState[pool].OntdLiquid, this.OnChainEState[pool].TokenLiquid)
+	this.expectOntToToken(check, pool, invoker.Address, recipient, ontdAmt, tokensBought)
+	return this.runSwap("ontToTokenInput", check, invoker, params, func() error {
+		_, err := this.Simulator.OntToTokenInput(this.OnChainEState[pool].ExchangeAddr, ontdAmt, minTokens, deadline, invoker.Address, recipient)
+		return err
+	}, pool)
 }
 
 
 
-func (this *TestEnv) ontToTokenOutput(tokenBought *big.Int, maxOntd *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("ongToTokenSwapInput, refreshBalance err: %v", err)
+func (this *TestEnv) ontToTokenOutput(pool int, tokenBought *big.Int, maxOntd *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("ontToTokenOutput, %w", err)
+	}
+	if err := this.refreshPools(pool); err != nil {
+		return fmt.Errorf("ontToTokenOutput, refreshBalance err: %w", err)
 	}
 
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recBal1 := this.OnChainTState[0].Balances[recipient]
 	// Condition check
 	if this.OntdBalance[invoker.Address].Cmp(maxOntd) < 0 {
-		return fmt.Errorf("ongToTokenOutput, invoker: %s, not have enough ong balance", invoker.Address.ToBase58())
+		return fmt.Errorf("ontToTokenOutput, invoker: %s, not have enough ong balance", invoker.Address.ToBase58())
 	}
 
-	if this.OntdAllowance[invoker.Address][this.OnChainEState[0].ExchangeAddr].Cmp(maxOntd) < 0 {
-		// approve ontd  to exchange
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OntdAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, maxOntd,
-		}})
-		if err != nil {
-			return fmt.Errorf("ontToTokenInput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
-
+	if err := this.ensureOntdAllowance(pool, invoker, maxOntd); err != nil {
+		return fmt.Errorf("ontToTokenOutput, %w", err)
 	}
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// ongToTokenSwap
 	if invoker.Address == recipient {
@@ -272,7 +380,7 @@ func (this *TestEnv) ontToTokenOutput(tokenBought *big.Int, maxOntd *big.Int, in
 			"ontToTokenSwapOutput",
 			[]interface{}{
 				tokenBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				invoker.Address,
 				maxOntd,
 			},
@@ -282,81 +390,44 @@ func (this *TestEnv) ontToTokenOutput(tokenBought *big.Int, maxOntd *big.Int, in
 			"ontToTokenTransferOutput",
 			[]interface{}{
 				tokenBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				invoker.Address,
 				maxOntd,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("ongToTokenOutput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
-
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("ongToTokenOutput, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	ongIncrement := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	if ongIncrement.Cmp(maxOntd) > 0 {
-		return fmt.Errorf("ongToTokenOutput, exchange ong balance increase incorrect")
-	}
-	log.Debugf("ongToTokenOutput, exchange ong increased by : %d\n", ongIncrement.String())
-	log.Debugf("ongToTokenOutput, exchange token decreased by : %d\n", exTokenB1.Sub(exTokenB1, exTokenB2).String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recBal2 := this.OnChainTState[0].Balances[recipient]
-		increment := big.NewInt(0).Sub(recBal2, recBal1)
-		if increment.Cmp(big.NewInt(0)) > 1 {
-			log.Debugf("ongToTokenOutput, recipient: %s received %+v tokens\n", recipient.ToBase58(), increment)
-		}
-	}
-
-	return nil
+	check := newSwapCheck(params[0].(string))
+	ontdSold, _ := getOutputPrice(tokenBought, this.OnChainEState[pool].OntdLiquid, this.OnChainEState[pool].TokenLiquid)
+	this.expectOntToToken(check, pool, invoker.Address, recipient, ontdSold, tokenBought)
+	return this.runSwap("ontToTokenOutput", check, invoker, params, func() error {
+		_, err := this.Simulator.OntToTokenOutput(this.OnChainEState[pool].ExchangeAddr, tokenBought, maxOntd, deadline, invoker.Address, recipient)
+		return err
+	}, pool)
 }
 
 
 
-func (this *TestEnv) tokenToOntInput(tokenSold *big.Int, minOng *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToOngInput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToOntInput(pool int, tokenSold *big.Int, minOntd *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToOntInput, %w", err)
+	}
+	if err := this.refreshPools(pool); err != nil {
+		return fmt.Errorf("tokenToOntInput, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recOngB1 := this.OnChainTState[0].Balances[recipient]
 
 	// Condition check
-	if this.OnChainEState[0].TokenLiquid.Cmp(tokenSold) < 0 {
-		return fmt.Errorf("tokenToOngInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[0].TokenLiquid.String(), tokenSold.String())
+	if this.OnChainEState[pool].TokenLiquid.Cmp(tokenSold) < 0 {
+		return fmt.Errorf("tokenToOntInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[pool].TokenLiquid.String(), tokenSold.String())
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(tokenSold) < 1 {
-		return fmt.Errorf("tokenToOngInput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(tokenSold) < 0 {
+		return fmt.Errorf("tokenToOntInput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(tokenSold) < 1 {
-		log.Debugf("tokenToOngInput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, tokenSold,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToOngInput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, tokenSold); err != nil {
+		return fmt.Errorf("tokenToOntInput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
@@ -364,8 +435,8 @@ func (this *TestEnv) tokenToOntInput(tokenSold *big.Int, minOng *big.Int, invoke
 			"tokenToOntSwapInput",
 			[]interface{}{
 				tokenSold,
-				minOng.Uint64(),
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				minOntd,
+				deadline,
 				invoker.Address,
 			},
 		}
@@ -374,88 +445,53 @@ func (this *TestEnv) tokenToOntInput(tokenSold *big.Int, minOng *big.Int, invoke
 			"tokenToOntTransferInput",
 			[]interface{}{
 				tokenSold,
-				minOng.Uint64(),
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				minOntd,
+				deadline,
 				invoker.Address,
 				recipient,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToOngInput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
-
-
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToOngInput, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %s\n", exOngInc.String())
-	log.Debugf("exchange token increased by : %s\n", exTokenInc.String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OnChainTState[0].Balances[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s ong increment %+v\n", recipient.ToBase58(), ongIncrement)
-
-	}
-
-	return nil
+	check := newSwapCheck(params[0].(string))
+	ontdBought, _ := getInputPrice(tokenSold, this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	this.expectTokenToOnt(check, pool, invoker.Address, recipient, tokenSold, ontdBought)
+	return this.runSwap("tokenToOntInput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToOntInput(this.OnChainEState[pool].ExchangeAddr, tokenSold, minOntd, deadline, invoker.Address, recipient)
+		return err
+	}, pool)
 }
 
 
 
-func (this *TestEnv) tokenToOntOutput(ongBought uint64, maxTokens *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToOngOutput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToOntOutput(pool int, ontdBought *big.Int, maxTokens *big.Int, invoker *ontology_go_sdk.Account, recipient common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToOntOutput, %w", err)
+	}
+	if err := this.refreshPools(pool); err != nil {
+		return fmt.Errorf("tokenToOntOutput, refreshBalance err: %w", err)
 	}
 
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-
-	recOngB1 := this.OntdBalance[recipient]
 	// Condition check
-	if this.OnChainEState[0].OntdLiquid.Cmp(big.NewInt(0).SetUint64(ongBought)) < 0 {
-		return fmt.Errorf("tokenToOngOutput, exchange ong balance: %v < ongBought: %v", this.OnChainEState[0].OntdLiquid, ongBought)
+	if this.OnChainEState[pool].OntdLiquid.Cmp(ontdBought) < 0 {
+		return fmt.Errorf("tokenToOntOutput, exchange ontd balance: %v < ontdBought: %v", this.OnChainEState[pool].OntdLiquid, ontdBought)
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(maxTokens) < 0 {
-		return fmt.Errorf("tokenToOngOutput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(maxTokens) < 0 {
+		return fmt.Errorf("tokenToOntOutput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(maxTokens) < 0 {
-		log.Debugf("tokenToOngOutput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, maxTokens,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToOngOutput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, maxTokens); err != nil {
+		return fmt.Errorf("tokenToOntOutput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
 		params = []interface{}{
 			"tokenToOntSwapOutput",
 			[]interface{}{
-				ongBought,
+				ontdBought,
 				maxTokens,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				invoker.Address,
 			},
 		}
@@ -463,78 +499,51 @@ func (this *TestEnv) tokenToOntOutput(ongBought uint64, maxTokens *big.Int, invo
 		params = []interface{}{
 			"tokenToOntTransferOutput",
 			[]interface{}{
-				ongBought,
+				ontdBought,
 				maxTokens,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				invoker.Address,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToOngOutput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
+	check := newSwapCheck(params[0].(string))
+	tokensSold, _ := getOutputPrice(ontdBought, this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	this.expectTokenToOnt(check, pool, invoker.Address, recipient, tokensSold, ontdBought)
+	return this.runSwap("tokenToOntOutput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToOntOutput(this.OnChainEState[pool].ExchangeAddr, ontdBought, maxTokens, deadline, invoker.Address, recipient)
+		return err
+	}, pool)
+}
 
 
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToOngInput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToTokenInput(pool int, tokenSold *big.Int, minTokenBought *big.Int, minOntdBought *big.Int, invoker *ontology_go_sdk.Account, recipient, tokenAddr common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToTokenInput, %w", err)
 	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %v\n", exOngInc)
-	log.Debugf("exchange token increased by : %v\n", exTokenInc)
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OntdBalance[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s received %+v ong\n", recipient.ToBase58(), ongIncrement)
+	bought, err := this.poolIndex(tokenAddr)
+	if err != nil {
+		return fmt.Errorf("tokenToTokenInput, %w", err)
 	}
-
-	return nil
-}
-
-
-func (this *TestEnv) tokenToTokenInput(tokenSoldIndex int, tokenSold *big.Int, minTokenBought *big.Int, minOntdBought *big.Int, invoker *ontology_go_sdk.Account, recipient, tokenAddr common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToTokenInput, refreshBalance err: %v", err)
+	if bought == pool {
+		return fmt.Errorf("tokenToTokenInput, sold and bought token are both in pool %d", pool)
+	}
+	if err := this.refreshPools(pool, bought); err != nil {
+		return fmt.Errorf("tokenToTokenInput, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recOngB1 := this.OnChainTState[0].Balances[recipient]
 
 	// Condition check
-	if this.OnChainEState[0].TokenLiquid.Cmp(tokenSold) < 0 {
-		return fmt.Errorf("tokenToTokenInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[0].TokenLiquid.String(), tokenSold.String())
+	if this.OnChainEState[pool].TokenLiquid.Cmp(tokenSold) < 0 {
+		return fmt.Errorf("tokenToTokenInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[pool].TokenLiquid.String(), tokenSold.String())
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(tokenSold) < 1 {
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(tokenSold) < 0 {
 		return fmt.Errorf("tokenToTokenInput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(tokenSold) < 1 {
-		log.Debugf("tokenToTokenInput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, tokenSold,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToTokenInput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, tokenSold); err != nil {
+		return fmt.Errorf("tokenToTokenInput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
@@ -544,7 +553,7 @@ func (this *TestEnv) tokenToTokenInput(tokenSoldIndex int, tokenSold *big.Int, m
 				tokenSold,
 				minTokenBought,
 				minOntdBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				tokenAddr,
 				invoker.Address,
 			},
@@ -556,78 +565,52 @@ func (this *TestEnv) tokenToTokenInput(tokenSoldIndex int, tokenSold *big.Int, m
 				tokenSold,
 				minTokenBought,
 				minOntdBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				tokenAddr,
 				invoker.Address,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToTokenInput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
+	check := newSwapCheck(params[0].(string))
+	ontdBought, _ := getInputPrice(tokenSold, this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	tokensBought, _ := getInputPrice(bigOrZero(ontdBought), this.OnChainEState[bought].OntdLiquid, this.OnChainEState[bought].TokenLiquid)
+	this.expectTokenToToken(check, pool, bought, invoker.Address, recipient, tokenSold, ontdBought, tokensBought)
+	return this.runSwap("tokenToTokenInput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToTokenInput(this.OnChainEState[pool].ExchangeAddr, tokenSold, minTokenBought, minOntdBought, deadline, invoker.Address, recipient, tokenAddr)
+		return err
+	}, pool, bought)
+}
 
 
 
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToOngInput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToTokenOutput(pool int, tokenBought *big.Int, maxTokenSold *big.Int, maxOntdSold *big.Int, invoker *ontology_go_sdk.Account, recipient, tokenAddr common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToTokenOutput, %w", err)
 	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %s\n", exOngInc.String())
-	log.Debugf("exchange token increased by : %s\n", exTokenInc.String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OnChainTState[0].Balances[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s ong increment %+v\n", recipient.ToBase58(), ongIncrement)
-
+	bought, err := this.poolIndex(tokenAddr)
+	if err != nil {
+		return fmt.Errorf("tokenToTokenOutput, %w", err)
 	}
-	return nil
-}
-
-
-
-func (this *TestEnv) tokenToTokenOutput(tokenBoughtIndex int, tokenBought *big.Int, maxTokenSold *big.Int, maxOntdSold *big.Int, invoker *ontology_go_sdk.Account, recipient, tokenAddr common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToTokenInput, refreshBalance err: %v", err)
+	if bought == pool {
+		return fmt.Errorf("tokenToTokenOutput, sold and bought token are both in pool %d", pool)
+	}
+	if err := this.refreshPools(pool, bought); err != nil {
+		return fmt.Errorf("tokenToTokenOutput, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recOngB1 := this.OnChainTState[0].Balances[recipient]
 
 	// Condition check
-	if this.OnChainEState[0].TokenLiquid.Cmp(tokenBought) < 0 {
-		return fmt.Errorf("tokenToTokenOutput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[0].TokenLiquid.String(), tokenBought.String())
+	if this.OnChainEState[bought].TokenLiquid.Cmp(tokenBought) < 0 {
+		return fmt.Errorf("tokenToTokenOutput, exchange token balance: %v < tokenBought: %v", this.OnChainEState[bought].TokenLiquid.String(), tokenBought.String())
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(maxTokenSold) < 1 {
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(maxTokenSold) < 0 {
 		return fmt.Errorf("tokenToTokenOutput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(maxTokenSold) < 1 {
-		log.Debugf("tokenToTokenOutput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, maxTokenSold,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToTokenOutput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, maxTokenSold); err != nil {
+		return fmt.Errorf("tokenToTokenOutput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
@@ -637,7 +620,7 @@ func (this *TestEnv) tokenToTokenOutput(tokenBoughtIndex int, tokenBought *big.I
 				tokenBought,
 				maxTokenSold,
 				maxOntdSold,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				tokenAddr,
 				invoker.Address,
 			},
@@ -649,78 +632,52 @@ func (this *TestEnv) tokenToTokenOutput(tokenBoughtIndex int, tokenBought *big.I
 				tokenBought,
 				maxTokenSold,
 				maxOntdSold,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				tokenAddr,
 				invoker.Address,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToTokenOutput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
+	check := newSwapCheck(params[0].(string))
+	ontdSold, _ := getOutputPrice(tokenBought, this.OnChainEState[bought].OntdLiquid, this.OnChainEState[bought].TokenLiquid)
+	tokensSold, _ := getOutputPrice(bigOrZero(ontdSold), this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	this.expectTokenToToken(check, pool, bought, invoker.Address, recipient, tokensSold, ontdSold, tokenBought)
+	return this.runSwap("tokenToTokenOutput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToTokenOutput(this.OnChainEState[pool].ExchangeAddr, tokenBought, maxTokenSold, maxOntdSold, deadline, invoker.Address, recipient, tokenAddr)
+		return err
+	}, pool, bought)
+}
 
 
 
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToTokenOutput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToExchangeInput(pool int, tokenSold *big.Int, minTokenBought *big.Int, minOntdBought *big.Int, invoker *ontology_go_sdk.Account, recipient, exAddr common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToExchangeInput, %w", err)
 	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %s\n", exOngInc.String())
-	log.Debugf("exchange token increased by : %s\n", exTokenInc.String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OnChainTState[0].Balances[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s ong increment %+v\n", recipient.ToBase58(), ongIncrement)
-
+	bought, err := this.poolIndex(exAddr)
+	if err != nil {
+		return fmt.Errorf("tokenToExchangeInput, %w", err)
 	}
-	return nil
-}
-
-
-
-func (this *TestEnv) tokenToExchangeInput(tokenSoldIndex int, tokenSold *big.Int, minTokenBought *big.Int, minOntdBought *big.Int, invoker *ontology_go_sdk.Account, recipient, exAddr common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToExchangeInput, refreshBalance err: %v", err)
+	if bought == pool {
+		return fmt.Errorf("tokenToExchangeInput, sold and bought token are both in pool %d", pool)
+	}
+	if err := this.refreshPools(pool, bought); err != nil {
+		return fmt.Errorf("tokenToExchangeInput, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recOngB1 := this.OnChainTState[0].Balances[recipient]
 
 	// Condition check
-	if this.OnChainEState[0].TokenLiquid.Cmp(tokenSold) < 0 {
-		return fmt.Errorf("tokenToExchangeInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[0].TokenLiquid.String(), tokenSold.String())
+	if this.OnChainEState[pool].TokenLiquid.Cmp(tokenSold) < 0 {
+		return fmt.Errorf("tokenToExchangeInput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[pool].TokenLiquid.String(), tokenSold.String())
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(tokenSold) < 1 {
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(tokenSold) < 0 {
 		return fmt.Errorf("tokenToExchangeInput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(tokenSold) < 1 {
-		log.Debugf("tokenToExchangeInput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, tokenSold,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToExchangeInput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, tokenSold); err != nil {
+		return fmt.Errorf("tokenToExchangeInput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
@@ -730,7 +687,7 @@ func (this *TestEnv) tokenToExchangeInput(tokenSoldIndex int, tokenSold *big.Int
 				tokenSold,
 				minTokenBought,
 				minOntdBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				exAddr,
 				invoker.Address,
 			},
@@ -742,77 +699,51 @@ func (this *TestEnv) tokenToExchangeInput(tokenSoldIndex int, tokenSold *big.Int
 				tokenSold,
 				minTokenBought,
 				minOntdBought,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
 				exAddr,
 				invoker.Address,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToExchangeInput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
+	check := newSwapCheck(params[0].(string))
+	ontdBought, _ := getInputPrice(tokenSold, this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	tokensBought, _ := getInputPrice(bigOrZero(ontdBought), this.OnChainEState[bought].OntdLiquid, this.OnChainEState[bought].TokenLiquid)
+	this.expectTokenToToken(check, pool, bought, invoker.Address, recipient, tokenSold, ontdBought, tokensBought)
+	return this.runSwap("tokenToExchangeInput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToExchangeInput(this.OnChainEState[pool].ExchangeAddr, tokenSold, minTokenBought, minOntdBought, deadline, invoker.Address, recipient, exAddr)
+		return err
+	}, pool, bought)
+}
 
 
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToExchangeInput, refreshBalance err: %v", err)
+func (this *TestEnv) tokenToExchangeOutput(pool int, tokenBought *big.Int, maxTokenSold *big.Int, maxOntdSold *big.Int, invoker *ontology_go_sdk.Account, recipient, exAddr common.Address) error {
+	if err := this.checkPool(pool); err != nil {
+		return fmt.Errorf("tokenToExchangeOutput, %w", err)
 	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %s\n", exOngInc.String())
-	log.Debugf("exchange token increased by : %s\n", exTokenInc.String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OnChainTState[0].Balances[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s ong increment %+v\n", recipient.ToBase58(), ongIncrement)
-
+	bought, err := this.poolIndex(exAddr)
+	if err != nil {
+		return fmt.Errorf("tokenToExchangeOutput, %w", err)
 	}
-	return nil
-}
-
-
-func (this *TestEnv) tokenToExchangeOutput(tokenBoughtIndex int, tokenBought *big.Int, maxTokenSold *big.Int, maxOntdSold *big.Int, invoker *ontology_go_sdk.Account, recipient, tokenAddr common.Address) error {
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToTokenInput, refreshBalance err: %v", err)
+	if bought == pool {
+		return fmt.Errorf("tokenToExchangeOutput, sold and bought token are both in pool %d", pool)
+	}
+	if err := this.refreshPools(pool, bought); err != nil {
+		return fmt.Errorf("tokenToExchangeOutput, refreshBalance err: %w", err)
 	}
-
-	exOngBalance1 := this.OnChainEState[0].OntdLiquid
-	exTokenB1 := this.OnChainEState[0].TokenLiquid
-	recOngB1 := this.OnChainTState[0].Balances[recipient]
 
 	// Condition check
-	if this.OnChainEState[0].TokenLiquid.Cmp(tokenBought) < 0 {
-		return fmt.Errorf("tokenToTokenOutput, exchange token balance: %v < tokenSold: %v", this.OnChainEState[0].TokenLiquid.String(), tokenBought.String())
+	if this.OnChainEState[bought].TokenLiquid.Cmp(tokenBought) < 0 {
+		return fmt.Errorf("tokenToExchangeOutput, exchange token balance: %v < tokenBought: %v", this.OnChainEState[bought].TokenLiquid.String(), tokenBought.String())
 	}
-	if this.OnChainTState[0].Balances[invoker.Address].Cmp(maxTokenSold) < 1 {
-		return fmt.Errorf("tokenToTokenOutput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
+	if this.OnChainTState[pool].Balances[invoker.Address].Cmp(maxTokenSold) < 0 {
+		return fmt.Errorf("tokenToExchangeOutput, invoker: %s, not have enough token balance", invoker.Address.ToBase58())
 	}
-	if this.OnChainTState[0].Allowances[invoker.Address].Cmp(maxTokenSold) < 1 {
-		log.Debugf("tokenToTokenOutput, invoker: %s, not have allowance token", invoker.Address.ToBase58())
-		// approve token to exchange from invoker
-		approveTxHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainTState[0].TokenAddr, []interface{}{"approve", []interface{}{
-			invoker.Address, this.OnChainEState[0].ExchangeAddr, maxTokenSold,
-		}})
-		if err != nil {
-			return fmt.Errorf("tokenToTokenOutput: %s, approve token to exchange err: %v", invoker.Address.ToBase58(), err)
-		}
-		if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-			return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-		}
-		utils.PrintSmartEventByHash_Ont(this.Sdk, approveTxHash.ToHexString())
+	if err := this.ensureTokenAllowance(pool, invoker, maxTokenSold); err != nil {
+		return fmt.Errorf("tokenToExchangeOutput, %w", err)
 	}
 
+	deadline := time.Now().Add(this.WaitTxTimeOut).Unix()
 	var params []interface{}
 	// tokenToOngInput
 	if invoker.Address == recipient {
@@ -822,8 +753,8 @@ func (this *TestEnv) tokenToExchangeOutput(tokenBoughtIndex int, tokenBought *bi
 				tokenBought,
 				maxTokenSold,
 				maxOntdSold,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
-				tokenAddr,
+				deadline,
+				exAddr,
 				invoker.Address,
 			},
 		}
@@ -834,41 +765,19 @@ func (this *TestEnv) tokenToExchangeOutput(tokenBoughtIndex int, tokenBought *bi
 				tokenBought,
 				maxTokenSold,
 				maxOntdSold,
-				time.Now().Add(this.WaitTxTimeOut).Unix(),
+				deadline,
 				recipient,
-				tokenAddr,
+				exAddr,
 				invoker.Address,
 			},
 		}
 	}
-	txHash, err := this.Sdk.NeoVM.InvokeNeoVMContract(this.GasPrice, this.GasLimit, invoker, invoker, this.OnChainEState[0].ExchangeAddr, params)
-	if err != nil {
-		return fmt.Errorf("tokenToTokenOutput, invoker: %s invoke err: %v", invoker.Address.ToBase58(), err)
-	}
-	if _, err := this.Sdk.WaitForGenerateBlock(this.WaitTxTimeOut, 1); err != nil {
-		return fmt.Errorf("Ontology, not generate block after %+v, err: %v", this.WaitTxTimeOut, err)
-	}
-	utils.PrintSmartEventByHash_Ont(this.Sdk, txHash.ToHexString())
-
-
-
-	if err := this.refreshAcctBalance(); err != nil {
-		return fmt.Errorf("tokenToTokenOutput, refreshBalance err: %v", err)
-	}
-	exOngBalance2 := this.OnChainEState[0].OntdLiquid
-	exTokenB2 := this.OnChainEState[0].TokenLiquid
-	exOngInc := big.NewInt(0).Sub(exOngBalance2, exOngBalance1)
-	exTokenInc := big.NewInt(0).Sub(exTokenB2, exTokenB1)
-	log.Debugf("exchange ong increased by : %s\n", exOngInc.String())
-	log.Debugf("exchange token increased by : %s\n", exTokenInc.String())
-
-	if invoker.Address == recipient {
-
-	} else {
-		recOngB2 := this.OnChainTState[0].Balances[recipient]
-		ongIncrement := big.NewInt(0).Sub(recOngB2, recOngB1)
-		log.Debugf("recipient: %s ong increment %+v\n", recipient.ToBase58(), ongIncrement)
-
-	}
-	return nil
+	check := newSwapCheck(params[0].(string))
+	ontdSold, _ := getOutputPrice(tokenBought, this.OnChainEState[bought].OntdLiquid, this.OnChainEState[bought].TokenLiquid)
+	tokensSold, _ := getOutputPrice(bigOrZero(ontdSold), this.OnChainEState[pool].TokenLiquid, this.OnChainEState[pool].OntdLiquid)
+	this.expectTokenToToken(check, pool, bought, invoker.Address, recipient, tokensSold, ontdSold, tokenBought)
+	return this.runSwap("tokenToExchangeOutput", check, invoker, params, func() error {
+		_, err := this.Simulator.TokenToExchangeOutput(this.OnChainEState[pool].ExchangeAddr, tokenBought, maxTokenSold, maxOntdSold, deadline, invoker.Address, recipient, exAddr)
+		return err
+	}, pool, bought)
 }
@@ -18,10 +18,7 @@
 package exchange
 
 import (
-	"encoding/hex"
 	"fmt"
-	"github.com/ontio/ontology/common"
-	"github.com/skyinglyh1/uniswap_v1_test/log"
 	"math/big"
 	"testing"
 )
@@ -31,23 +28,33 @@ func Test_AddLiquidity(t *testing.T) {
 	providerAddr := testEnv.OnChainEState[0].Providers[0].Address
 	fmt.Printf("account: %s, ongBalance: %+v, tokenBalance: %+v, shareBalance: %+v\n", providerAddr.ToBase58(), testEnv.OntdBalance[providerAddr], testEnv.OnChainTState[0].Balances[providerAddr], testEnv.OnChainEState[0].ShareBalance[providerAddr])
 
-	if err := testEnv.addLiquid(0, big.NewInt(100), big.NewInt(0).Add(big.NewInt(100000), big.NewInt(100000)), big.NewInt(200000)); err != nil {
-		log.Errorf("address: %s, addLiquid() error: %+v", err)
+	ontdAmt := big.NewInt(200000)
+	for pool := 0; pool < 2; pool++ {
+		if err := testEnv.addLiquid(pool, big.NewInt(100), addLiquidMaxTokens(t, pool, ontdAmt), ontdAmt); err != nil {
+			t.Fatalf("addLiquid() on pool %d error: %v", pool, err)
+		}
 	}
-	if err := testEnv.addLiquid(1, big.NewInt(100), big.NewInt(0).Add(big.NewInt(100000), big.NewInt(100000)), big.NewInt(200000)); err != nil {
-		log.Errorf("address: %s, addLiquid() error: %+v", err)
+}
+
+// addLiquidMaxTokens returns the tokens a deposit of ontdAmt into pool takes at its current reserves
+func addLiquidMaxTokens(t *testing.T, pool int, ontdAmt *big.Int) *big.Int {
+	if err := testEnv.refreshPools(pool); err != nil {
+		t.Fatalf("refreshPools error: %v", err)
 	}
+	exState := testEnv.OnChainEState[pool]
+	tokens := new(big.Int).Mul(ontdAmt, exState.TokenLiquid)
+	return tokens.Add(tokens.Div(tokens, exState.OntdLiquid), big.NewInt(1))
 }
 
 func Test_RemoveLiquidity(t *testing.T) {
 	providerAddr := testEnv.OnChainEState[0].Providers[0].Address
 	fmt.Printf("account: %s, ongBalance: %+v, tokenBalance: %+v, shareBalance: %+v\n", providerAddr.ToBase58(), testEnv.OntdBalance[providerAddr], testEnv.OnChainEState[0].ShareBalance[providerAddr], testEnv.OnChainEState[0].ShareBalance[providerAddr])
 
-	if err := testEnv.removeLiquid(0, big.NewInt(1000), big.NewInt(1), testEnv.OnChainEState[0].Providers[0]); err != nil {
-		log.Errorf("address: %s, removeLiquid() error: %+v", err)
+	if err := testEnv.removeLiquid(0, big.NewInt(1000), big.NewInt(1), big.NewInt(1), testEnv.OnChainEState[0].Providers[0]); err != nil {
+		t.Fatalf("removeLiquid() error: %v", err)
 	}
-	if err := testEnv.removeLiquid(1, big.NewInt(1000), big.NewInt(1), testEnv.OnChainEState[0].Providers[0]); err != nil {
-		log.Errorf("address: %s, removeLiquid() error: %+v", err)
+	if err := testEnv.removeLiquid(1, big.NewInt(1000), big.NewInt(1), big.NewInt(1), testEnv.OnChainEState[0].Providers[0]); err != nil {
+		t.Fatalf("removeLiquid() error: %v", err)
 	}
 }
 
@@ -57,12 +64,11 @@ func Test_ontToTokenInput(t *testing.T) {
 	ontdSold := big.NewInt(10)
 	minTokens := big.NewInt(1)
 
-	testEnv.OnChainEState[0].offOntToTokenInput(big.NewInt(5), minTokens)
-	if err := testEnv.ontToTokenInput(ontdSold, minTokens, testEnv.OnChainEState[0].Providers[0], testEnv.OnChainEState[0].Providers[0].Address); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+	if err := testEnv.ontToTokenInput(0, ontdSold, minTokens, testEnv.OnChainEState[0].Providers[0], testEnv.OnChainEState[0].Providers[0].Address); err != nil {
+		t.Fatalf("ongToTokenSwapInput() error: %v", err)
 	}
-	if err := testEnv.ontToTokenInput(ontdSold, minTokens, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address); err != nil {
-		log.Errorf("address: %s, ongToTokenTransferInput() error: %+v", err)
+	if err := testEnv.ontToTokenInput(0, ontdSold, minTokens, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address); err != nil {
+		t.Fatalf("ongToTokenTransferInput() error: %v", err)
 	}
 }
 
@@ -73,12 +79,11 @@ func Test_ontToTokenOutput(t *testing.T) {
 	tokenBought := big.NewInt(10)
 	maxOntd := big.NewInt(100)
 
-	testEnv.OnChainEState[0].offOntToTokenOutput(big.NewInt(5), maxOntd)
-	if err := testEnv.ontToTokenOutput(tokenBought, maxOntd, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapOutput() error: %+v", err)
+	if err := testEnv.ontToTokenOutput(0, tokenBought, maxOntd, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
+		t.Fatalf("ongToTokenSwapOutput() error: %v", err)
 	}
-	if err := testEnv.ontToTokenOutput(tokenBought, maxOntd, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
-		log.Errorf("address: %s, ongToTokeTransferpOutput() error: %+v", err)
+	if err := testEnv.ontToTokenOutput(0, tokenBought, maxOntd, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
+		t.Fatalf("ongToTokeTransferpOutput() error: %v", err)
 	}
 }
 
@@ -90,12 +95,11 @@ func Test_tokenToOntInput(t *testing.T) {
 	tokenSold := big.NewInt(5)
 	minOng := big.NewInt(1)
 
-	testEnv.OnChainEState[0].offTokenToOntInput(big.NewInt(5), minOng)
-	if err := testEnv.tokenToOntInput(tokenSold, minOng, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
-		log.Errorf("address: %s, tokenToOngSwapInput() error: %+v", err)
+	if err := testEnv.tokenToOntInput(0, tokenSold, minOng, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
+		t.Fatalf("tokenToOngSwapInput() error: %v", err)
 	}
-	if err := testEnv.tokenToOntInput(tokenSold, minOng, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
-		log.Errorf("address: %s, tokenToOngTransferInput() error: %+v", err)
+	if err := testEnv.tokenToOntInput(0, tokenSold, minOng, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
+		t.Fatalf("tokenToOngTransferInput() error: %v", err)
 	}
 }
 
@@ -105,15 +109,14 @@ func Test_tokenToOntOutput(t *testing.T) {
 	usrAddr := testEnv.Users[0].Address
 	fmt.Printf("account: %s, ongBalance: %+v, tokenBalance: %+v, shareBalance: %+v\n", usrAddr.ToBase58(), testEnv.OntdBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr])
 
-	var ongBought uint64 = 5
+	ontdBought := big.NewInt(5)
 	maxTokens := big.NewInt(100)
 
-	testEnv.OnChainEState[0].offTokenToOntOutput(big.NewInt(0).SetUint64(ongBought), maxTokens)
-	if err := testEnv.tokenToOntOutput(ongBought, maxTokens, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
-		log.Errorf("address: %s, tokenToOngSwapInput() error: %+v", err)
+	if err := testEnv.tokenToOntOutput(0, ontdBought, maxTokens, testEnv.Users[0], testEnv.Users[0].Address); err != nil {
+		t.Fatalf("tokenToOngSwapInput() error: %v", err)
 	}
-	if err := testEnv.tokenToOntOutput(ongBought, maxTokens, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
-		log.Errorf("address: %s, tokenToOngTransferInput() error: %+v", err)
+	if err := testEnv.tokenToOntOutput(0, ontdBought, maxTokens, testEnv.Users[0], testEnv.Users[1].Address); err != nil {
+		t.Fatalf("tokenToOngTransferInput() error: %v", err)
 	}
 }
 
@@ -178,17 +181,22 @@ func Test_tokenToTokenInput(t *testing.T) {
 
 	tokenSold := big.NewInt(50)
 
-	ontdBought, tokenBought := testEnv.offTokenToTokenInput(tokenSold)
+	ontdBought, tokenBought, err := testEnv.offTokenToTokenInput(0, 1, tokenSold)
+	if err != nil {
+		t.Fatalf("offTokenToTokenInput error: %v", err)
+	}
 	minOntdBought, minTokenBought := ontdBought.Sub(ontdBought, big.NewInt(10)), tokenBought.Sub(tokenBought, big.NewInt(10))
 
-	token1Hash, _ := common.AddressFromHexString(hex.EncodeToString(testEnv.OnChainTState[1].TokenAddr[:]))
+	token1Hash := testEnv.OnChainTState[1].TokenAddr
 	if err := testEnv.tokenToTokenInput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, token1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+		t.Fatalf("tokenToTokenInput() error: %v", err)
+	}
+	if ontdBought, tokenBought, err = testEnv.offTokenToTokenInput(0, 1, tokenSold); err != nil {
+		t.Fatalf("offTokenToTokenInput error: %v", err)
 	}
-	ontdBought, tokenBought = testEnv.offTokenToTokenInput(tokenSold)
 	minOntdBought, minTokenBought = ontdBought, tokenBought
 	if err := testEnv.tokenToTokenInput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, token1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+		t.Fatalf("tokenToTokenInput() error: %v", err)
 	}
 }
 
@@ -198,18 +206,20 @@ func Test_tokenToTokenOutput(t *testing.T) {
 	fmt.Printf("account: %s, ongBalance: %+v, tokenBalance: %+v, shareBalance: %+v\n", usrAddr.ToBase58(), testEnv.OntdBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr])
 
 	tokenBought := big.NewInt(50)
+	token1Hash := testEnv.OnChainTState[1].TokenAddr
 
-	ontdBought1, tokenBought1 := testEnv.offTokenToTokenOutput(tokenBought)
-	minOntdBought2, minTokenBought2 := ontdBought1, tokenBought1
-
-	token1Hash, _ := common.AddressFromHexString(hex.EncodeToString(testEnv.OnChainTState[1].TokenAddr[:]))
-	if err := testEnv.tokenToTokenOutput(0, tokenBought, minTokenBought2, minOntdBought2, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, token1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+	maxTokenSold, maxOntdSold, err := testEnv.offTokenToTokenOutput(0, 1, tokenBought)
+	if err != nil {
+		t.Fatalf("offTokenToTokenOutput error: %v", err)
+	}
+	if err := testEnv.tokenToTokenOutput(0, tokenBought, maxTokenSold, maxOntdSold, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, token1Hash); err != nil {
+		t.Fatalf("tokenToTokenOutput() error: %v", err)
 	}
-	ontdBought3, tokenBought3 := testEnv.offTokenToTokenInput(tokenBought)
-	minOntdBought4, minTokenBought4 := ontdBought3, tokenBought3
-	if err := testEnv.tokenToTokenOutput(0, tokenBought, minTokenBought4, minOntdBought4, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, token1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+	if maxTokenSold, maxOntdSold, err = testEnv.offTokenToTokenOutput(0, 1, tokenBought); err != nil {
+		t.Fatalf("offTokenToTokenOutput error: %v", err)
+	}
+	if err := testEnv.tokenToTokenOutput(0, tokenBought, maxTokenSold, maxOntdSold, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, token1Hash); err != nil {
+		t.Fatalf("tokenToTokenOutput() error: %v", err)
 	}
 }
 
@@ -220,18 +230,23 @@ func Test_tokenToExchangeInput(t *testing.T) {
 
 	tokenSold := big.NewInt(20)
 
-	ontdBought, tokenBought := testEnv.offTokenToTokenInput(tokenSold)
+	ontdBought, tokenBought, err := testEnv.offTokenToTokenInput(0, 1, tokenSold)
+	if err != nil {
+		t.Fatalf("offTokenToTokenInput error: %v", err)
+	}
 	minOntdBought, minTokenBought := ontdBought, tokenBought
 
-	exchange1Hash, _ := common.AddressFromHexString(hex.EncodeToString(testEnv.OnChainEState[1].ExchangeAddr[:]))
+	exchange1Hash := testEnv.OnChainEState[1].ExchangeAddr
 
 	if err := testEnv.tokenToExchangeInput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, exchange1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+		t.Fatalf("tokenToExchangeInput() error: %v", err)
+	}
+	if ontdBought, tokenBought, err = testEnv.offTokenToTokenInput(0, 1, tokenSold); err != nil {
+		t.Fatalf("offTokenToTokenInput error: %v", err)
 	}
-	ontdBought, tokenBought = testEnv.offTokenToTokenInput(tokenSold)
 	minOntdBought, minTokenBought = ontdBought, tokenBought
 	if err := testEnv.tokenToExchangeInput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, exchange1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+		t.Fatalf("tokenToExchangeInput() error: %v", err)
 	}
 }
 
@@ -240,18 +255,66 @@ func Test_tokenToExchangeOutput(t *testing.T) {
 	usrAddr := testEnv.Users[0].Address
 	fmt.Printf("account: %s, ongBalance: %+v, tokenBalance: %+v, shareBalance: %+v\n", usrAddr.ToBase58(), testEnv.OntdBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr], testEnv.OnChainEState[0].ShareBalance[usrAddr])
 
-	tokenSold := big.NewInt(50)
+	tokenBought := big.NewInt(50)
+	exchange1Hash := testEnv.OnChainEState[1].ExchangeAddr
 
-	ontdBought, tokenBought := testEnv.offTokenToTokenOutput(tokenSold)
-	minOntdBought, minTokenBought := ontdBought, tokenBought
+	maxTokenSold, maxOntdSold, err := testEnv.offTokenToTokenOutput(0, 1, tokenBought)
+	if err != nil {
+		t.Fatalf("offTokenToTokenOutput error: %v", err)
+	}
+	if err := testEnv.tokenToExchangeOutput(0, tokenBought, maxTokenSold, maxOntdSold, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, exchange1Hash); err != nil {
+		t.Fatalf("tokenToExchangeOutput() error: %v", err)
+	}
+	if maxTokenSold, maxOntdSold, err = testEnv.offTokenToTokenOutput(0, 1, tokenBought); err != nil {
+		t.Fatalf("offTokenToTokenOutput error: %v", err)
+	}
+	if err := testEnv.tokenToExchangeOutput(0, tokenBought, maxTokenSold, maxOntdSold, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, exchange1Hash); err != nil {
+		t.Fatalf("tokenToExchangeOutput() error: %v", err)
+	}
+}
 
-	exchange1Hash, _ := common.AddressFromHexString(hex.EncodeToString(testEnv.OnChainEState[1].ExchangeAddr[:]))
-	if err := testEnv.tokenToExchangeOutput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[0].Address, exchange1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+func Test_PoolAwareSwaps(t *testing.T) {
+	if len(testEnv.OnChainEState) < 2 {
+		t.Skip("needs two pools")
 	}
-	ontdBought, tokenBought = testEnv.offTokenToTokenInput(tokenSold)
-	minOntdBought, minTokenBought = ontdBought, tokenBought
-	if err := testEnv.tokenToExchangeOutput(0, tokenSold, minTokenBought, minOntdBought, testEnv.OnChainEState[0].Providers[0], testEnv.Users[1].Address, exchange1Hash); err != nil {
-		log.Errorf("address: %s, ongToTokenSwapInput() error: %+v", err)
+	if err := testEnv.checkPool(len(testEnv.OnChainEState)); err == nil {
+		t.Fatalf("checkPool accepts an index out of range")
+	}
+	if pool, err := testEnv.poolIndex(testEnv.OnChainTState[1].TokenAddr); err != nil || pool != 1 {
+		t.Fatalf("poolIndex of token 1: %d, err: %v", pool, err)
+	}
+	if pool, err := testEnv.poolIndex(testEnv.OnChainEState[1].ExchangeAddr); err != nil || pool != 1 {
+		t.Fatalf("poolIndex of exchange 1: %d, err: %v", pool, err)
+	}
+	if err := testEnv.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+	trader := testEnv.Users[1]
+	ontd0, ontd1 := testEnv.OnChainEState[0].OntdLiquid, testEnv.OnChainEState[1].OntdLiquid
+	tokens1 := testEnv.OnChainTState[1].Balances[trader.Address]
+	if err := testEnv.ontToTokenInput(1, big.NewInt(1000), big.NewInt(1), trader, trader.Address); err != nil {
+		t.Fatalf("ontToTokenInput on pool 1 error: %v", err)
+	}
+	if testEnv.OnChainEState[0].OntdLiquid.Cmp(ontd0) != 0 || testEnv.OnChainEState[1].OntdLiquid.Cmp(new(big.Int).Add(ontd1, big.NewInt(1000))) != 0 {
+		t.Fatalf("ontd reserves: %v -> %v, %v -> %v", ontd0, testEnv.OnChainEState[0].OntdLiquid, ontd1, testEnv.OnChainEState[1].OntdLiquid)
+	}
+	if testEnv.OnChainTState[1].Balances[trader.Address].Cmp(tokens1) <= 0 {
+		t.Fatalf("token 1 balance of trader: %v -> %v", tokens1, testEnv.OnChainTState[1].Balances[trader.Address])
+	}
+
+	// sell the token of the last pool for the token of pool 0
+	last := len(testEnv.OnChainEState) - 1
+	tokensLast, tokens0 := testEnv.OnChainEState[last].TokenLiquid, testEnv.OnChainTState[0].Balances[trader.Address]
+	if err := testEnv.tokenToTokenInput(last, big.NewInt(1000), big.NewInt(1), big.NewInt(1), trader, trader.Address, testEnv.OnChainTState[0].TokenAddr); err != nil {
+		t.Fatalf("tokenToTokenInput from pool %d error: %v", last, err)
+	}
+	if testEnv.OnChainEState[last].TokenLiquid.Cmp(new(big.Int).Add(tokensLast, big.NewInt(1000))) != 0 {
+		t.Fatalf("token reserve of pool %d: %v -> %v", last, tokensLast, testEnv.OnChainEState[last].TokenLiquid)
+	}
+	if testEnv.OnChainTState[0].Balances[trader.Address].Cmp(tokens0) <= 0 {
+		t.Fatalf("token 0 balance of trader: %v -> %v", tokens0, testEnv.OnChainTState[0].Balances[trader.Address])
+	}
+	if err := testEnv.tokenToExchangeInput(last, big.NewInt(1000), big.NewInt(1), big.NewInt(1), trader, trader.Address, testEnv.OnChainEState[last].ExchangeAddr); err == nil {
+		t.Fatalf("tokenToExchangeInput accepts the pool itself as target")
 	}
 }
@@ -0,0 +1,286 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Snapshot is a deep copy of the on chain state of a TestEnv that can be written to disk as json.
+// Accounts are keyed by base58 address, contracts by hex address.
+type Snapshot struct {
+	Factory *FactorySnapshot
+	Tokens []*TokenSnapshot
+	Exchanges []*ExchangeSnapshot
+	OntdBalances map[string]*big.Int
+	// OntdAllowances[owner][exchange]
+	OntdAllowances map[string]map[string]*big.Int
+}
+
+type FactorySnapshot struct {
+	Address string
+	TokenToExchange map[string]string
+	ExchangeToToken map[string]string
+	IdToToken map[uint64]string
+}
+
+type TokenSnapshot struct {
+	Address string
+	Supply *big.Int
+	Balances map[string]*big.Int
+	// Allowances are those to the exchange of the token
+	Allowances map[string]*big.Int
+}
+
+type ExchangeSnapshot struct {
+	Address string
+	Token string
+	Factory string
+	OntdReserve *big.Int
+	TokenReserve *big.Int
+	ShareSupply *big.Int
+	Shares map[string]*big.Int
+}
+
+// Snapshot copies the current OnChain*State and ontd state of the env
+func (this *TestEnv) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		Factory: &FactorySnapshot{
+			Address: this.OnChainFState.FactoryAddr.ToHexString(),
+			TokenToExchange: make(map[string]string),
+			ExchangeToToken: make(map[string]string),
+			IdToToken: make(map[uint64]string),
+		},
+		OntdBalances: copyBalances(this.OntdBalance),
+		OntdAllowances: make(map[string]map[string]*big.Int),
+	}
+	for k, v := range this.OnChainFState.TokenHahsToExchangeAddr {
+		snap.Factory.TokenToExchange[k] = v.ToHexString()
+	}
+	for k, v := range this.OnChainFState.ExchangeHashToTokenAddr {
+		snap.Factory.ExchangeToToken[k] = v.ToHexString()
+	}
+	for k, v := range this.OnChainFState.IdToTokenAddr {
+		snap.Factory.IdToToken[k] = v.ToHexString()
+	}
+	for owner, allowances := range this.OntdAllowance {
+		snap.OntdAllowances[owner.ToBase58()] = make(map[string]*big.Int)
+		for spender, allowance := range allowances {
+			snap.OntdAllowances[owner.ToBase58()][spender.ToHexString()] = copyBig(allowance)
+		}
+	}
+	for _, token := range this.OnChainTState {
+		snap.Tokens = append(snap.Tokens, &TokenSnapshot{
+			Address: token.TokenAddr.ToHexString(),
+			Supply: copyBig(token.Supply),
+			Balances: copyBalances(token.Balances),
+			Allowances: copyBalances(token.Allowances),
+		})
+	}
+	for _, exchange := range this.OnChainEState {
+		snap.Exchanges = append(snap.Exchanges, &ExchangeSnapshot{
+			Address: exchange.ExchangeAddr.ToHexString(),
+			Token: exchange.TokenAddr.ToHexString(),
+			Factory: exchange.FactoryAddr.ToHexString(),
+			OntdReserve: copyBig(exchange.OntdLiquid),
+			TokenReserve: copyBig(exchange.TokenLiquid),
+			ShareSupply: copyBig(exchange.ShareSupply),
+			Shares: copyBalances(exchange.ShareBalance),
+		})
+	}
+	return snap
+}
+
+// DiffSince returns what changed in the env since before was taken
+func (this *TestEnv) DiffSince(before *Snapshot) *SnapshotDiff {
+	return Diff(before, this.Snapshot())
+}
+
+func copyBig(v *big.Int) *big.Int {
+	if v == nil {
+		return nil
+	}
+	return new(big.Int).Set(v)
+}
+
+func copyBalances(balances map[common.Address]*big.Int) map[string]*big.Int {
+	copied := make(map[string]*big.Int, len(balances))
+	for addr, balance := range balances {
+		copied[addr.ToBase58()] = copyBig(balance)
+	}
+	return copied
+}
+
+// Save writes the snapshot to path as indented json
+func (this *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Save, json.MarshalIndent error: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("Save, WriteFile: %s error: %v", path, err)
+	}
+	return nil
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadSnapshot, ReadFile: %s error: %v", path, err)
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, fmt.Errorf("LoadSnapshot, json.Unmarshal error: %v", err)
+	}
+	return snap, nil
+}
+
+// FieldChange is one value that differs between two snapshots, a missing value is nil
+type FieldChange struct {
+	// Owner is the account or contract the value belongs to
+	Owner string
+	Field string
+	Before *big.Int
+	After *big.Int
+}
+
+func (this *FieldChange) String() string {
+	change := ""
+	if this.Before != nil && this.After != nil {
+		change = fmt.Sprintf(" (%+d)", new(big.Int).Sub(this.After, this.Before))
+	}
+	return fmt.Sprintf("%s: %s -> %s%s", this.Field, bigString(this.Before), bigString(this.After), change)
+}
+
+// SnapshotDiff is every value that changed between two snapshots, sorted by owner and field
+type SnapshotDiff struct {
+	Changes []*FieldChange
+	// Other lists the changes of addresses and factory mappings, which no operation should make
+	Other []string
+}
+
+func (this *SnapshotDiff) Empty() bool {
+	return len(this.Changes) == 0 && len(this.Other) == 0
+}
+
+// String prints the changes grouped by owner
+func (this *SnapshotDiff) String() string {
+	if this.Empty() {
+		return "no changes"
+	}
+	lines := make([]string, 0)
+	owner := ""
+	for _, change := range this.Changes {
+		if change.Owner != owner {
+			owner = change.Owner
+			lines = append(lines, owner+":")
+		}
+		lines = append(lines, "  "+change.String())
+	}
+	for _, other := range this.Other {
+		lines = append(lines, other)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diff returns what changed from before to after
+func Diff(before, after *Snapshot) *SnapshotDiff {
+	diff := &SnapshotDiff{Changes: make([]*FieldChange, 0), Other: make([]string, 0)}
+	values := func(owner, field string, a, b map[string]*big.Int) {
+		for _, key := range unionKeys(a, b) {
+			diffValue(diff, key, fmt.Sprintf("%s of %s", field, owner), a[key], b[key])
+		}
+	}
+	values("ontd", "balance", before.OntdBalances, after.OntdBalances)
+	owners := make(map[string]*big.Int)
+	for owner := range before.OntdAllowances {
+		owners[owner] = nil
+	}
+	for owner := range after.OntdAllowances {
+		owners[owner] = nil
+	}
+	for _, owner := range unionKeys(owners, nil) {
+		a, b := before.OntdAllowances[owner], after.OntdAllowances[owner]
+		for _, spender := range unionKeys(a, b) {
+			diffValue(diff, owner, fmt.Sprintf("ontd allowance to %s", spender), a[spender], b[spender])
+		}
+	}
+	for i := 0; i < len(before.Tokens) || i < len(after.Tokens); i++ {
+		if i >= len(before.Tokens) || i >= len(after.Tokens) || before.Tokens[i].Address != after.Tokens[i].Address {
+			diff.Other = append(diff.Other, fmt.Sprintf("token %d differs", i))
+			continue
+		}
+		a, b := before.Tokens[i], after.Tokens[i]
+		diffValue(diff, a.Address, "token supply", a.Supply, b.Supply)
+		values(fmt.Sprintf("token %d", i), "balance", a.Balances, b.Balances)
+		values(fmt.Sprintf("token %d", i), "allowance to its exchange", a.Allowances, b.Allowances)
+	}
+	for i := 0; i < len(before.Exchanges) || i < len(after.Exchanges); i++ {
+		if i >= len(before.Exchanges) || i >= len(after.Exchanges) || before.Exchanges[i].Address != after.Exchanges[i].Address {
+			diff.Other = append(diff.Other, fmt.Sprintf("exchange %d differs", i))
+			continue
+		}
+		a, b := before.Exchanges[i], after.Exchanges[i]
+		if a.Token != b.Token || a.Factory != b.Factory {
+			diff.Other = append(diff.Other, fmt.Sprintf("exchange %s, token: %s -> %s, factory: %s -> %s", a.Address, a.Token, b.Token, a.Factory, b.Factory))
+		}
+		diffValue(diff, a.Address, "ontd reserve", a.OntdReserve, b.OntdReserve)
+		diffValue(diff, a.Address, "token reserve", a.TokenReserve, b.TokenReserve)
+		diffValue(diff, a.Address, "share supply", a.ShareSupply, b.ShareSupply)
+		values(fmt.Sprintf("exchange %d", i), "shares", a.Shares, b.Shares)
+	}
+	if fmt.Sprint(before.Factory) != fmt.Sprint(after.Factory) {
+		diff.Other = append(diff.Other, fmt.Sprintf("factory mappings: %+v -> %+v", before.Factory, after.Factory))
+	}
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		if diff.Changes[i].Owner != diff.Changes[j].Owner {
+			return diff.Changes[i].Owner < diff.Changes[j].Owner
+		}
+		return diff.Changes[i].Field < diff.Changes[j].Field
+	})
+	return diff
+}
+
+// diffValue records owner's field when it changed, nil and zero are the same value
+func diffValue(diff *SnapshotDiff, owner, field string, before, after *big.Int) {
+	if bigOrZero(before).Cmp(bigOrZero(after)) == 0 {
+		return
+	}
+	diff.Changes = append(diff.Changes, &FieldChange{Owner: owner, Field: field, Before: before, After: after})
+}
+
+func unionKeys(a, b map[string]*big.Int) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool)
+	for _, m := range []map[string]*big.Int{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
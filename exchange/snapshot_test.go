@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Snapshot(t *testing.T) {
+	if err := testEnv.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+	before := testEnv.Snapshot()
+	if diff := testEnv.DiffSince(before); !diff.Empty() {
+		t.Fatalf("diff without any operation: %s", diff)
+	}
+
+	pool, trader := 1, testEnv.Users[2]
+	if err := testEnv.ensureOntdAllowance(pool, trader, big.NewInt(5000)); err != nil {
+		t.Fatalf("ensureOntdAllowance error: %v", err)
+	}
+	approved := testEnv.Snapshot()
+	if err := testEnv.ontToTokenInput(pool, big.NewInt(5000), big.NewInt(1), trader, trader.Address); err != nil {
+		t.Fatalf("ontToTokenInput error: %v", err)
+	}
+	diff := testEnv.DiffSince(approved)
+	exchange, traderAddr := testEnv.OnChainEState[pool].ExchangeAddr.ToHexString(), trader.Address.ToBase58()
+	fields := make(map[string]*FieldChange)
+	for _, change := range diff.Changes {
+		fields[change.Owner+" "+change.Field] = change
+	}
+	if len(diff.Other) != 0 || len(fields) != 5 {
+		t.Fatalf("diff of a swap:\n%s", diff)
+	}
+	if change := fields[exchange+" ontd reserve"]; change == nil || new(big.Int).Sub(change.After, change.Before).Int64() != 5000 {
+		t.Fatalf("ontd reserve change: %v", change)
+	}
+	if change := fields[traderAddr+" balance of ontd"]; change == nil || new(big.Int).Sub(change.Before, change.After).Int64() != 5000 {
+		t.Fatalf("ontd balance change: %v", change)
+	}
+	for _, key := range []string{exchange + " token reserve", traderAddr + " balance of token 1", traderAddr + " ontd allowance to " + exchange} {
+		if fields[key] == nil {
+			t.Fatalf("%s missing in diff:\n%s", key, diff)
+		}
+	}
+	if !strings.Contains(diff.String(), traderAddr+":\n") || !strings.Contains(diff.String(), "(+5000)") {
+		t.Fatalf("diff print:\n%s", diff)
+	}
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	if err := before.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("LoadSnapshot error: %v", err)
+	}
+	if diff := Diff(before, loaded); !diff.Empty() {
+		t.Fatalf("diff of a saved snapshot: %s", diff)
+	}
+	if diff := Diff(loaded, testEnv.Snapshot()); len(diff.Changes) == 0 {
+		t.Fatalf("no changes since the saved snapshot")
+	}
+}
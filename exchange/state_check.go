@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"github.com/skyinglyh1/uniswap_v1_test/log"
+	"math/big"
+	"strings"
+)
+
+// StateMismatch is one value the chain and the off-chain simulator disagree on
+type StateMismatch struct {
+	Item string
+	OnChain *big.Int
+	OffChain *big.Int
+	// OnChainAddr and OffChainAddr are set instead of the amounts for the factory mappings
+	OnChainAddr string
+	OffChainAddr string
+}
+
+func (this *StateMismatch) String() string {
+	if this.OnChainAddr != "" || this.OffChainAddr != "" {
+		return fmt.Sprintf("%s: onchain %s, offchain %s", this.Item, this.OnChainAddr, this.OffChainAddr)
+	}
+	return fmt.Sprintf("%s: onchain %s, offchain %s", this.Item, bigString(this.OnChain), bigString(this.OffChain))
+}
+
+// StateDiff collects all the mismatches found after one transaction, it is returned as the error of the helper
+type StateDiff struct {
+	Mismatches []*StateMismatch
+}
+
+func (this *StateDiff) Error() string {
+	items := make([]string, 0, len(this.Mismatches))
+	for _, mismatch := range this.Mismatches {
+		items = append(items, mismatch.String())
+	}
+	return fmt.Sprintf("onchain and offchain states differ in %d items: %s", len(this.Mismatches), strings.Join(items, "; "))
+}
+
+func (this *StateDiff) compare(item string, onChain, offChain *big.Int) {
+	if bigOrZero(onChain).Cmp(bigOrZero(offChain)) != 0 {
+		this.Mismatches = append(this.Mismatches, &StateMismatch{Item: item, OnChain: onChain, OffChain: offChain})
+	}
+}
+
+func (this *StateDiff) compareAddress(item string, onChain, offChain common.Address) {
+	if onChain != offChain {
+		this.Mismatches = append(this.Mismatches, &StateMismatch{Item: item, OnChainAddr: onChain.ToHexString(), OffChainAddr: offChain.ToHexString()})
+	}
+}
+
+func bigOrZero(v *big.Int) *big.Int {
+	if v == nil {
+		return big.NewInt(0)
+	}
+	return v
+}
+
+func bigString(v *big.Int) string {
+	if v == nil {
+		return "nil"
+	}
+	return v.String()
+}
+
+// newSimulator seeds an independent off-chain model from the refreshed on-chain state
+func (this *TestEnv) newSimulator() *OffChainSimulator {
+	sim := NewOffChainSimulator(this.OnChainFState.FactoryAddr, this.OntdAddr)
+	for i, estate := range this.OnChainEState {
+		exchange := sim.AddExchange(estate.ExchangeAddr, estate.TokenAddr)
+		exchange.FactoryAddr = estate.FactoryAddr
+		exchange.ShareSupply = new(big.Int).Set(bigOrZero(estate.ShareSupply))
+		for owner, share := range estate.ShareBalance {
+			exchange.ShareBalance[owner] = new(big.Int).Set(bigOrZero(share))
+		}
+		tstate := this.OnChainTState[i]
+		token := sim.Tokens[estate.TokenAddr]
+		token.Balances[estate.ExchangeAddr] = new(big.Int).Set(bigOrZero(estate.TokenLiquid))
+		for owner, balance := range tstate.Balances {
+			token.Balances[owner] = new(big.Int).Set(bigOrZero(balance))
+		}
+		for owner, allowance := range tstate.Allowances {
+			token.Approve(owner, estate.ExchangeAddr, bigOrZero(allowance))
+		}
+		token.Supply = new(big.Int).Set(bigOrZero(tstate.Supply))
+		sim.Ontd.Balances[estate.ExchangeAddr] = new(big.Int).Set(bigOrZero(estate.OntdLiquid))
+	}
+	for owner, balance := range this.OntdBalance {
+		sim.Ontd.Balances[owner] = new(big.Int).Set(bigOrZero(balance))
+	}
+	for owner, spenders := range this.OntdAllowance {
+		for spender, allowance := range spenders {
+			sim.Ontd.Approve(owner, spender, bigOrZero(allowance))
+		}
+	}
+	return sim
+}
+
+// refreshOffChainState copies the simulator ledgers into OffChainTState and OffChainEState, and the mappings of the
+// exchanges it simulates into OffChainFState. The simulator does not number the exchanges, IdToTokenAddr stays empty.
+func (this *TestEnv) refreshOffChainState() {
+	ofs := this.OffChainFState
+	ofs.FactoryAddr = this.Simulator.FactoryAddr
+	for exchangeAddr, exchange := range this.Simulator.Exchanges {
+		ofs.ExchangeHashToTokenAddr[exchangeAddr.ToHexString()] = exchange.TokenAddr
+	}
+	for token, exchange := range this.Simulator.TokenToExchange {
+		ofs.TokenHahsToExchangeAddr[token.ToHexString()] = exchange
+	}
+	for i, estate := range this.OnChainEState {
+		exchange := this.Simulator.Exchanges[estate.ExchangeAddr]
+		token := this.Simulator.Tokens[estate.TokenAddr]
+		oes := this.OffChainEState[i]
+		oes.ExchangeAddr, oes.TokenAddr, oes.FactoryAddr = exchange.ExchangeAddr, exchange.TokenAddr, exchange.FactoryAddr
+		oes.Providers = estate.Providers
+		oes.OntdLiquid = this.Simulator.Ontd.BalanceOf(estate.ExchangeAddr)
+		oes.TokenLiquid = token.BalanceOf(estate.ExchangeAddr)
+		oes.ShareSupply = new(big.Int).Set(exchange.ShareSupply)
+		for owner := range estate.ShareBalance {
+			oes.ShareBalance[owner] = exchange.shareOf(owner)
+		}
+		ots := this.OffChainTState[i]
+		ots.TokenAddr = token.TokenAddr
+		ots.Supply = new(big.Int).Set(token.Supply)
+		for owner := range this.OnChainTState[i].Balances {
+			ots.Balances[owner] = token.BalanceOf(owner)
+		}
+		for owner := range this.OnChainTState[i].Allowances {
+			ots.Allowances[owner] = token.Allowance(owner, estate.ExchangeAddr)
+		}
+	}
+}
+
+// diffStates compares reserves, share supply, share balances, token and ontd balances and allowances, and the factory
+// mappings of the simulated exchanges. The exchanges only found by enumerating the factory are not simulated.
+func (this *TestEnv) diffStates() *StateDiff {
+	diff := &StateDiff{}
+	fstate, ofs := this.OnChainFState, this.OffChainFState
+	diff.compareAddress("factory", fstate.FactoryAddr, ofs.FactoryAddr)
+	for exchange, token := range ofs.ExchangeHashToTokenAddr {
+		diff.compareAddress(fmt.Sprintf("factory token of exchange %s", exchange), fstate.ExchangeHashToTokenAddr[exchange], token)
+	}
+	for token, exchange := range ofs.TokenHahsToExchangeAddr {
+		diff.compareAddress(fmt.Sprintf("factory exchange of token %s", token), fstate.TokenHahsToExchangeAddr[token], exchange)
+	}
+	for i, estate := range this.OnChainEState {
+		oes, ots, tstate := this.OffChainEState[i], this.OffChainTState[i], this.OnChainTState[i]
+		exchange := estate.ExchangeAddr.ToHexString()
+		diff.compare(fmt.Sprintf("exchange %s ontd reserve", exchange), estate.OntdLiquid, oes.OntdLiquid)
+		diff.compare(fmt.Sprintf("exchange %s token reserve", exchange), estate.TokenLiquid, oes.TokenLiquid)
+		diff.compare(fmt.Sprintf("exchange %s share supply", exchange), estate.ShareSupply, oes.ShareSupply)
+		for owner, share := range estate.ShareBalance {
+			diff.compare(fmt.Sprintf("exchange %s share of %s", exchange, owner.ToBase58()), share, oes.ShareBalance[owner])
+		}
+		token := tstate.TokenAddr.ToHexString()
+		diff.compare(fmt.Sprintf("token %s supply", token), tstate.Supply, ots.Supply)
+		for owner, balance := range tstate.Balances {
+			diff.compare(fmt.Sprintf("token %s balance of %s", token, owner.ToBase58()), balance, ots.Balances[owner])
+		}
+		for owner, allowance := range tstate.Allowances {
+			diff.compare(fmt.Sprintf("token %s allowance of %s to %s", token, owner.ToBase58(), exchange), allowance, ots.Allowances[owner])
+		}
+	}
+	for owner, balance := range this.OntdBalance {
+		diff.compare(fmt.Sprintf("ontd balance of %s", owner.ToBase58()), balance, this.Simulator.Ontd.BalanceOf(owner))
+	}
+	for owner, spenders := range this.OntdAllowance {
+		for spender, allowance := range spenders {
+			diff.compare(fmt.Sprintf("ontd allowance of %s to %s", owner.ToBase58(), spender.ToHexString()), allowance, this.Simulator.Ontd.Allowance(owner, spender))
+		}
+	}
+	return diff
+}
+
+// checkStates must run right after refreshAcctBalance, it fails with a *StateDiff when the states disagree
+func (this *TestEnv) checkStates() error {
+	this.refreshOffChainState()
+	if diff := this.diffStates(); len(diff.Mismatches) > 0 {
+		return diff
+	}
+	return nil
+}
+
+// mirrorApprove applies an approve sent on chain to the off-chain ledger of token
+func (this *TestEnv) mirrorApprove(tokenAddr, owner, spender common.Address, amount *big.Int) {
+	token := this.Simulator.Ontd
+	if tokenAddr != this.OntdAddr {
+		token = this.Simulator.Tokens[tokenAddr]
+	}
+	token.Approve(owner, spender, amount)
+}
+
+// mirrorResult logs the off-chain outcome, a disagreement with the chain shows up in checkStates
+func mirrorResult(method string, err error) {
+	if err != nil {
+		log.Debugf("%s, offchain failed: %v", method, err)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func newStateCheckEnv() *TestEnv {
+	user, exchangeAddr, tokenAddr := simAddr(1), simAddr(0xe1), simAddr(0xa1)
+	ots, oes := newTokenState(tokenAddr), newExchangeState(exchangeAddr)
+	ots.Balances[user], ots.Allowances[user], ots.Supply = big.NewInt(1e12), big.NewInt(1e12), big.NewInt(1e12)
+	oes.TokenAddr, oes.FactoryAddr = tokenAddr, simAddr(0xf0)
+	oes.OntdLiquid, oes.TokenLiquid, oes.ShareSupply = big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	oes.ShareBalance[user] = big.NewInt(0)
+	env := &TestEnv{
+		OntdAddr:       simAddr(0xf1),
+		OnChainFState:  newFactoryState(simAddr(0xf0)),
+		OffChainFState: newFactoryState(simAddr(0xf0)),
+		OnChainTState:  []*OnChainTokenState{ots},
+		OnChainEState:  []*OnChainExchangeState{oes},
+		OffChainTState: []*OnChainTokenState{newTokenState(tokenAddr)},
+		OffChainEState: []*OnChainExchangeState{newExchangeState(exchangeAddr)},
+		OntdBalance:    map[common.Address]*big.Int{user: big.NewInt(1e13)},
+		OntdAllowance:  map[common.Address]map[common.Address]*big.Int{user: {exchangeAddr: big.NewInt(1e13)}},
+	}
+	env.OnChainFState.ExchangeHashToTokenAddr[exchangeAddr.ToHexString()] = tokenAddr
+	env.OnChainFState.TokenHahsToExchangeAddr[tokenAddr.ToHexString()] = exchangeAddr
+	env.Simulator = env.newSimulator()
+	return env
+}
+
+func Test_CheckStates(t *testing.T) {
+	env := newStateCheckEnv()
+	if err := env.checkStates(); err != nil {
+		t.Fatalf("seeded states differ: %v", err)
+	}
+
+	user, exchangeAddr := simAddr(1), simAddr(0xe1)
+	if _, err := env.Simulator.AddLiquidity(exchangeAddr, big.NewInt(0), big.NewInt(2e9), env.Simulator.Now()+60, user, big.NewInt(1e9)); err != nil {
+		t.Fatalf("AddLiquidity error: %v", err)
+	}
+	// the chain only moved the ontd, the tokens, shares and allowances must be reported
+	env.OntdBalance[user] = big.NewInt(1e13 - 1e9)
+	env.OntdAllowance[user][exchangeAddr] = big.NewInt(1e13 - 1e9)
+	env.OnChainEState[0].OntdLiquid = big.NewInt(1e9)
+	err := env.checkStates()
+	diff, ok := err.(*StateDiff)
+	if !ok {
+		t.Fatalf("expect *StateDiff, got %v", err)
+	}
+	// token reserve, share supply, share balance, token balance and token allowance
+	if len(diff.Mismatches) != 5 {
+		t.Fatalf("expect 5 mismatches, got %v", diff)
+	}
+	if env.OffChainEState[0].ShareBalance[user].Cmp(big.NewInt(1e9)) != 0 {
+		t.Fatalf("offchain share balance not refreshed: %s", env.OffChainEState[0].ShareBalance[user])
+	}
+
+	// the factory state is the simulator's own, a mapping it changes is reported
+	tokenAddr := simAddr(0xa1)
+	env.Simulator.TokenToExchange[tokenAddr] = simAddr(0xe2)
+	diff, ok = env.checkStates().(*StateDiff)
+	if !ok || len(diff.Mismatches) != 6 || !strings.Contains(diff.Error(), "factory exchange of token "+tokenAddr.ToHexString()) {
+		t.Fatalf("expect the factory mapping among 6 mismatches, got %v", diff)
+	}
+	if env.OnChainFState == env.OffChainFState {
+		t.Fatalf("onchain and offchain factory states are one object")
+	}
+}
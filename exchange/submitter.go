@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
+	"github.com/ontio/ontology/common"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TxRequest is one invocation for the Submitter, Params are what InvokeNeoVMContract takes
+type TxRequest struct {
+	Signer *ontology_go_sdk.Account
+	Contract common.Address
+	Params []interface{}
+}
+
+// SubmitResult is the outcome of one TxRequest, Err is set when it was not sent or not confirmed in time
+type SubmitResult struct {
+	Request *TxRequest
+	TxHash common.Uint256
+	Result *TxResult
+	// Latency is the time from sending the transaction to seeing it executed
+	Latency time.Duration
+	Err error
+}
+
+// SubmitReport sums up the results of one Submit
+type SubmitReport struct {
+	Sent int
+	Succeeded int
+	Failed int
+	Errors int
+	Elapsed time.Duration
+	// Throughput is the executed transactions per second over Elapsed
+	Throughput float64
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+func (this *SubmitReport) String() string {
+	return fmt.Sprintf("sent: %d, succeeded: %d, failed: %d, errors: %d, elapsed: %v, throughput: %.2f tx/s, latency p50: %v, p90: %v, p99: %v, max: %v",
+		this.Sent, this.Succeeded, this.Failed, this.Errors, this.Elapsed, this.Throughput, this.P50, this.P90, this.P99, this.Max)
+}
+
+// Submitter keeps many transactions in flight instead of waiting for each one before sending the next.
+// Ontology transactions carry a random nonce rather than a per account sequence, so the transactions of
+// one account need no ordering and only the number in flight is bounded.
+type Submitter struct {
+	Client Client
+	Waiter *TxWaiter
+	GasPrice uint64
+	GasLimit uint64
+	// MaxInFlight bounds the transactions sent and not yet executed over all accounts
+	MaxInFlight int
+	// MaxInFlightPerAccount bounds them for each signer
+	MaxInFlightPerAccount int
+}
+
+func NewSubmitter(client Client, waiter *TxWaiter, gasPrice, gasLimit uint64, maxInFlight, maxInFlightPerAccount int) *Submitter {
+	return &Submitter{
+		Client: client,
+		Waiter: waiter,
+		GasPrice: gasPrice,
+		GasLimit: gasLimit,
+		MaxInFlight: maxInFlight,
+		MaxInFlightPerAccount: maxInFlightPerAccount,
+	}
+}
+
+// NewSubmitter returns a Submitter with the client, waiter and gas settings of the env.
+// It does not mirror anything into the Simulator, callers that check states afterwards have to.
+func (this *TestEnv) NewSubmitter(maxInFlight, maxInFlightPerAccount int) *Submitter {
+	return NewSubmitter(this.Client, this.Waiter, this.GasPrice, this.GasLimit, maxInFlight, maxInFlightPerAccount)
+}
+
+// Submit sends all requests, waits for every one of them and returns their results in the order of requests
+func (this *Submitter) Submit(requests []*TxRequest) ([]*SubmitResult, *SubmitReport) {
+	results := make([]*SubmitResult, len(requests))
+	inFlight := make(chan struct{}, positive(this.MaxInFlight))
+	perAccount := make(map[common.Address]chan struct{})
+	for _, req := range requests {
+		if _, ok := perAccount[req.Signer.Address]; !ok {
+			perAccount[req.Signer.Address] = make(chan struct{}, positive(this.MaxInFlightPerAccount))
+		}
+	}
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i, req := range requests {
+		// the account slot is taken first so that a busy account does not hold slots the others could use
+		accountSlot := perAccount[req.Signer.Address]
+		accountSlot <- struct{}{}
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func(i int, req *TxRequest) {
+			defer func() {
+				<-inFlight
+				<-accountSlot
+				wg.Done()
+			}()
+			results[i] = this.submit(req)
+		}(i, req)
+	}
+	wg.Wait()
+	return results, newSubmitReport(results, time.Since(start))
+}
+
+func (this *Submitter) submit(req *TxRequest) *SubmitResult {
+	result := &SubmitResult{Request: req}
+	txHash, err := this.Client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, req.Signer, req.Signer, req.Contract, req.Params)
+	if err != nil {
+		result.Err = fmt.Errorf("submit, signer: %s, contract: %s, invoke err: %v", req.Signer.Address.ToBase58(), req.Contract.ToHexString(), err)
+		return result
+	}
+	sent := time.Now()
+	result.TxHash = txHash
+	result.Result, result.Err = this.Waiter.Wait(txHash)
+	result.Latency = time.Since(sent)
+	return result
+}
+
+func newSubmitReport(results []*SubmitResult, elapsed time.Duration) *SubmitReport {
+	report := &SubmitReport{Elapsed: elapsed}
+	latencies := make([]time.Duration, 0, len(results))
+	for _, result := range results {
+		if result.TxHash != common.UINT256_EMPTY {
+			report.Sent++
+		}
+		switch {
+		case result.Err != nil:
+			report.Errors++
+			continue
+		case result.Result.Status == TX_SUCCEEDED:
+			report.Succeeded++
+		default:
+			report.Failed++
+		}
+		latencies = append(latencies, result.Latency)
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Succeeded+report.Failed) / elapsed.Seconds()
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.P50 = percentile(latencies, 50)
+	report.P90 = percentile(latencies, 90)
+	report.P99 = percentile(latencies, 99)
+	if len(latencies) > 0 {
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report
+}
+
+// percentile returns the nearest-rank p-th percentile of the sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func positive(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
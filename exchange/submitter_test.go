@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_Percentile(t *testing.T) {
+	sorted := make([]time.Duration, 0)
+	for i := 1; i <= 10; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	if p := percentile(sorted, 50); p != 5 {
+		t.Fatalf("p50: %v", p)
+	}
+	if p := percentile(sorted, 90); p != 9 {
+		t.Fatalf("p90: %v", p)
+	}
+	if p := percentile(sorted, 99); p != 10 {
+		t.Fatalf("p99: %v", p)
+	}
+	if p := percentile(nil, 50); p != 0 {
+		t.Fatalf("p50 of nothing: %v", p)
+	}
+}
+
+func Test_Submitter(t *testing.T) {
+	token, spender := testEnv.OnChainTState[2].TokenAddr, mockAddr("submitter spender")
+	amount := big.NewInt(4321)
+	requests := make([]*TxRequest, 0)
+	for round := 0; round < 4; round++ {
+		for _, user := range testEnv.Users {
+			requests = append(requests, &TxRequest{Signer: user, Contract: token, Params: []interface{}{"approve", []interface{}{user.Address, spender, amount}}})
+		}
+	}
+	// Users[1] never approved Users[1] itself to move its tokens
+	failing := &TxRequest{Signer: testEnv.Users[1], Contract: token, Params: []interface{}{"transferFrom", []interface{}{testEnv.Users[1].Address, testEnv.Users[0].Address, testEnv.Users[1].Address, big.NewInt(1)}}}
+	requests = append(requests, failing)
+
+	results, report := testEnv.NewSubmitter(6, 3).Submit(requests)
+	for _, user := range testEnv.Users {
+		testEnv.mirrorApprove(token, user.Address, spender, amount)
+	}
+	if len(results) != len(requests) {
+		t.Fatalf("%d results for %d requests", len(results), len(requests))
+	}
+	for i, result := range results {
+		if result.Request != requests[i] || result.Err != nil {
+			t.Fatalf("result %d: %+v", i, result)
+		}
+	}
+	if results[len(results)-1].Result.Status != TX_FAILED {
+		t.Fatalf("transferFrom without allowance: %+v", results[len(results)-1].Result)
+	}
+	if report.Sent != len(requests) || report.Succeeded != len(requests)-1 || report.Failed != 1 || report.Errors != 0 {
+		t.Fatalf("report: %s", report)
+	}
+	if report.P50 <= 0 || report.P50 > report.P90 || report.P90 > report.P99 || report.P99 > report.Max || report.Throughput <= 0 {
+		t.Fatalf("report: %s", report)
+	}
+	t.Logf("submitter report: %s", report)
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"strings"
+)
+
+// SwapMismatch is one post-condition of a swap or liquidity change the chain does not meet
+type SwapMismatch struct {
+	Item string
+	Expected *big.Int
+	Actual *big.Int
+}
+
+func (this *SwapMismatch) String() string {
+	return fmt.Sprintf("%s: expected %s, actual %s", this.Item, bigString(this.Expected), bigString(this.Actual))
+}
+
+// SwapMismatchError lists every post-condition of one swap or liquidity change that does not hold
+type SwapMismatchError struct {
+	Method string
+	Mismatches []*SwapMismatch
+}
+
+func (this *SwapMismatchError) Error() string {
+	items := make([]string, 0, len(this.Mismatches))
+	for _, mismatch := range this.Mismatches {
+		items = append(items, mismatch.String())
+	}
+	return fmt.Sprintf("%s, %d post-conditions do not hold: %s", this.Method, len(this.Mismatches), strings.Join(items, "; "))
+}
+
+// swapCheck records the values a swap changes before it is sent, with the exact change it must make to each of them
+type swapCheck struct {
+	method string
+	items []string
+	values map[string]func() *big.Int
+	before map[string]*big.Int
+	deltas map[string]*big.Int
+	// fees are paid whether the swap executed or not
+	fees map[string]*big.Int
+}
+
+func newSwapCheck(method string) *swapCheck {
+	return &swapCheck{
+		method: method,
+		values: make(map[string]func() *big.Int),
+		before: make(map[string]*big.Int),
+		deltas: make(map[string]*big.Int),
+		fees: make(map[string]*big.Int),
+	}
+}
+
+// expect reads the current value of item, the changes of an item expected twice add up
+func (this *swapCheck) expect(item string, value func() *big.Int, delta *big.Int) {
+	if _, ok := this.deltas[item]; !ok {
+		this.items = append(this.items, item)
+		this.values[item] = value
+		this.before[item] = new(big.Int).Set(bigOrZero(value()))
+		this.deltas[item] = new(big.Int)
+	}
+	this.deltas[item].Add(this.deltas[item], bigOrZero(delta))
+}
+
+// charge expects fee to be paid out of item even when the swap is not executed
+func (this *swapCheck) charge(item string, value func() *big.Int, fee *big.Int) {
+	this.expect(item, value, nil)
+	if _, ok := this.fees[item]; !ok {
+		this.fees[item] = new(big.Int)
+	}
+	this.fees[item].Add(this.fees[item], fee)
+}
+
+// verify compares the refreshed values with the expected ones, nothing may change when the swap was not executed
+func (this *swapCheck) verify(executed bool) error {
+	mismatches := make([]*SwapMismatch, 0)
+	for _, item := range this.items {
+		expected := new(big.Int).Set(this.before[item])
+		if executed {
+			expected.Add(expected, this.deltas[item])
+		}
+		if fee, ok := this.fees[item]; ok {
+			expected.Sub(expected, fee)
+		}
+		if actual := bigOrZero(this.values[item]()); actual.Cmp(expected) != 0 {
+			mismatches = append(mismatches, &SwapMismatch{Item: item, Expected: expected, Actual: new(big.Int).Set(actual)})
+		}
+	}
+	if len(mismatches) > 0 {
+		return &SwapMismatchError{Method: this.method, Mismatches: mismatches}
+	}
+	return nil
+}
+
+func (this *TestEnv) expectOntdReserve(check *swapCheck, pool int, delta *big.Int) {
+	check.expect(fmt.Sprintf("ontd reserve of exchange %d", pool), func() *big.Int {
+		return this.OnChainEState[pool].OntdLiquid
+	}, delta)
+}
+
+func (this *TestEnv) expectTokenReserve(check *swapCheck, pool int, delta *big.Int) {
+	check.expect(fmt.Sprintf("token reserve of exchange %d", pool), func() *big.Int {
+		return this.OnChainEState[pool].TokenLiquid
+	}, delta)
+}
+
+func (this *TestEnv) expectShareSupply(check *swapCheck, pool int, delta *big.Int) {
+	check.expect(fmt.Sprintf("share supply of exchange %d", pool), func() *big.Int {
+		return this.OnChainEState[pool].ShareSupply
+	}, delta)
+}
+
+func (this *TestEnv) expectShareBalance(check *swapCheck, pool int, owner common.Address, delta *big.Int) {
+	check.expect(fmt.Sprintf("share balance of %s in exchange %d", owner.ToBase58(), pool), func() *big.Int {
+		return this.OnChainEState[pool].ShareBalance[owner]
+	}, delta)
+}
+
+func (this *TestEnv) expectOntdBalance(check *swapCheck, owner common.Address, delta *big.Int) {
+	check.expect(fmt.Sprintf("ontd balance of %s", owner.ToBase58()), func() *big.Int {
+		return this.OntdBalance[owner]
+	}, delta)
+}
+
+func (this *TestEnv) expectTokenBalance(check *swapCheck, pool int, owner common.Address, delta *big.Int) {
+	check.expect(fmt.Sprintf("token %d balance of %s", pool, owner.ToBase58()), func() *big.Int {
+		return this.OnChainTState[pool].Balances[owner]
+	}, delta)
+}
+
+func (this *TestEnv) expectOntdAllowance(check *swapCheck, pool int, owner common.Address, delta *big.Int) {
+	exchangeAddr := this.OnChainEState[pool].ExchangeAddr
+	check.expect(fmt.Sprintf("ontd allowance of %s to exchange %d", owner.ToBase58(), pool), func() *big.Int {
+		return this.OntdAllowance[owner][exchangeAddr]
+	}, delta)
+}
+
+func (this *TestEnv) expectTokenAllowance(check *swapCheck, pool int, owner common.Address, delta *big.Int) {
+	check.expect(fmt.Sprintf("token %d allowance of %s to exchange %d", pool, owner.ToBase58(), pool), func() *big.Int {
+		return this.OnChainTState[pool].Allowances[owner]
+	}, delta)
+}
+
+// expectOntToToken expects invoker to pay ontdSold into pool and recipient to receive tokensBought from it
+func (this *TestEnv) expectOntToToken(check *swapCheck, pool int, invoker, recipient common.Address, ontdSold, tokensBought *big.Int) {
+	this.expectOntdReserve(check, pool, ontdSold)
+	this.expectTokenReserve(check, pool, new(big.Int).Neg(bigOrZero(tokensBought)))
+	this.expectOntdBalance(check, invoker, new(big.Int).Neg(bigOrZero(ontdSold)))
+	this.expectOntdAllowance(check, pool, invoker, new(big.Int).Neg(bigOrZero(ontdSold)))
+	this.expectTokenBalance(check, pool, recipient, tokensBought)
+}
+
+// expectTokenToOnt expects invoker to pay tokensSold into pool and recipient to receive ontdBought from it
+func (this *TestEnv) expectTokenToOnt(check *swapCheck, pool int, invoker, recipient common.Address, tokensSold, ontdBought *big.Int) {
+	this.expectTokenReserve(check, pool, tokensSold)
+	this.expectOntdReserve(check, pool, new(big.Int).Neg(bigOrZero(ontdBought)))
+	this.expectTokenBalance(check, pool, invoker, new(big.Int).Neg(bigOrZero(tokensSold)))
+	this.expectTokenAllowance(check, pool, invoker, new(big.Int).Neg(bigOrZero(tokensSold)))
+	this.expectOntdBalance(check, recipient, ontdBought)
+}
+
+// expectTokenToToken expects the ontdBought of tokensSold on pool to buy tokensBought on pool bought for recipient
+func (this *TestEnv) expectTokenToToken(check *swapCheck, pool, bought int, invoker, recipient common.Address, tokensSold, ontdBought, tokensBought *big.Int) {
+	this.expectTokenReserve(check, pool, tokensSold)
+	this.expectOntdReserve(check, pool, new(big.Int).Neg(bigOrZero(ontdBought)))
+	this.expectOntdReserve(check, bought, ontdBought)
+	this.expectTokenReserve(check, bought, new(big.Int).Neg(bigOrZero(tokensBought)))
+	this.expectTokenBalance(check, pool, invoker, new(big.Int).Neg(bigOrZero(tokensSold)))
+	this.expectTokenAllowance(check, pool, invoker, new(big.Int).Neg(bigOrZero(tokensSold)))
+	this.expectTokenBalance(check, bought, recipient, tokensBought)
+}
+
+// liquidityMinted returns the shares minted and the tokens pulled for a deposit of ontdAmt,
+// the first deposit sets the price with maxTokens and mints one share per ontd
+func liquidityMinted(ontdAmt, maxTokens, ontdReserve, tokenReserve, shareSupply *big.Int) (*big.Int, *big.Int) {
+	if bigOrZero(shareSupply).Sign() <= 0 || bigOrZero(ontdReserve).Sign() <= 0 {
+		return new(big.Int).Set(ontdAmt), new(big.Int).Set(maxTokens)
+	}
+	tokenAmt := new(big.Int).Add(new(big.Int).Div(new(big.Int).Mul(ontdAmt, bigOrZero(tokenReserve)), ontdReserve), big.NewInt(1))
+	minted := new(big.Int).Div(new(big.Int).Mul(ontdAmt, shareSupply), ontdReserve)
+	return minted, tokenAmt
+}
+
+// liquidityRedeemed returns the ontd and tokens paid back for burning amount shares
+func liquidityRedeemed(amount, ontdReserve, tokenReserve, shareSupply *big.Int) (*big.Int, *big.Int) {
+	if bigOrZero(shareSupply).Sign() <= 0 {
+		return new(big.Int), new(big.Int)
+	}
+	ontdAmt := new(big.Int).Div(new(big.Int).Mul(amount, bigOrZero(ontdReserve)), shareSupply)
+	tokenAmt := new(big.Int).Div(new(big.Int).Mul(amount, bigOrZero(tokenReserve)), shareSupply)
+	return ontdAmt, tokenAmt
+}
+
+// expectAddLiquidity expects provider to deposit ontdAmt and tokenAmt into pool for minted shares
+func (this *TestEnv) expectAddLiquidity(check *swapCheck, pool int, provider common.Address, ontdAmt, tokenAmt, minted *big.Int) {
+	this.expectOntdReserve(check, pool, ontdAmt)
+	this.expectTokenReserve(check, pool, tokenAmt)
+	this.expectShareSupply(check, pool, minted)
+	this.expectShareBalance(check, pool, provider, minted)
+	this.expectOntdBalance(check, provider, new(big.Int).Neg(ontdAmt))
+	this.expectOntdAllowance(check, pool, provider, new(big.Int).Neg(ontdAmt))
+	this.expectTokenBalance(check, pool, provider, new(big.Int).Neg(tokenAmt))
+	this.expectTokenAllowance(check, pool, provider, new(big.Int).Neg(tokenAmt))
+}
+
+// expectRemoveLiquidity expects withdrawer to burn amount shares of pool for ontdAmt and tokenAmt
+func (this *TestEnv) expectRemoveLiquidity(check *swapCheck, pool int, withdrawer common.Address, amount, ontdAmt, tokenAmt *big.Int) {
+	this.expectShareSupply(check, pool, new(big.Int).Neg(amount))
+	this.expectShareBalance(check, pool, withdrawer, new(big.Int).Neg(amount))
+	this.expectOntdReserve(check, pool, new(big.Int).Neg(ontdAmt))
+	this.expectTokenReserve(check, pool, new(big.Int).Neg(tokenAmt))
+	this.expectOntdBalance(check, withdrawer, ontdAmt)
+	this.expectTokenBalance(check, pool, withdrawer, tokenAmt)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func Test_SwapCheckVerify(t *testing.T) {
+	a, b := big.NewInt(100), big.NewInt(50)
+	check := newSwapCheck("swap")
+	check.expect("a", func() *big.Int { return a }, big.NewInt(10))
+	check.expect("a", func() *big.Int { return a }, big.NewInt(-3))
+	check.expect("b", func() *big.Int { return b }, big.NewInt(-5))
+	if err := check.verify(false); err != nil {
+		t.Fatalf("unchanged values rejected when not executed: %v", err)
+	}
+	a, b = big.NewInt(107), big.NewInt(45)
+	if err := check.verify(true); err != nil {
+		t.Fatalf("exact changes rejected: %v", err)
+	}
+	b = big.NewInt(46)
+	err := check.verify(true)
+	mismatchErr, ok := err.(*SwapMismatchError)
+	if !ok || len(mismatchErr.Mismatches) != 1 || mismatchErr.Mismatches[0].Item != "b" {
+		t.Fatalf("expected one mismatch on b, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "b: expected 45, actual 46") {
+		t.Fatalf("mismatch not listed: %v", err)
+	}
+	if err := check.verify(false); err == nil {
+		t.Fatalf("changed values accepted when not executed")
+	}
+}
+
+func Test_SwapCheckRejected(t *testing.T) {
+	if err := testEnv.refreshAcctBalance(); err != nil {
+		t.Fatalf("refreshAcctBalance error: %v", err)
+	}
+	trader := testEnv.Users[1]
+	ontd := new(big.Int).Set(testEnv.OnChainEState[0].OntdLiquid)
+	// asks for more tokens than the pool holds, the swap fails on chain and every value must stay as it was
+	minTokens := new(big.Int).Add(testEnv.OnChainEState[0].TokenLiquid, big.NewInt(1))
+	err := testEnv.ontToTokenInput(0, big.NewInt(1000), minTokens, trader, trader.Address)
+	if _, ok := err.(*ExecutionFailedError); !ok {
+		t.Fatalf("ontToTokenInput error: %v, expect an ExecutionFailedError", err)
+	}
+	if testEnv.OnChainEState[0].OntdLiquid.Cmp(ontd) != 0 {
+		t.Fatalf("ontd reserve changed by a rejected swap: %v -> %v", ontd, testEnv.OnChainEState[0].OntdLiquid)
+	}
+}
+
+func Test_LiquidityMinted(t *testing.T) {
+	minted, tokenAmt := liquidityMinted(big.NewInt(1000), big.NewInt(5000), big.NewInt(0), big.NewInt(0), big.NewInt(0))
+	if minted.Int64() != 1000 || tokenAmt.Int64() != 5000 {
+		t.Fatalf("first deposit: minted %v, tokens %v", minted, tokenAmt)
+	}
+	minted, tokenAmt = liquidityMinted(big.NewInt(1000), big.NewInt(5000), big.NewInt(3000), big.NewInt(6000), big.NewInt(1500))
+	if minted.Int64() != 500 || tokenAmt.Int64() != 2001 {
+		t.Fatalf("proportional deposit: minted %v, tokens %v", minted, tokenAmt)
+	}
+	ontdAmt, tokenAmt := liquidityRedeemed(big.NewInt(500), big.NewInt(4000), big.NewInt(8001), big.NewInt(2000))
+	if ontdAmt.Int64() != 1000 || tokenAmt.Int64() != 2000 {
+		t.Fatalf("redemption: ontd %v, tokens %v", ontdAmt, tokenAmt)
+	}
+}
+
+func Test_LiquidityRoundTrip(t *testing.T) {
+	provider := testEnv.OnChainEState[0].Providers[0]
+	if err := testEnv.addLiquid(0, big.NewInt(1), big.NewInt(1000000), big.NewInt(100000)); err != nil {
+		t.Fatalf("addLiquid error: %v", err)
+	}
+	share := new(big.Int).Set(testEnv.OnChainEState[0].ShareBalance[provider.Address])
+	if err := testEnv.removeLiquid(0, big.NewInt(50000), big.NewInt(1), big.NewInt(1), provider); err != nil {
+		t.Fatalf("removeLiquid error: %v", err)
+	}
+	if new(big.Int).Sub(share, testEnv.OnChainEState[0].ShareBalance[provider.Address]).Int64() != 50000 {
+		t.Fatalf("share balance: %v -> %v", share, testEnv.OnChainEState[0].ShareBalance[provider.Address])
+	}
+	// the minimums are above what the shares redeem, nothing may change
+	if err := testEnv.removeLiquid(0, big.NewInt(1000), testEnv.OnChainEState[0].OntdLiquid, big.NewInt(1), provider); err == nil {
+		t.Fatalf("removeLiquid with an unreachable minimum succeeds")
+	} else if _, ok := err.(*ExecutionFailedError); !ok {
+		t.Fatalf("removeLiquid with an unreachable minimum error: %v", err)
+	}
+}
+
+func Test_RevertedRollsBackMirror(t *testing.T) {
+	owner := testEnv.Users[1].Address
+	balance := new(big.Int).Set(testEnv.Simulator.Ontd.BalanceOf(owner))
+	// the simulator accepts what the chain rejected, its changes must not survive
+	mirror := func() error {
+		testEnv.Simulator.Ontd.Mint(owner, big.NewInt(1000))
+		return nil
+	}
+	result := &TxResult{Status: TX_FAILED}
+	err := testEnv.reverted("ontToTokenInput", result, testEnv.OnChainEState[0].ExchangeAddr, "ontToTokenSwapInput", mirror, 0)
+	if _, ok := err.(*ExecutionFailedError); !ok {
+		t.Fatalf("reverted error: %v, expect an ExecutionFailedError", err)
+	}
+	if testEnv.Simulator.Ontd.BalanceOf(owner).Cmp(balance) != 0 {
+		t.Fatalf("mirror of a failed transaction kept: %v -> %v", balance, testEnv.Simulator.Ontd.BalanceOf(owner))
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"fmt"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
+	"time"
+)
+
+// TxStatus is how far a sent transaction has come on chain
+type TxStatus int
+
+const (
+	TX_PENDING TxStatus = iota
+	TX_FAILED
+	TX_SUCCEEDED
+)
+
+const (
+	TX_POLL_MIN_INTERVAL = 100 * time.Millisecond
+	TX_POLL_MAX_INTERVAL = 2 * time.Second
+)
+
+func (this TxStatus) String() string {
+	switch this {
+	case TX_PENDING:
+		return "pending"
+	case TX_FAILED:
+		return "failed"
+	case TX_SUCCEEDED:
+		return "succeeded"
+	}
+	return fmt.Sprintf("TxStatus(%d)", int(this))
+}
+
+// TxResult is what the node reports about one transaction, Height and the event fields are set once it is in a block
+type TxResult struct {
+	TxHash common.Uint256
+	Status TxStatus
+	Height uint32
+	GasConsumed uint64
+	Notify []*sdkcommon.NotifyEventInfo
+}
+
+// Events decodes the exchange and OEP-4 events in Notify
+func (this *TxResult) Events() ([]Event, error) {
+	return DecodeEvents(this.Notify)
+}
+
+// TxWaiter polls the node for the event of a transaction until it is executed in a block
+type TxWaiter struct {
+	Client Client
+	Timeout time.Duration
+	// the poll interval starts at MinInterval and doubles up to MaxInterval
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+func NewTxWaiter(client Client, timeout time.Duration) *TxWaiter {
+	return &TxWaiter{
+		Client: client,
+		Timeout: timeout,
+		MinInterval: TX_POLL_MIN_INTERVAL,
+		MaxInterval: TX_POLL_MAX_INTERVAL,
+	}
+}
+
+// Status asks the node once, a transaction without event is not in a block yet
+func (this *TxWaiter) Status(txHash common.Uint256) (*TxResult, error) {
+	hash := txHash.ToHexString()
+	result := &TxResult{TxHash: txHash, Status: TX_PENDING}
+	evts, err := this.Client.GetSmartContractEvent(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Status, GetSmartContractEvent of tx: %s err: %v", hash, err)
+	}
+	if evts == nil {
+		return result, nil
+	}
+	height, err := this.Client.GetBlockHeightByTxHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("Status, GetBlockHeightByTxHash of tx: %s err: %v", hash, err)
+	}
+	result.Height = height
+	result.GasConsumed = evts.GasConsumed
+	result.Notify = evts.Notify
+	if evts.State == 1 {
+		result.Status = TX_SUCCEEDED
+	} else {
+		result.Status = TX_FAILED
+	}
+	return result, nil
+}
+
+// Wait polls the status of txHash with backoff until it is executed, a failed execution is returned as a result
+// with TX_FAILED, only a transaction still pending after Timeout is an error
+func (this *TxWaiter) Wait(txHash common.Uint256) (*TxResult, error) {
+	deadline := time.Now().Add(this.Timeout)
+	interval := this.MinInterval
+	for {
+		result, err := this.Status(txHash)
+		if err != nil {
+			return nil, fmt.Errorf("Wait, %v", err)
+		}
+		if result.Status != TX_PENDING {
+			return result, nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("Wait, tx: %s not in a block after %v", txHash.ToHexString(), this.Timeout)
+		}
+		if interval < remaining {
+			time.Sleep(interval)
+		} else {
+			time.Sleep(remaining)
+		}
+		if interval *= 2; interval > this.MaxInterval {
+			interval = this.MaxInterval
+		}
+	}
+}
+
+// printTxResult logs the result of a transaction like utils.PrintSmartEventByHash_Ont
+func printTxResult(result *TxResult) {
+	fmt.Printf("TxHash:%s\n", result.TxHash.ToHexString())
+	fmt.Printf("Height:%d, Status:%s, GasConsumed:%d\n", result.Height, result.Status, result.GasConsumed)
+	for _, notify := range result.Notify {
+		if event, err := DecodeEvent(notify); err == nil && event != nil {
+			fmt.Printf("Event:%s\n", event)
+			continue
+		}
+		fmt.Printf("ContractAddress:%s\n", notify.ContractAddress)
+		fmt.Printf("States:%+v\n", notify.States)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package exchange
+
+import (
+	"github.com/ontio/ontology/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func Test_TxWaiter(t *testing.T) {
+	client, owner := testEnv.Client, testEnv.Users[1]
+	token := testEnv.OnChainTState[0].TokenAddr
+
+	txHash, err := client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, owner, owner, token, []interface{}{"approve", []interface{}{owner.Address, testEnv.Users[2].Address, big.NewInt(1)}})
+	if err != nil {
+		t.Fatalf("approve error: %v", err)
+	}
+	result, err := testEnv.Waiter.Wait(txHash)
+	if err != nil {
+		t.Fatalf("Wait approve error: %v", err)
+	}
+	if result.Status != TX_SUCCEEDED || result.Height == 0 || result.GasConsumed == 0 || len(result.Notify) == 0 {
+		t.Fatalf("approve result: %+v", result)
+	}
+
+	// transferFrom more than any allowance the owner ever gave
+	txHash, err = client.InvokeNeoVMContract(testEnv.GasPrice, testEnv.GasLimit, owner, owner, token, []interface{}{"transferFrom", []interface{}{owner.Address, testEnv.Users[0].Address, owner.Address, big.NewInt(1e18)}})
+	if err != nil {
+		t.Fatalf("transferFrom error: %v", err)
+	}
+	result, err = testEnv.Waiter.Wait(txHash)
+	if err != nil {
+		t.Fatalf("Wait transferFrom error: %v", err)
+	}
+	if result.Status != TX_FAILED {
+		t.Fatalf("transferFrom result: %+v", result)
+	}
+
+	unknown := common.Uint256{1, 2, 3}
+	if result, err := testEnv.Waiter.Status(unknown); err != nil || result.Status != TX_PENDING {
+		t.Fatalf("status of a tx never sent: %+v, err: %v", result, err)
+	}
+	waiter := NewTxWaiter(client, 300*time.Millisecond)
+	if _, err := waiter.Wait(unknown); err == nil {
+		t.Fatalf("Wait returns for a tx never sent")
+	}
+}
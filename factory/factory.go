@@ -1,11 +1,140 @@
 package factory
+
 import (
+	"fmt"
 	sdk "github.com/ontio/ontology-go-sdk"
+	sdkcommon "github.com/ontio/ontology-go-sdk/common"
+	"github.com/ontio/ontology/common"
 )
 
+// Client is the part of the node client the factory needs, exchange.Client satisfies it
+type Client interface {
+	InvokeNeoVMContract(gasPrice, gasLimit uint64, payer, signer *sdk.Account, contractAddr common.Address, params []interface{}) (common.Uint256, error)
+	PreExecInvokeNeoVMContract(contractAddr common.Address, params []interface{}) (*sdkcommon.PreExecResult, error)
+}
+
+// UniswapFactory calls the methods of uniswap_factory.py deployed at FactoryAddr.
+// Addresses are passed to the factory in hex order, the way it stores them.
 type UniswapFactory struct {
-	ontSdk *sdk.OntologySdk
-	templateCode string
-	tokenHash string
+	client Client
+	FactoryAddr common.Address
+	GasPrice uint64
+	GasLimit uint64
+}
+
+// NotFoundError is returned when the factory has no entry for Key
+type NotFoundError struct {
+	Method string
+	Key string
+}
+
+func (this *NotFoundError) Error() string {
+	return fmt.Sprintf("%s, factory has no entry for %s", this.Method, this.Key)
+}
+
+func NewUniswapFactory(client Client, factoryAddr common.Address, gasPrice, gasLimit uint64) *UniswapFactory {
+	return &UniswapFactory{
+		client: client,
+		FactoryAddr: factoryAddr,
+		GasPrice: gasPrice,
+		GasLimit: gasLimit,
+	}
+}
+
+// InitializeFactory sets the exchange template the factory deploys new exchanges from
+func (this *UniswapFactory) InitializeFactory(signer *sdk.Account, template common.Address) (common.Uint256, error) {
+	txHash, err := this.invoke(signer, "initializeFactory", hexOrder(template))
+	if err != nil {
+		return common.UINT256_EMPTY, fmt.Errorf("InitializeFactory, template: %s, %v", template.ToHexString(), err)
+	}
+	return txHash, nil
+}
+
+// CreateExchange sends the transaction creating the exchange of token, GetExchange returns it once the transaction is in a block
+func (this *UniswapFactory) CreateExchange(signer *sdk.Account, token common.Address) (common.Uint256, error) {
+	txHash, err := this.invoke(signer, "createExchange", hexOrder(token))
+	if err != nil {
+		return common.UINT256_EMPTY, fmt.Errorf("CreateExchange, token: %s, %v", token.ToHexString(), err)
+	}
+	return txHash, nil
+}
+
+// ExchangeTemplate returns the template set by InitializeFactory, or a *NotFoundError when the factory is not initialized
+func (this *UniswapFactory) ExchangeTemplate() (common.Address, error) {
+	template, err := this.getAddress("exchangeTemplate", "the exchange template")
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return template, nil
+}
+
+// GetExchange returns the exchange of token, or a *NotFoundError when there is none
+func (this *UniswapFactory) GetExchange(token common.Address) (common.Address, error) {
+	exchange, err := this.getAddress("getExchange", token.ToHexString(), hexOrder(token))
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return exchange, nil
+}
+
+// GetToken returns the token of exchange, or a *NotFoundError when the factory did not create exchange
+func (this *UniswapFactory) GetToken(exchange common.Address) (common.Address, error) {
+	token, err := this.getAddress("getToken", exchange.ToHexString(), hexOrder(exchange))
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return token, nil
+}
+
+// GetTokenWithId returns the token of the id-th exchange created, ids start at 1
+func (this *UniswapFactory) GetTokenWithId(id uint64) (common.Address, error) {
+	token, err := this.getAddress("getTokenWithId", fmt.Sprintf("id %d", id), id)
+	if err != nil {
+		return common.ADDRESS_EMPTY, err
+	}
+	return token, nil
 }
 
+// TokenCount returns the number of exchanges the factory created
+func (this *UniswapFactory) TokenCount() (uint64, error) {
+	res, err := this.client.PreExecInvokeNeoVMContract(this.FactoryAddr, []interface{}{"tokenCount", []interface{}{}})
+	if err != nil {
+		return 0, fmt.Errorf("TokenCount, factory: %s, pre invoke error: %v", this.FactoryAddr.ToHexString(), err)
+	}
+	count, err := res.Result.ToInteger()
+	if err != nil {
+		return 0, fmt.Errorf("TokenCount, ToInteger error: %v", err)
+	}
+	if !count.IsUint64() {
+		return 0, fmt.Errorf("TokenCount, bad count: %v", count)
+	}
+	return count.Uint64(), nil
+}
+
+func (this *UniswapFactory) invoke(signer *sdk.Account, method string, params ...interface{}) (common.Uint256, error) {
+	return this.client.InvokeNeoVMContract(this.GasPrice, this.GasLimit, signer, signer, this.FactoryAddr, []interface{}{method, params})
+}
+
+// getAddress pre-executes method and decodes the address it returns, an empty result is a *NotFoundError
+func (this *UniswapFactory) getAddress(method, key string, params ...interface{}) (common.Address, error) {
+	res, err := this.client.PreExecInvokeNeoVMContract(this.FactoryAddr, []interface{}{method, params})
+	if err != nil {
+		return common.ADDRESS_EMPTY, fmt.Errorf("%s, factory: %s, pre invoke error: %v", method, this.FactoryAddr.ToHexString(), err)
+	}
+	bs, err := res.Result.ToByteArray()
+	if err != nil {
+		return common.ADDRESS_EMPTY, fmt.Errorf("%s, ToByteArray error: %v", method, err)
+	}
+	if len(bs) == 0 {
+		return common.ADDRESS_EMPTY, &NotFoundError{Method: method, Key: key}
+	}
+	addr, err := common.AddressParseFromBytes(bs)
+	if err != nil {
+		return common.ADDRESS_EMPTY, fmt.Errorf("%s, result: %x is not an address: %v", method, bs, err)
+	}
+	return addr, nil
+}
+
+func hexOrder(addr common.Address) []byte {
+	return common.ToArrayReverse(addr[:])
+}
@@ -5,5 +5,6 @@ go 1.14
 require (
 	github.com/ontio/ontology v1.11.0
 	github.com/ontio/ontology-go-sdk v1.11.4
+	github.com/stretchr/testify v1.4.0
 	github.com/urfave/cli v1.22.1
 )
@@ -6,6 +6,7 @@ import (
 	"github.com/skyinglyh1/uniswap_v1_test/config"
 	"github.com/skyinglyh1/uniswap_v1_test/exchange"
 	"github.com/skyinglyh1/uniswap_v1_test/log"
+	"github.com/skyinglyh1/uniswap_v1_test/utils"
 	"github.com/urfave/cli"
 	"os"
 	"os/signal"
@@ -24,7 +25,16 @@ func setupApp() *cli.App {
 		cmd.OntPwd,
 		cmd.AlliaPwd,
 	}
-	app.Commands = []cli.Command{}
+	app.Commands = []cli.Command{
+		{
+			Name:   "bootstrap",
+			Usage:  "Compile, deploy, initialize and seed a fresh uniswap deployment, then write its config",
+			Action: bootstrap,
+			Flags: []cli.Flag{
+				cmd.OutputConfigFlag,
+			},
+		},
+	}
 	app.Before = func(context *cli.Context) error {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 		return nil
@@ -56,6 +66,37 @@ func startSync(ctx *cli.Context) {
 	waitToExit()
 }
 
+func bootstrap(ctx *cli.Context) error {
+	logLevel := ctx.GlobalInt(cmd.GetFlagName(cmd.LogLevelFlag))
+	log.InitLog(logLevel, log.Stdout)
+	configPath := ctx.GlobalString(cmd.GetFlagName(cmd.ConfigPathFlag))
+	if err := config.DefConfig.Init(configPath); err != nil {
+		return fmt.Errorf("DefConfig.Init error: %v", err)
+	}
+	accts, err := utils.GetAccounts(config.DefConfig.WalletPath, config.DefConfig.AcctPwd)
+	if err != nil {
+		return fmt.Errorf("GetAccounts error: %v", err)
+	}
+	if len(accts) == 0 {
+		return fmt.Errorf("no account in wallet: %s", config.DefConfig.WalletPath)
+	}
+	compiler, err := utils.NewCompiler(config.DefConfig)
+	if err != nil {
+		return err
+	}
+	bootstrapper := exchange.NewBootstrapper(exchange.NewRpcClient(config.DefConfig.OntRpcAddress), accts[0], compiler, config.DefConfig)
+	cfg, err := bootstrapper.Bootstrap(config.DefConfig)
+	if err != nil {
+		return err
+	}
+	output := ctx.String(cmd.GetFlagName(cmd.OutputConfigFlag))
+	if err := cfg.Save(output); err != nil {
+		return err
+	}
+	log.Infof("bootstrap, config of the deployment written to %s", output)
+	return nil
+}
+
 func waitToExit() {
 	exit := make(chan bool, 0)
 	sc := make(chan os.Signal, 1)
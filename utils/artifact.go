@@ -0,0 +1,241 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ontio/ontology/common"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ABI_EXT is the extension of the abi the python compilers write next to the avm
+const ABI_EXT = ".abi.json"
+
+// Abi is the abi.json of a python contract
+type Abi struct {
+	Hash string `json:"hash"`
+	EntryPoint string `json:"entrypoint"`
+	Functions []*AbiFunction `json:"functions"`
+}
+
+type AbiFunction struct {
+	Name string `json:"name"`
+	Parameters []*AbiParameter `json:"parameters"`
+	ReturnType string `json:"returntype"`
+}
+
+// AbiParameter is one parameter of a function, an empty Type accepts any value
+type AbiParameter struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ParseAbi decodes an abi.json, an empty one gives a nil abi
+func ParseAbi(data []byte) (*Abi, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	abi := new(Abi)
+	if err := json.Unmarshal(data, abi); err != nil {
+		return nil, fmt.Errorf("ParseAbi, json.Unmarshal error: %v", err)
+	}
+	return abi, nil
+}
+
+// readAbi reads the abi at path, a missing file gives a nil abi
+func readAbi(path string) (*Abi, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readAbi, ReadFile: %s, err: %v", path, err)
+	}
+	abi, err := ParseAbi(data)
+	if err != nil {
+		return nil, fmt.Errorf("readAbi, %s: %v", path, err)
+	}
+	return abi, nil
+}
+
+// Function returns the function called method, the entry point is not callable by name
+func (this *Abi) Function(method string) *AbiFunction {
+	for _, function := range this.Functions {
+		if function.Name == method && function.Name != this.EntryPoint {
+			return function
+		}
+	}
+	return nil
+}
+
+// Check tells whether method exists and takes args, in number and in type
+func (this *Abi) Check(method string, args []interface{}) error {
+	function := this.Function(method)
+	if function == nil {
+		return fmt.Errorf("no method %s%s", method, this.suggest(method))
+	}
+	if len(args) != len(function.Parameters) {
+		return fmt.Errorf("method %s takes %d params, got %d", method, len(function.Parameters), len(args))
+	}
+	for i, param := range function.Parameters {
+		if !matchAbiType(param.Type, args[i]) {
+			return fmt.Errorf("method %s, param %d %s is %s, got %T", method, i, param.Name, param.Type, args[i])
+		}
+	}
+	return nil
+}
+
+// suggest names the method that differs from method only by case, the usual typo
+func (this *Abi) suggest(method string) string {
+	for _, function := range this.Functions {
+		if strings.EqualFold(function.Name, method) {
+			return fmt.Sprintf(", did you mean %s", function.Name)
+		}
+	}
+	return ""
+}
+
+// matchAbiType tells whether arg can be passed as a param of type abiType through BuildNeoVMInvokeCode
+func matchAbiType(abiType string, arg interface{}) bool {
+	switch strings.ToLower(abiType) {
+	case "integer":
+		switch arg.(type) {
+		case int, int64, uint64, uint32, *big.Int:
+			return true
+		}
+	case "bytearray", "hash160", "address":
+		switch arg.(type) {
+		case []byte, common.Address:
+			return true
+		}
+	case "string":
+		_, ok := arg.(string)
+		return ok
+	case "boolean":
+		_, ok := arg.(bool)
+		return ok
+	case "array":
+		_, ok := arg.([]interface{})
+		return ok
+	default:
+		return true
+	}
+	return false
+}
+
+// Artifact is a compiled contract, CodeHash is the address it deploys to
+type Artifact struct {
+	Name string
+	CodeHash string
+	SourceHash string
+	CompiledAt time.Time
+	Avm string
+	Abi *Abi
+}
+
+// Code returns the avm of the artifact
+func (this *Artifact) Code() ([]byte, error) {
+	code, err := hex.DecodeString(this.Avm)
+	if err != nil {
+		return nil, fmt.Errorf("Artifact %s, decode avm error: %v", this.Name, err)
+	}
+	return code, nil
+}
+
+// CompileArtifact compiles path, with its abi when compiler is an AbiCompiler
+func CompileArtifact(compiler Compiler, path string) (*Artifact, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("CompileArtifact, ReadFile: %s, err: %v", path, err)
+	}
+	var code []byte
+	var abi *Abi
+	if abiCompiler, ok := compiler.(AbiCompiler); ok {
+		code, abi, err = abiCompiler.CompileWithAbi(path)
+	} else {
+		code, err = compiler.Compile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CompileArtifact, %v", err)
+	}
+	sourceHash, codeHash := sha256.Sum256(source), common.AddressFromVmCode(code)
+	return &Artifact{
+		Name: filepath.Base(path),
+		CodeHash: codeHash.ToHexString(),
+		SourceHash: hex.EncodeToString(sourceHash[:]),
+		CompiledAt: time.Now().UTC(),
+		Avm: hex.EncodeToString(code),
+		Abi: abi,
+	}, nil
+}
+
+// Manifest lists the artifacts of a deployment by source file name
+type Manifest struct {
+	Contracts map[string]*Artifact
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Contracts: make(map[string]*Artifact)}
+}
+
+func (this *Manifest) Add(artifact *Artifact) {
+	this.Contracts[artifact.Name] = artifact
+}
+
+// Names returns the contract names in order
+func (this *Manifest) Names() []string {
+	names := make([]string, 0, len(this.Contracts))
+	for name := range this.Contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the manifest to path as indented json
+func (this *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Manifest.Save, json.Marshal error: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("Manifest.Save, WriteFile: %s, err: %v", path, err)
+	}
+	return nil
+}
+
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadManifest, ReadFile: %s, err: %v", path, err)
+	}
+	manifest := NewManifest()
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("LoadManifest, %s json.Unmarshal error: %v", path, err)
+	}
+	return manifest, nil
+}
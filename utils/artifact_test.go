@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"github.com/ontio/ontology/common"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_AbiCheck(t *testing.T) {
+	abi, err := ParseAbi([]byte(`{"hash": "", "entrypoint": "Main", "functions": [
+		{"name": "Main", "parameters": [{"name": "operation", "type": "String"}, {"name": "args", "type": "Array"}]},
+		{"name": "getOntdToTokenInputPrice", "parameters": [{"name": "ontdSold", "type": "Integer"}], "returntype": "Integer"},
+		{"name": "transfer", "parameters": [{"name": "from", "type": "ByteArray"}, {"name": "to", "type": "ByteArray"}, {"name": "amount", "type": "Integer"}]}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParseAbi error: %v", err)
+	}
+	from, to := common.AddressFromVmCode([]byte("from")), common.AddressFromVmCode([]byte("to"))
+	if err := abi.Check("transfer", []interface{}{from, to[:], big.NewInt(1)}); err != nil {
+		t.Fatalf("Check transfer error: %v", err)
+	}
+	for _, c := range []struct {
+		method string
+		args []interface{}
+		err string
+	}{
+		{"Main", []interface{}{"transfer", []interface{}{}}, "no method Main"},
+		{"getontdToTokenInputPrice", []interface{}{1}, "did you mean getOntdToTokenInputPrice"},
+		{"getTokenToOntdInputPrice", []interface{}{1}, "no method getTokenToOntdInputPrice"},
+		{"transfer", []interface{}{from, to}, "takes 3 params, got 2"},
+		{"transfer", []interface{}{from, to, "1"}, "param 2 amount is Integer, got string"},
+	} {
+		if err := abi.Check(c.method, c.args); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("Check %s: %v, expect %s", c.method, err, c.err)
+		}
+	}
+	if abi, err := ParseAbi([]byte("\n")); abi != nil || err != nil {
+		t.Fatalf("ParseAbi of nothing: %v, %v", abi, err)
+	}
+}
+
+func Test_Manifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "token.py"), "def Main(operation, args):\n    pass\n")
+	writeFile(t, filepath.Join(dir, "token.avm"), "00c56b")
+	writeFile(t, filepath.Join(dir, "token"+ABI_EXT), `{"entrypoint": "Main", "functions": [{"name": "name", "parameters": []}]}`)
+	writeFile(t, filepath.Join(dir, "plain.py"), "pass\n")
+	writeFile(t, filepath.Join(dir, "plain.avm"), "51")
+
+	manifest := NewManifest()
+	for _, file := range []string{"token.py", "plain.py"} {
+		artifact, err := CompileArtifact(&ArtifactCompiler{Dir: dir}, filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("CompileArtifact %s error: %v", file, err)
+		}
+		manifest.Add(artifact)
+	}
+	token := manifest.Contracts["token.py"]
+	code, err := token.Code()
+	expect := common.AddressFromVmCode([]byte{0x00, 0xc5, 0x6b})
+	if err != nil || len(code) != 3 || token.CodeHash != expect.ToHexString() || len(token.SourceHash) != 64 || token.CompiledAt.IsZero() {
+		t.Fatalf("artifact: %+v, code: %x, err: %v", token, code, err)
+	}
+	if token.Abi == nil || token.Abi.Function("name") == nil || manifest.Contracts["plain.py"].Abi != nil {
+		t.Fatalf("abi of the artifacts: %+v, %+v", token.Abi, manifest.Contracts["plain.py"].Abi)
+	}
+
+	path := filepath.Join(dir, "manifest.json")
+	if err := manifest.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	loaded, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("LoadManifest error: %v", err)
+	}
+	if names := loaded.Names(); len(names) != 2 || names[0] != "plain.py" || names[1] != "token.py" {
+		t.Fatalf("loaded names: %v", names)
+	}
+	if got := loaded.Contracts["token.py"]; got.SourceHash != token.SourceHash || got.Avm != token.Avm || !got.CompiledAt.Equal(token.CompiledAt) || got.Abi.Check("name", nil) != nil {
+		t.Fatalf("loaded artifact: %+v", got)
+	}
+}
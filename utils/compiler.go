@@ -0,0 +1,291 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	COMPILER_REMOTE = "remote"
+	COMPILER_LOCAL = "local"
+	COMPILER_ARTIFACTS = "artifacts"
+	// AVM_EXT is the extension of compiled contracts, next to their source or in an artifacts directory
+	AVM_EXT = ".avm"
+)
+
+// Compiler turns a python contract source file into avm code
+type Compiler interface {
+	Compile(path string) ([]byte, error)
+}
+
+// AbiCompiler is a Compiler that gives the abi of the contract as well, nil when it has none
+type AbiCompiler interface {
+	Compiler
+	CompileWithAbi(path string) ([]byte, *Abi, error)
+}
+
+// CompilerFunc adapts a function to a Compiler
+type CompilerFunc func(path string) ([]byte, error)
+
+func (this CompilerFunc) Compile(path string) ([]byte, error) {
+	return this(path)
+}
+
+// NewCompiler returns the compiler cfg.Compiler names, remote by default, cached in cfg.CompileCachePath when it is set
+func NewCompiler(cfg *config.Config) (Compiler, error) {
+	var compiler Compiler
+	switch cfg.Compiler {
+	case "", COMPILER_REMOTE:
+		url := cfg.CompilerUrl
+		if url == "" {
+			url = CompilerUrl
+		}
+		compiler = NewRemoteCompiler(url)
+	case COMPILER_LOCAL:
+		if cfg.CompilerCommand == "" {
+			return nil, fmt.Errorf("NewCompiler, local compiler needs CompilerCommand")
+		}
+		compiler = &LocalCompiler{Command: cfg.CompilerCommand, Args: cfg.CompilerArgs}
+	case COMPILER_ARTIFACTS:
+		if cfg.ArtifactsPath == "" {
+			return nil, fmt.Errorf("NewCompiler, artifacts compiler needs ArtifactsPath")
+		}
+		compiler = &ArtifactCompiler{Dir: cfg.ArtifactsPath}
+	default:
+		return nil, fmt.Errorf("NewCompiler, unknown compiler: %s", cfg.Compiler)
+	}
+	if cfg.CompileCachePath != "" {
+		compiler = &CachingCompiler{Compiler: compiler, Dir: cfg.CompileCachePath}
+	}
+	return compiler, nil
+}
+
+// RemoteCompiler posts the source to an http compiler service
+type RemoteCompiler struct {
+	Url string
+	Client *http.Client
+}
+
+func NewRemoteCompiler(url string) *RemoteCompiler {
+	return &RemoteCompiler{Url: url, Client: &http.Client{Timeout: time.Minute}}
+}
+
+func (this *RemoteCompiler) Compile(path string) ([]byte, error) {
+	code, _, err := this.CompileWithAbi(path)
+	return code, err
+}
+
+func (this *RemoteCompiler) CompileWithAbi(path string) ([]byte, *Abi, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, ReadFile: %s, err: %v", path, err)
+	}
+	payloadBs, err := json.Marshal(CompilePayLoad{Type: "Python", Code: string(data)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, jsonMarshal payload err: %v", err)
+	}
+	resp, err := this.Client.Post(this.Url, "application/json", bytes.NewReader(payloadBs))
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, http.Post error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, read response body error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("RemoteCompiler, %s: %s", resp.Status, body)
+	}
+	rsp := new(CompileResponse)
+	if err := json.Unmarshal(body, rsp); err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, json.Unmarshal response: %s error: %v", body, err)
+	}
+	if rsp.ErrorCode != 0 {
+		return nil, nil, fmt.Errorf("RemoteCompiler, compile %s err code: %v", path, rsp.ErrorCode)
+	}
+	avmCode, err := parseAvm(rsp.Avm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, %v", err)
+	}
+	abi, err := ParseAbi([]byte(rsp.Abi))
+	if err != nil {
+		return nil, nil, fmt.Errorf("RemoteCompiler, %v", err)
+	}
+	return avmCode, abi, nil
+}
+
+// parseAvm decodes the hex avm the service returns, either bare or as a python bytes literal b'...'
+func parseAvm(avm string) ([]byte, error) {
+	avm = strings.TrimSpace(avm)
+	if strings.HasPrefix(avm, "b'") && strings.HasSuffix(avm, "'") {
+		avm = avm[2 : len(avm)-1]
+	}
+	if avm == "" {
+		return nil, fmt.Errorf("parseAvm, empty avm")
+	}
+	code, err := hex.DecodeString(avm)
+	if err != nil {
+		return nil, fmt.Errorf("parseAvm, decode avm error: %v", err)
+	}
+	return code, nil
+}
+
+// LocalCompiler runs an installed compiler as `Command Args... path`, like neo-boa and ontology-python-compiler
+// it is expected to write the avm next to the source
+type LocalCompiler struct {
+	Command string
+	Args []string
+}
+
+func (this *LocalCompiler) Compile(path string) ([]byte, error) {
+	code, _, err := this.CompileWithAbi(path)
+	return code, err
+}
+
+// CompileWithAbi reads the abi the compiler writes next to the avm, if any
+func (this *LocalCompiler) CompileWithAbi(path string) ([]byte, *Abi, error) {
+	prefix := strings.TrimSuffix(path, filepath.Ext(path))
+	// a stale avm or abi must not pass for the output of this run
+	for _, output := range []string{prefix + AVM_EXT, prefix + ABI_EXT} {
+		if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("LocalCompiler, remove %s error: %v", output, err)
+		}
+	}
+	cmd := exec.Command(this.Command, append(append([]string{}, this.Args...), path)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("LocalCompiler, %s %s error: %v, output: %s", this.Command, path, err, output)
+	}
+	code, err := readAvm(prefix + AVM_EXT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LocalCompiler, %v", err)
+	}
+	abi, err := readAbi(prefix + ABI_EXT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LocalCompiler, %v", err)
+	}
+	return code, abi, nil
+}
+
+// ArtifactCompiler reads precompiled <name>.avm files from Dir for the sources <name>.py
+type ArtifactCompiler struct {
+	Dir string
+}
+
+func (this *ArtifactCompiler) Compile(path string) ([]byte, error) {
+	code, _, err := this.CompileWithAbi(path)
+	return code, err
+}
+
+// CompileWithAbi reads <name>.abi.json from Dir as well, if any
+func (this *ArtifactCompiler) CompileWithAbi(path string) ([]byte, *Abi, error) {
+	base := filepath.Base(path)
+	prefix := filepath.Join(this.Dir, strings.TrimSuffix(base, filepath.Ext(base)))
+	code, err := readAvm(prefix + AVM_EXT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ArtifactCompiler, %v", err)
+	}
+	abi, err := readAbi(prefix + ABI_EXT)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ArtifactCompiler, %v", err)
+	}
+	return code, abi, nil
+}
+
+// readAvm reads an avm file written either as raw bytes or as hex text
+func readAvm(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("readAvm, ReadFile: %s, err: %v", path, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("readAvm, %s is empty", path)
+	}
+	if code, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		return code, nil
+	}
+	return data, nil
+}
+
+// CachingCompiler keeps the avm of every source it compiled in Dir, keyed by the sha256 of the source,
+// so an unchanged source compiles to the same code without asking Compiler again
+type CachingCompiler struct {
+	Compiler Compiler
+	Dir string
+}
+
+func (this *CachingCompiler) Compile(path string) ([]byte, error) {
+	code, _, err := this.CompileWithAbi(path)
+	return code, err
+}
+
+// CompileWithAbi caches the abi next to the avm when Compiler is an AbiCompiler
+func (this *CachingCompiler) CompileWithAbi(path string) ([]byte, *Abi, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CachingCompiler, ReadFile: %s, err: %v", path, err)
+	}
+	hash := sha256.Sum256(source)
+	prefix := filepath.Join(this.Dir, hex.EncodeToString(hash[:]))
+	if code, err := readAvm(prefix + AVM_EXT); err == nil {
+		abi, err := readAbi(prefix + ABI_EXT)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CachingCompiler, %v", err)
+		}
+		return code, abi, nil
+	}
+	var code []byte
+	var abi *Abi
+	if abiCompiler, ok := this.Compiler.(AbiCompiler); ok {
+		code, abi, err = abiCompiler.CompileWithAbi(path)
+	} else {
+		code, err = this.Compiler.Compile(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(this.Dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("CachingCompiler, MkdirAll: %s, err: %v", this.Dir, err)
+	}
+	if abi != nil {
+		data, err := json.Marshal(abi)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CachingCompiler, json.Marshal abi error: %v", err)
+		}
+		if err := ioutil.WriteFile(prefix+ABI_EXT, data, 0644); err != nil {
+			return nil, nil, fmt.Errorf("CachingCompiler, WriteFile: %s, err: %v", prefix+ABI_EXT, err)
+		}
+	}
+	// the avm is written last, it marks the cache entry complete
+	if err := ioutil.WriteFile(prefix+AVM_EXT, []byte(hex.EncodeToString(code)), 0644); err != nil {
+		return nil, nil, fmt.Errorf("CachingCompiler, WriteFile: %s, err: %v", prefix+AVM_EXT, err)
+	}
+	return code, abi, nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2020 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/skyinglyh1/uniswap_v1_test/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+}
+
+func Test_ParseAvm(t *testing.T) {
+	for _, avm := range []string{"b'00c56b'", "00c56b", " b'00c56b'\n"} {
+		if code, err := parseAvm(avm); err != nil || !bytes.Equal(code, []byte{0x00, 0xc5, 0x6b}) {
+			t.Fatalf("parseAvm(%q): %x, err: %v", avm, code, err)
+		}
+	}
+	for _, avm := range []string{"", "b''", "b'zz'"} {
+		if _, err := parseAvm(avm); err == nil {
+			t.Fatalf("parseAvm accepts %q", avm)
+		}
+	}
+}
+
+func Test_RemoteCompiler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := new(CompilePayLoad)
+		if err := json.NewDecoder(r.Body).Decode(payload); err != nil || payload.Type != "Python" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rsp := &CompileResponse{Avm: fmt.Sprintf("b'%x'", payload.Code)}
+		if payload.Code == "broken" {
+			rsp = &CompileResponse{ErrorCode: 1}
+		}
+		json.NewEncoder(w).Encode(rsp)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "compiler")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, broken := filepath.Join(dir, "contract.py"), filepath.Join(dir, "broken.py")
+	writeFile(t, source, "source")
+	writeFile(t, broken, "broken")
+	compiler, err := NewCompiler(&config.Config{CompilerUrl: server.URL})
+	if err != nil {
+		t.Fatalf("NewCompiler error: %v", err)
+	}
+	if code, err := compiler.Compile(source); err != nil || string(code) != "source" {
+		t.Fatalf("Compile: %x, err: %v", code, err)
+	}
+	if _, err := compiler.Compile(broken); err == nil {
+		t.Fatalf("Compile succeeds on an error code")
+	}
+}
+
+func Test_LocalAndArtifactCompilers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compiler")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "contract.py")
+	writeFile(t, source, "source")
+
+	// like neo-boa, the script writes contract.avm next to contract.py
+	local, err := NewCompiler(&config.Config{Compiler: COMPILER_LOCAL, CompilerCommand: "sh", CompilerArgs: []string{"-c", `printf '\001\002' > "${0%.py}.avm"`}})
+	if err != nil {
+		t.Fatalf("NewCompiler error: %v", err)
+	}
+	if code, err := local.Compile(source); err != nil || !bytes.Equal(code, []byte{1, 2}) {
+		t.Fatalf("local Compile: %x, err: %v", code, err)
+	}
+	failing := &LocalCompiler{Command: "sh", Args: []string{"-c", "exit 1"}}
+	if _, err := failing.Compile(source); err == nil {
+		t.Fatalf("local Compile succeeds when the compiler fails")
+	}
+
+	artifacts := filepath.Join(dir, "artifacts")
+	if err := os.Mkdir(artifacts, 0755); err != nil {
+		t.Fatalf("Mkdir error: %v", err)
+	}
+	writeFile(t, filepath.Join(artifacts, "contract.avm"), "0a0b\n")
+	compiler, err := NewCompiler(&config.Config{Compiler: COMPILER_ARTIFACTS, ArtifactsPath: artifacts})
+	if err != nil {
+		t.Fatalf("NewCompiler error: %v", err)
+	}
+	if code, err := compiler.Compile(filepath.Join("elsewhere", "contract.py")); err != nil || !bytes.Equal(code, []byte{0x0a, 0x0b}) {
+		t.Fatalf("artifact Compile: %x, err: %v", code, err)
+	}
+	if _, err := compiler.Compile("missing.py"); err == nil {
+		t.Fatalf("artifact Compile of a missing artifact")
+	}
+	if _, err := NewCompiler(&config.Config{Compiler: "unknown"}); err == nil {
+		t.Fatalf("NewCompiler accepts an unknown compiler")
+	}
+}
+
+func Test_CachingCompiler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compiler")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "contract.py")
+	writeFile(t, source, "v1")
+
+	compiles := 0
+	compiler := &CachingCompiler{Dir: filepath.Join(dir, "cache"), Compiler: CompilerFunc(func(path string) ([]byte, error) {
+		compiles++
+		data, err := ioutil.ReadFile(path)
+		return append([]byte{byte(compiles)}, data...), err
+	})}
+	first, err := compiler.Compile(source)
+	if err != nil {
+		t.Fatalf("Compile error: %v", err)
+	}
+	if again, err := compiler.Compile(source); err != nil || !bytes.Equal(again, first) || compiles != 1 {
+		t.Fatalf("cached Compile: %x, err: %v, %d compiles", again, err, compiles)
+	}
+	writeFile(t, source, "v2")
+	if changed, err := compiler.Compile(source); err != nil || bytes.Equal(changed, first) || compiles != 2 {
+		t.Fatalf("Compile of a changed source: %x, err: %v, %d compiles", changed, err, compiles)
+	}
+}
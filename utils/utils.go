@@ -18,16 +18,12 @@
 package utils
 
 import (
-	"bytes"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	ontology_go_sdk "github.com/ontio/ontology-go-sdk"
 	sdkcommon "github.com/ontio/ontology-go-sdk/common"
 	"github.com/ontio/ontology/common"
-	"github.com/skyinglyh1/uniswap_v1_test/config"
-	"io/ioutil"
-	"net/http"
+	"github.com/ontio/ontology/core/payload"
 	"strings"
 )
 type CompilePayLoad struct {
@@ -43,119 +39,90 @@ type CompileResponse struct {
 	FuncMap string `json:"funcmap"`
 }
 
+// CompilerUrl is the compiler service used when the config names none
 const CompilerUrl = "http://42.159.92.140:8089/api/v2.0/python/compile"
 
 
 func GetSdkAndAccount(url, walletPath, passwd string) (*ontology_go_sdk.OntologySdk, []*ontology_go_sdk.Account, error){
-	err := config.DefConfig.Init(walletPath)
-	if err != nil {
-		fmt.Println("DefConfig.Init error:", err)
-		return nil, nil, fmt.Errorf("DefConfig.Init error: %v", err)
-	}
 	ontSdk := ontology_go_sdk.NewOntologySdk()
 	ontSdk.NewRpcClient().SetAddress(url)
 
-	wallet, err := ontSdk.OpenWallet(walletPath)
+	accts, err := GetAccounts(walletPath, passwd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ontSdk, accts, nil
+}
+
+// GetAccounts opens the wallet at walletPath and decrypts all its accounts with passwd
+func GetAccounts(walletPath, passwd string) ([]*ontology_go_sdk.Account, error) {
+	wallet, err := ontology_go_sdk.OpenWallet(walletPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("OpenWallet error: %v", err)
+		return nil, fmt.Errorf("OpenWallet error: %v", err)
 	}
 	accts := make([]*ontology_go_sdk.Account, 0)
 	count := wallet.GetAccountCount()
 	for i:=1; i <= count; i++ {
 		acct, err := wallet.GetAccountByIndex(i, []byte(passwd))
 		if err != nil {
-			return nil, nil, fmt.Errorf("wallet.GetDefaultAccount error: %v", err)
+			return nil, fmt.Errorf("wallet.GetAccountByIndex error: %v", err)
 		}
 		accts = append(accts, acct)
 	}
-
-	return ontSdk, accts, nil
+	return accts, nil
 }
 
+// CompileContract compiles contractFilePath with the compiler service at CompilerUrl
 func CompileContract(contractFilePath string) ([]byte, error) {
-	//contractsPath := config.ContractsPath
-	//factoryFile := contractsPath + "uniswap_factory.py"
-	//exchangeFile := contractsPath + "uniswap_exchange.py"
-	data, err := ioutil.ReadFile(contractFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("ReadFile: %s, err: %v", contractFilePath, err)
-	}
-	payload := CompilePayLoad{
-		Type: "Python",
-		Code: string(data),
-	}
-	payloadBs, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("jsonMarshal payload err: %v", err)
-	}
-	resp, err := http.Post(CompilerUrl, "application/json", bytes.NewReader(payloadBs))
-	if err != nil {
-		return nil, fmt.Errorf("http.Post error: %v", err)
-	}
-	defer resp.Body.Close()
+	return NewRemoteCompiler(CompilerUrl).Compile(contractFilePath)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read rpc response body error:%s", err)
-	}
-	rpcRsp := new(CompileResponse)
-	err = json.Unmarshal(body, rpcRsp)
-	if err != nil {
-		return nil, fmt.Errorf("json.Unmarshal JsonRpcResponse:%s error:%s", body, err)
-	}
-	if rpcRsp.ErrorCode != 0 {
-		return nil, fmt.Errorf("err code: %v", rpcRsp.ErrorCode)
-	}
-	avm := strings.Split(rpcRsp.Avm, "'")
-	avmCode, err := hex.DecodeString(avm[1])
+// ContractGetter reads deployed contracts, *ontology_go_sdk.OntologySdk is one
+type ContractGetter interface {
+	GetSmartContract(contractAddr string) (*payload.DeployCode, error)
+}
+
+// CheckContractExist tells whether a contract is deployed at contractHash
+func CheckContractExist(getter ContractGetter, contractHash common.Address) (bool, error) {
+	dc, err := getter.GetSmartContract(contractHash.ToHexString())
 	if err != nil {
-		return nil, fmt.Errorf("decode response.Avm err: %v", err)
+		// the node answers an unknown contract with an error code rather than an empty result
+		if strings.Contains(err.Error(), "UNKNOWN CONTRACT") || strings.Contains(err.Error(), "44004") {
+			return false, nil
+		}
+		return false, fmt.Errorf("CheckContractExist, contract: %s, GetSmartContract error: %v", contractHash.ToHexString(), err)
 	}
-	return avmCode, nil
+	return dc != nil, nil
 }
 
-func CheckContractDeployed(sdk *ontology_go_sdk.OntologySdk, contractHash common.Address) bool {
-	sdk.GetSmartContract(contractHash.ToHexString())
-	return true
+// Deployer sends deploy transactions, ontology_go_sdk.NeoVMContract is one
+type Deployer interface {
+	DeployNeoVMSmartContract(gasPrice, gasLimit uint64, signer *ontology_go_sdk.Account, needStorage bool, code, name, version, author, email, desc string) (common.Uint256, error)
 }
 
-func DeployContract(sdk *ontology_go_sdk.OntologySdk, avmCode []byte, signer *ontology_go_sdk.Account) (*common.Uint256, error) {
-	txHash, err := sdk.NeoVM.DeployNeoVMSmartContract(config.DefConfig.GasPrice, config.DefConfig.GasLimit * 100000, signer, true, hex.EncodeToString(avmCode), "name", "Version", "author", "email", "desc")
+// DeployContract sends the transaction deploying avmCode with storage, the contract address is common.AddressFromVmCode(avmCode)
+func DeployContract(deployer Deployer, gasPrice, gasLimit uint64, avmCode []byte, signer *ontology_go_sdk.Account, name string) (common.Uint256, error) {
+	txHash, err := deployer.DeployNeoVMSmartContract(gasPrice, gasLimit, signer, true, hex.EncodeToString(avmCode), name, "1.0", "uniswap_v1_test", "", name)
 	if err != nil {
-		return nil, fmt.Errorf("DepolyContract, error: %v", err)
+		return common.UINT256_EMPTY, fmt.Errorf("DeployContract, %s error: %v", name, err)
 	}
-	return &txHash, nil
+	return txHash, nil
 }
 
-
-func CheckContracts(sdk *ontology_go_sdk.OntologySdk, factoryPath, tokenPath string, factoryHash, tokenHash common.Address, filePriorHash bool) ([]common.Address, error) {
+// CheckContracts returns the hashes of the factory and token contracts, compiled from their files when filePriorHash is set
+func CheckContracts(compiler Compiler, factoryPath, tokenPath string, factoryHash, tokenHash common.Address, filePriorHash bool) ([]common.Address, error) {
+	if !filePriorHash {
+		return []common.Address{factoryHash, tokenHash}, nil
+	}
 	newConHashes := make([]common.Address, 0)
-	if filePriorHash {
-		// Need to compile contract
-		avmCode, err := CompileContract(factoryPath)
+	for _, path := range []string{factoryPath, tokenPath} {
+		avmCode, err := compiler.Compile(path)
 		if err != nil {
-			return nil, fmt.Errorf("Compile contract with path %s error: %v", factoryPath, err)
+			return nil, fmt.Errorf("Compile contract with path %s error: %v", path, err)
 		}
-		newConH := common.AddressFromVmCode(avmCode)
-		newConHashes = append(newConHashes, newConH)
-
-		avmCode, err = CompileContract(factoryPath)
-		if err != nil {
-			return nil, fmt.Errorf("Compile contract with path %s error: %v", tokenPath, err)
-		}
-		newConH = common.AddressFromVmCode(avmCode)
-		newConHashes = append(newConHashes, newConH)
-
+		newConHashes = append(newConHashes, common.AddressFromVmCode(avmCode))
 	}
-	//for _, file := range hashToContractFiles {
-	//	avmCode, err := CompileContract(file)
-	//	if err != nil {
-	//		return fmt.Errorf("Compile contract with path %s error: %v", )
-	//	}
-	//	contractAddr := common.AddressFromVmCode(avmCode)
-	//
-	//}
-	return nil, nil
+	return newConHashes, nil
 }
 
 
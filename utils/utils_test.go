@@ -22,7 +22,6 @@ import (
 	"github.com/ontio/ontology/common"
 	"github.com/skyinglyh1/uniswap_v1_test/config"
 	"testing"
-	"time"
 )
 
 func Test_CompileDeployContract(t *testing.T) {